@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/agent"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries no credentials it handles,
+// the next authenticator of a chain is tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity is an authenticated caller
+type Identity struct {
+	Subject string `json:"subject"`
+	// Tenant scopes the sessions, history and runs of the caller, the subject is used when it is empty
+	Tenant string `json:"tenant,omitempty"`
+	// Admin allows the caller to use the /api/admin endpoints
+	Admin bool `json:"admin,omitempty"`
+}
+
+// tenant returns the tenant of the identity
+func (id *Identity) tenant() string {
+	if id.Tenant != "" {
+		return id.Tenant
+	}
+	return id.Subject
+}
+
+// Authenticator authenticates API requests, it is the hook for custom authentication
+type Authenticator interface {
+	// Authenticate returns the identity of the caller, ErrNoCredentials when the request carries no
+	// credentials for this authenticator or another error when the credentials are invalid
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator
+type AuthenticatorFunc func(r *http.Request) (*Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Identity, error) {
+	return f(r)
+}
+
+// Authenticators tries each authenticator in order until one accepts or rejects the credentials
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(r *http.Request) (*Identity, error) {
+	for _, auth := range a {
+		id, err := auth.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return id, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// APIKeys authenticates requests by static API keys sent as "Authorization: Bearer <key>" or in the X-API-Key header
+type APIKeys map[string]Identity
+
+func (k APIKeys) Authenticate(r *http.Request) (*Identity, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = bearerToken(r)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	var found *Identity
+	for candidate, id := range k {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			found = &id
+		}
+	}
+	if found == nil {
+		return nil, ErrNoCredentials
+	}
+	return found, nil
+}
+
+// JWTAuth verifies HS256 bearer tokens signed with a local key.
+// The subject is the sub claim, the tenant is the TenantClaim claim and a true admin claim marks an admin.
+type JWTAuth struct {
+	Key []byte
+	// Issuer and Audience are checked against the iss and aud claims when set
+	Issuer   string
+	Audience string
+	// TenantClaim is the claim holding the tenant, "tenant" by default
+	TenantClaim string
+	// Leeway is the allowed clock skew for the exp and nbf claims
+	Leeway time.Duration
+	// now returns the current time, for tests
+	now func() time.Time
+}
+
+func (j *JWTAuth) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	if strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+	claims, err := j.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	tenantClaim := j.TenantClaim
+	if tenantClaim == "" {
+		tenantClaim = "tenant"
+	}
+	id := &Identity{}
+	id.Subject, _ = claims["sub"].(string)
+	id.Tenant, _ = claims[tenantClaim].(string)
+	id.Admin, _ = claims["admin"].(bool)
+	if id.Subject == "" && id.Tenant == "" {
+		return nil, errors.New("invalid token: no subject")
+	}
+	return id, nil
+}
+
+// verify checks the signature and the registered claims of a token and returns its claims
+func (j *JWTAuth) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported algorithm '%s'", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	mac := hmac.New(sha256.New, j.Key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.New("signature mismatch")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	now := time.Now()
+	if j.now != nil {
+		now = j.now()
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(j.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(j.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	if j.Issuer != "" && claims["iss"] != j.Issuer {
+		return nil, errors.New("issuer mismatch")
+	}
+	if j.Audience != "" && !hasAudience(claims["aud"], j.Audience) {
+		return nil, errors.New("audience mismatch")
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasAudience reports whether the aud claim, a string or an array, contains audience
+func hasAudience(aud any, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []any:
+		for _, a := range v {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bearerToken returns the bearer token of the Authorization header.
+// WebSocket handshakes from browsers cannot set headers, they pass the token in the access_token query parameter.
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity of the authenticated caller, nil when authentication is disabled
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// authMiddleware authenticates all requests but the health check, the identity and its tenant
+// are carried by the request context
+func authMiddleware(auth Authenticator, next http.Handler) http.Handler {
+	if auth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := auth.Authenticate(r)
+		if err == nil && id == nil {
+			err = ErrNoCredentials
+		}
+		if err == nil && id.tenant() == "" {
+			// The default tenant is reserved for servers without authentication
+			err = errors.New("identity without subject or tenant")
+		}
+		if err != nil {
+			if !errors.Is(err, ErrNoCredentials) {
+				log.Printf("Authentication failed: %v", err)
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			if strings.HasPrefix(r.URL.Path, "/v1/") {
+				sendOpenAIError(w, http.StatusUnauthorized, "unauthorized")
+			} else {
+				sendErrorResponse(w, http.StatusUnauthorized, "unauthorized")
+			}
+			return
+		}
+		ctx := context.WithValue(r.Context(), identityKey{}, id)
+		ctx = agent.WithTenant(ctx, id.tenant())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// adminOnly restricts next to admin identities, it is open like the rest of the API when authentication is disabled
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id := IdentityFromContext(r.Context()); id != nil && !id.Admin {
+			sendErrorResponse(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next(w, r)
+	}
+}
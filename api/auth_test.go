@@ -0,0 +1,179 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/agent"
+)
+
+// signJWT signs claims with HS256
+func signJWT(t *testing.T, key []byte, alg string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signing))
+	return signing + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTAuth(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1_700_000_000, 0)
+	auth := &JWTAuth{Key: key, Audience: "langchat", now: func() time.Time { return now }}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantTenant string
+		wantErr    bool
+	}{
+		{"valid", signJWT(t, key, "HS256", map[string]any{"sub": "u1", "tenant": "acme", "aud": "langchat", "exp": now.Add(time.Hour).Unix()}), "acme", false},
+		{"audience array", signJWT(t, key, "HS256", map[string]any{"sub": "u1", "aud": []string{"other", "langchat"}}), "u1", false},
+		{"expired", signJWT(t, key, "HS256", map[string]any{"sub": "u1", "aud": "langchat", "exp": now.Add(-time.Hour).Unix()}), "", true},
+		{"not valid yet", signJWT(t, key, "HS256", map[string]any{"sub": "u1", "aud": "langchat", "nbf": now.Add(time.Hour).Unix()}), "", true},
+		{"wrong key", signJWT(t, []byte("other"), "HS256", map[string]any{"sub": "u1", "aud": "langchat"}), "", true},
+		{"wrong audience", signJWT(t, key, "HS256", map[string]any{"sub": "u1", "aud": "other"}), "", true},
+		{"alg none", signJWT(t, key, "none", map[string]any{"sub": "u1", "aud": "langchat"}), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			id, err := auth.Authenticate(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && id.tenant() != tt.wantTenant {
+				t.Errorf("Expected tenant %q, got %q", tt.wantTenant, id.tenant())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, key, "HS256", map[string]any{"sub": "ops", "aud": "langchat", "admin": true}))
+	if id, err := auth.Authenticate(req); err != nil || !id.Admin {
+		t.Errorf("Expected an admin identity, got %+v (%v)", id, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/runs", nil)
+	req.Header.Set("Authorization", "Bearer not-a-jwt")
+	if _, err := auth.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected ErrNoCredentials for a non-JWT token, got %v", err)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	key := []byte("secret")
+	auth := Authenticators{
+		APIKeys{"key-a": {Subject: "service-a", Tenant: "a"}, "key-empty": {}, "key-admin": {Subject: "ops", Admin: true}},
+		&JWTAuth{Key: key},
+		AuthenticatorFunc(func(r *http.Request) (*Identity, error) {
+			if r.Header.Get("X-Internal") == "yes" {
+				return &Identity{Subject: "internal"}, nil
+			}
+			return nil, ErrNoCredentials
+		}),
+	}
+	a := &mockAgent{chatResponse: "ok"}
+	server := httptest.NewServer(NewServer(a, ServerConfig{Auth: auth}).httpServer.Handler)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		header     map[string]string
+		wantStatus int
+		wantTenant string
+	}{
+		{"health is open", "/health", nil, http.StatusOK, ""},
+		{"no credentials", "/api/chat", nil, http.StatusUnauthorized, ""},
+		{"unknown key", "/api/chat", map[string]string{"X-API-Key": "nope"}, http.StatusUnauthorized, ""},
+		{"api key header", "/api/chat", map[string]string{"X-API-Key": "key-a"}, http.StatusOK, "a"},
+		{"api key bearer", "/api/chat", map[string]string{"Authorization": "Bearer key-a"}, http.StatusOK, "a"},
+		{"jwt", "/api/chat", map[string]string{"Authorization": "Bearer " + signJWT(t, key, "HS256", map[string]any{"sub": "u1", "tenant": "b"})}, http.StatusOK, "b"},
+		{"invalid jwt", "/api/chat", map[string]string{"Authorization": "Bearer " + signJWT(t, []byte("x"), "HS256", map[string]any{"sub": "u1"})}, http.StatusUnauthorized, ""},
+		{"hook", "/api/chat", map[string]string{"X-Internal": "yes"}, http.StatusOK, "internal"},
+		{"admin endpoint", "/api/admin/skills/reload", map[string]string{"X-API-Key": "key-a"}, http.StatusForbidden, ""},
+		{"admin endpoint with admin", "/api/admin/skills/reload", map[string]string{"X-API-Key": "key-admin"}, http.StatusNotImplemented, ""},
+		{"identity without tenant", "/api/chat", map[string]string{"X-API-Key": "key-empty"}, http.StatusUnauthorized, ""},
+		{"session id with slash", "/api/chat", map[string]string{"X-API-Key": "key-a", SessionIDHeader: "b/s1"}, http.StatusBadRequest, ""},
+		{"openai session id with slash", "/v1/chat/completions", map[string]string{"X-API-Key": "key-a", SessionIDHeader: "b/s1"}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, body := http.MethodPost, `{"message": "Hello"}`
+			if tt.path == "/v1/chat/completions" {
+				body = `{"messages": [{"role": "user", "content": "Hello"}]}`
+			}
+			if tt.path == "/health" {
+				method, body = http.MethodGet, ""
+			}
+			req, _ := http.NewRequest(method, server.URL+tt.path, strings.NewReader(body))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantTenant != "" && agent.TenantFromContext(a.lastCtx) != tt.wantTenant {
+				t.Errorf("Expected tenant %q, got %q", tt.wantTenant, agent.TenantFromContext(a.lastCtx))
+			}
+		})
+	}
+}
+
+func TestRunsTenantScoped(t *testing.T) {
+	h := NewHandler(&mockAgent{})
+	ctxA := agent.WithTenant(t.Context(), "a")
+	run, _, _ := h.runs.begin(ctxA, "s1")
+	defer run.finish(RunDone)
+
+	if _, ok := h.runs.get(agent.WithTenant(t.Context(), "b"), run.id); ok {
+		t.Error("Expected the run to be hidden from another tenant")
+	}
+	if runs := h.runs.list(agent.WithTenant(t.Context(), "b")); len(runs) != 0 {
+		t.Errorf("Expected no runs for another tenant, got %d", len(runs))
+	}
+	if _, ok := h.runs.get(ctxA, run.id); !ok {
+		t.Error("Expected the run to be visible to its tenant")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	handler := NewServer(&mockAgent{}, ServerConfig{AllowedOrigins: []string{"https://app.example.com"}}).httpServer.Handler
+
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.example.com", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodOptions, "/api/chat", nil)
+		req.Header.Set("Origin", tt.origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("Origin %s: expected Access-Control-Allow-Origin %q, got %q", tt.origin, tt.want, got)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,12 +18,16 @@ import (
 // Handler handles HTTP requests for the chat agent
 type Handler struct {
 	agent agent.Agent
+	runs  *runRegistry
+	// allowedOrigins are the origins allowed to open WebSocket connections
+	allowedOrigins []string
 }
 
 // NewHandler creates a new HTTP handler
 func NewHandler(a agent.Agent) *Handler {
 	return &Handler{
 		agent: a,
+		runs:  newRunRegistry(),
 	}
 }
 
@@ -51,15 +58,36 @@ func (h *Handler) Chat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Message == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "message is required")
+	if req.SessionID == "" {
+		req.SessionID = r.Header.Get(SessionIDHeader)
+	}
+	if err := validateChatRequest(req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	ctx, cancel, sessionID := newChatContext(r.Context(), w, r, req)
 	defer cancel()
+	ctx, finish, err := h.trackRun(ctx, w, sessionID)
+	if err != nil {
+		sendLimitError(w, r, err)
+		return
+	}
 
 	response, err := h.agent.Chat(ctx, req.Message, req.EnableSkills, req.EnableMCP)
+	finish(err)
+	var approval *agent.ApprovalRequiredError
+	if errors.As(err, &approval) {
+		sendJSONResponse(w, http.StatusAccepted, ChatResponse{
+			SessionID: sessionID,
+			Approval:  &approval.Request,
+		})
+		return
+	}
+	if errors.Is(err, agent.ErrSkillNotFound) || errors.Is(err, agent.ErrSkillsDisabled) {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		log.Printf("Chat error: %v", err)
 		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("chat failed: %v", err))
@@ -67,7 +95,8 @@ func (h *Handler) Chat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sendJSONResponse(w, http.StatusOK, ChatResponse{
-		Response: response,
+		SessionID: sessionID,
+		Response:  response,
 	})
 }
 
@@ -79,10 +108,7 @@ func (h *Handler) ChatStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	setSSEHeaders(w)
 
 	var req ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -90,46 +116,153 @@ func (h *Handler) ChatStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Message == "" {
-		sendSSEError(w, "message is required")
+	if req.SessionID == "" {
+		req.SessionID = r.Header.Get(SessionIDHeader)
+	}
+	if err := validateChatRequest(req); err != nil {
+		sendSSEError(w, err.Error())
+		return
+	}
+
+	// The chat keeps running when the client disconnects so it can reconnect to the run
+	ctx, cancel, sessionID := newChatContext(context.WithoutCancel(r.Context()), w, r, req)
+	h.startStream(ctx, cancel, w, r, sessionID, func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error) {
+		return h.agent.ChatStream(ctx, req.Message, req.EnableSkills, req.EnableMCP, onChunk)
+	})
+}
+
+// Approve posts the decision for tool calls waiting for approval and returns the resumed chat response
+func (h *Handler) Approve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	approver, decision, err := h.approvalDecision(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if approver == nil {
+		sendErrorResponse(w, http.StatusNotImplemented, "tool approval not supported")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
 	defer cancel()
+	ctx, finish, err := h.trackRun(ctx, w, "")
+	if err != nil {
+		sendLimitError(w, r, err)
+		return
+	}
 
-	// Flusher ensures SSE data is sent immediately
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		log.Printf("Streaming not supported")
-		sendSSEError(w, "streaming not supported")
-		return
-	}
-
-	// Stream chunks
-	chunkCount := 0
-	response, err := h.agent.ChatStream(ctx, req.Message, req.EnableSkills, req.EnableMCP,
-		func(ctx context.Context, chunk []byte) error {
-			// Send SSE event
-			chunkStr := string(chunk)
-			fmt.Fprintf(w, "data: %s\n\n", chunkStr)
-			flusher.Flush()
-			chunkCount++
-			if chunkCount <= 5 {
-				log.Printf("Sent chunk #%d: %q", chunkCount, chunkStr)
-			}
-			return nil
+	response, err := approver.Resume(ctx, r.PathValue("id"), decision, nil)
+	finish(err)
+	var approval *agent.ApprovalRequiredError
+	switch {
+	case errors.As(err, &approval):
+		sendJSONResponse(w, http.StatusAccepted, ChatResponse{
+			SessionID: approval.Request.SessionID,
+			Approval:  &approval.Request,
 		})
+	case errors.Is(err, agent.ErrApprovalNotFound):
+		sendErrorResponse(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		log.Printf("Resume error: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("chat failed: %v", err))
+	default:
+		sendJSONResponse(w, http.StatusOK, ChatResponse{Response: response})
+	}
+}
 
+// ApproveStream posts the decision for tool calls waiting for approval and streams the resumed chat using SSE
+func (h *Handler) ApproveStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	setSSEHeaders(w)
+
+	approver, decision, err := h.approvalDecision(r)
 	if err != nil {
-		log.Printf("Chat stream error: %v", err)
-		sendSSEError(w, fmt.Sprintf("chat failed: %v", err))
+		sendSSEError(w, err.Error())
+		return
+	}
+	if approver == nil {
+		sendSSEError(w, "tool approval not supported")
 		return
 	}
 
-	// Send final response
-	sendSSEEvent(w, "done", response)
-	sendSSEEvent(w, "end", "")
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 2*time.Minute)
+	h.startStream(ctx, cancel, w, r, "", func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error) {
+		return approver.Resume(ctx, r.PathValue("id"), decision, onChunk)
+	})
+}
+
+// approvalDecision decodes the approval decision, the approver is nil when the agent does not support approvals
+func (h *Handler) approvalDecision(r *http.Request) (agent.Approver, agent.ApprovalDecision, error) {
+	var req ApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, agent.ApprovalDecision{}, fmt.Errorf("invalid request body: %v", err)
+	}
+	if r.PathValue("id") == "" {
+		return nil, agent.ApprovalDecision{}, errors.New("approval id is required")
+	}
+	approver, _ := h.agent.(agent.Approver)
+	return approver, agent.ApprovalDecision{Approved: req.Approved, Reason: req.Reason}, nil
+}
+
+// validateChatRequest checks the required fields of a chat request
+func validateChatRequest(req ChatRequest) error {
+	if req.Message == "" {
+		return errors.New("message is required")
+	}
+	if err := agent.ValidateSessionID(req.SessionID); err != nil {
+		return err
+	}
+	if req.SystemPrompt != "" {
+		if err := agent.ValidatePromptOverride(req.SystemPrompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newChatContext derives the context of a chat request from parent carrying the session and prompt settings
+func newChatContext(parent context.Context, w http.ResponseWriter, r *http.Request, req ChatRequest) (context.Context, context.CancelFunc, string) {
+	sessionID := resolveSessionID(w, r, req.SessionID)
+	ctx := agent.WithSessionID(parent, sessionID)
+	ctx = agent.WithSessionPrompt(ctx, agent.SessionPrompt{
+		SystemPrompt: req.SystemPrompt,
+		UserName:     req.UserName,
+		Locale:       req.Locale,
+	})
+	if req.Skill != "" {
+		ctx = agent.WithSkillName(ctx, req.Skill)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	return ctx, cancel, sessionID
+}
+
+// resolveSessionID picks the session ID from the request body or the X-Session-ID header,
+// generating a new one when the client did not provide any. The ID is echoed back in the
+// X-Session-ID response header so the client can continue the conversation.
+func resolveSessionID(w http.ResponseWriter, r *http.Request, sessionID string) string {
+	if sessionID == "" {
+		sessionID = r.Header.Get(SessionIDHeader)
+	}
+	if sessionID == "" {
+		sessionID = newSessionID()
+	}
+	w.Header().Set(SessionIDHeader, sessionID)
+	return sessionID
+}
+
+// newSessionID generates a random session ID
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 // sendJSONResponse sends a JSON response
@@ -150,15 +283,9 @@ func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 	})
 }
 
-// sendSSEEvent sends an SSE event
-func sendSSEEvent(w http.ResponseWriter, event string, data string) {
-	fmt.Fprintf(w, "event: %s\n", event)
-	fmt.Fprintf(w, "data: %s\n\n", data)
-}
-
 // sendSSEError sends an error via SSE
 func sendSSEError(w http.ResponseWriter, message string) {
-	sendSSEEvent(w, "error", message)
+	writeSSEEvent(w, StreamEvent{Event: agent.Event{Type: agent.EventError, Error: message}})
 }
 
 // StreamReader wraps an io.Reader for SSE streaming
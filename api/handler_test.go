@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -18,9 +19,14 @@ type mockAgent struct {
 	streamChunks    []string
 	streamError     error
 	chunksSentCount int
+	lastSessionID   string
+	lastCtx         context.Context
+	events          []agent.Event
 }
 
 func (m *mockAgent) Chat(ctx context.Context, message string, enableSkills bool, enableMCP bool) (string, error) {
+	m.lastSessionID = agent.SessionIDFromContext(ctx)
+	m.lastCtx = ctx
 	if m.chatError != nil {
 		return "", m.chatError
 	}
@@ -28,10 +34,14 @@ func (m *mockAgent) Chat(ctx context.Context, message string, enableSkills bool,
 }
 
 func (m *mockAgent) ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error) {
+	m.lastSessionID = agent.SessionIDFromContext(ctx)
 	if m.streamError != nil {
 		return "", m.streamError
 	}
 
+	for _, event := range m.events {
+		agent.EmitEvent(ctx, event)
+	}
 	for _, chunk := range m.streamChunks {
 		if err := onChunk(ctx, []byte(chunk)); err != nil {
 			return "", err
@@ -103,12 +113,42 @@ func TestChat(t *testing.T) {
 			requestBody:  `{invalid json}`,
 			expectedCode: http.StatusBadRequest,
 		},
+		{
+			name:         "invalid system prompt",
+			agent:        &mockAgent{},
+			requestBody:  `{"message": "test", "systemPrompt": "{{.Date"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "session id with slash",
+			agent:        &mockAgent{},
+			requestBody:  `{"message": "test", "sessionId": "tenant/s1"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "system prompt with a loop",
+			agent:        &mockAgent{},
+			requestBody:  `{"message": "test", "systemPrompt": "{{range 1000000000}}x{{end}}"}`,
+			expectedCode: http.StatusBadRequest,
+		},
 		{
 			name:         "agent error",
 			agent:        &mockAgent{chatError: context.DeadlineExceeded},
 			requestBody:  `{"message": "test"}`,
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "unknown skill",
+			agent:        &mockAgent{chatError: fmt.Errorf("%w: 'missing'", agent.ErrSkillNotFound)},
+			requestBody:  `{"message": "test", "skill": "missing"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "skill with skills disabled",
+			agent:        &mockAgent{chatError: fmt.Errorf("%w: 'greeter'", agent.ErrSkillsDisabled)},
+			requestBody:  `{"message": "test", "skill": "greeter"}`,
+			expectedCode: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -131,6 +171,60 @@ func TestChat(t *testing.T) {
 	}
 }
 
+func TestChatSessionID(t *testing.T) {
+	mock := &mockAgent{chatResponse: "ok"}
+	handler := NewHandler(mock)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message": "hi", "sessionId": "s1"}`))
+	w := httptest.NewRecorder()
+	handler.Chat(w, req)
+
+	if mock.lastSessionID != "s1" {
+		t.Errorf("Expected session 's1' to reach the agent, got '%s'", mock.lastSessionID)
+	}
+	var resp ChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.SessionID != "s1" {
+		t.Errorf("Expected session 's1' in response, got '%s'", resp.SessionID)
+	}
+
+	// Header is used when the body has no session, and a new ID is generated when neither is set
+	req = httptest.NewRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(`{"message": "hi"}`))
+	req.Header.Set(SessionIDHeader, "s2")
+	w = httptest.NewRecorder()
+	handler.ChatStream(w, req)
+	if mock.lastSessionID != "s2" {
+		t.Errorf("Expected session 's2' from header, got '%s'", mock.lastSessionID)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message": "hi"}`))
+	w = httptest.NewRecorder()
+	handler.Chat(w, req)
+	generated := w.Header().Get(SessionIDHeader)
+	if generated == "" || mock.lastSessionID != generated {
+		t.Errorf("Expected generated session ID to be echoed, got header '%s' agent '%s'", generated, mock.lastSessionID)
+	}
+}
+
+func TestChatSkill(t *testing.T) {
+	mock := &mockAgent{chatResponse: "ok"}
+	handler := NewHandler(mock)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message": "hi", "skill": "greeter"}`))
+	handler.Chat(httptest.NewRecorder(), req)
+	if skill := agent.SkillNameFromContext(mock.lastCtx); skill != "greeter" {
+		t.Errorf("Expected skill 'greeter' to reach the agent, got '%s'", skill)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message": "hi"}`))
+	handler.Chat(httptest.NewRecorder(), req)
+	if skill := agent.SkillNameFromContext(mock.lastCtx); skill != "" {
+		t.Errorf("Expected no skill, got '%s'", skill)
+	}
+}
+
 func TestChatStream(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -146,8 +240,8 @@ func TestChatStream(t *testing.T) {
 			requestBody: `{"message": "Hello"}`,
 			checkResp: func(t *testing.T, w *httptest.ResponseRecorder) {
 				body := w.Body.String()
-				if !strings.Contains(body, "data: Hello") {
-					t.Errorf("Expected 'data: Hello' in response, got: %s", body)
+				if !strings.Contains(body, "event: token\ndata: {\"type\":\"token\",\"content\":\"Hello\"}") {
+					t.Errorf("Expected token event in response, got: %s", body)
 				}
 				if !strings.Contains(body, "event: done") {
 					t.Errorf("Expected 'event: done' in response, got: %s", body)
@@ -157,6 +251,38 @@ func TestChatStream(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "agent events",
+			agent: &mockAgent{
+				events: []agent.Event{
+					{Type: agent.EventToolCallStart, ToolCallID: "call_1", ToolName: "search"},
+					{Type: agent.EventToolResult, ToolCallID: "call_1", ToolName: "search", Result: "line 1\nline 2"},
+				},
+				streamChunks: []string{"multi\nline"},
+			},
+			requestBody: `{"message": "Hello"}`,
+			checkResp: func(t *testing.T, w *httptest.ResponseRecorder) {
+				events := parseSSE(t, w.Body.String())
+				wantTypes := []string{"tool_call_start", "tool_result", "token", "done", "end"}
+				if len(events) != len(wantTypes) {
+					t.Fatalf("Expected %d events, got %d: %s", len(wantTypes), len(events), w.Body.String())
+				}
+				for i, want := range wantTypes {
+					if events[i].name != want || string(events[i].data.Type) != want {
+						t.Errorf("Event %d: expected %s, got %s (%s)", i, want, events[i].name, events[i].data.Type)
+					}
+					if events[i].id != fmt.Sprint(i+1) {
+						t.Errorf("Event %d: expected id %d, got %s", i, i+1, events[i].id)
+					}
+				}
+				if events[1].data.Result != "line 1\nline 2" || events[1].data.ToolName != "search" {
+					t.Errorf("Unexpected tool result event: %+v", events[1].data)
+				}
+				if events[2].data.Content != "multi\nline" {
+					t.Errorf("Unexpected token event: %+v", events[2].data)
+				}
+			},
+		},
 		{
 			name:        "empty message",
 			agent:       &mockAgent{},
@@ -186,6 +312,37 @@ func TestChatStream(t *testing.T) {
 	}
 }
 
+// sseEvent is a parsed SSE event
+type sseEvent struct {
+	id   string
+	name string
+	data StreamEvent
+}
+
+// parseSSE parses the events of an SSE stream
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var ev sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "id":
+				ev.id = value
+			case "event":
+				ev.name = value
+			case "data":
+				if err := json.Unmarshal([]byte(value), &ev.data); err != nil {
+					t.Fatalf("Invalid event data %q: %v", value, err)
+				}
+			}
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
 func TestMethodNotAllowed(t *testing.T) {
 	handler := NewHandler(&mockAgent{})
 
@@ -198,6 +355,7 @@ func TestMethodNotAllowed(t *testing.T) {
 		{"health with POST", http.MethodPost, "/health", handler.HealthCheck},
 		{"chat with GET", http.MethodGet, "/api/chat", handler.Chat},
 		{"stream with GET", http.MethodGet, "/api/chat/stream", handler.ChatStream},
+		{"approve with GET", http.MethodGet, "/api/approvals/a1", handler.Approve},
 	}
 
 	for _, tt := range tests {
@@ -213,3 +371,97 @@ func TestMethodNotAllowed(t *testing.T) {
 		})
 	}
 }
+
+// mockApprover is a mock agent pausing for tool approval
+type mockApprover struct {
+	mockAgent
+	decision agent.ApprovalDecision
+}
+
+func (m *mockApprover) Chat(ctx context.Context, message string, enableSkills bool, enableMCP bool) (string, error) {
+	return "", &agent.ApprovalRequiredError{Request: agent.ApprovalRequest{
+		ID:        "a1",
+		SessionID: agent.SessionIDFromContext(ctx),
+		ToolCalls: []agent.ApprovalToolCall{{ID: "call_1", Name: "run_shell_code", Arguments: `{"code":"ls"}`}},
+	}}
+}
+
+func (m *mockApprover) ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error) {
+	return m.Chat(ctx, message, enableSkills, enableMCP)
+}
+
+func (m *mockApprover) Resume(ctx context.Context, approvalID string, decision agent.ApprovalDecision, onChunk func(context.Context, []byte) error) (string, error) {
+	if approvalID != "a1" {
+		return "", fmt.Errorf("%w: %s", agent.ErrApprovalNotFound, approvalID)
+	}
+	m.decision = decision
+	if onChunk != nil {
+		_ = onChunk(ctx, []byte("resumed"))
+	}
+	return "resumed", nil
+}
+
+func TestApproval(t *testing.T) {
+	approver := &mockApprover{}
+	handler := NewHandler(approver)
+
+	// The chat pauses and returns the approval request
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message": "list files", "sessionId": "s1"}`))
+	w := httptest.NewRecorder()
+	handler.Chat(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+	var resp ChatResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Approval == nil || resp.Approval.ID != "a1" || resp.Approval.SessionID != "s1" {
+		t.Fatalf("Unexpected approval: %+v", resp.Approval)
+	}
+
+	// The streaming chat emits an approval_required event
+	req = httptest.NewRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(`{"message": "list files"}`))
+	w = httptest.NewRecorder()
+	handler.ChatStream(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "event: approval_required") || !strings.Contains(body, `"toolCalls"`) {
+		t.Errorf("Expected approval_required event, got: %s", body)
+	}
+
+	// Posting the decision resumes the chat
+	req = httptest.NewRequest(http.MethodPost, "/api/approvals/a1", strings.NewReader(`{"approved": false, "reason": "no"}`))
+	req.SetPathValue("id", "a1")
+	w = httptest.NewRecorder()
+	handler.Approve(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "resumed") {
+		t.Errorf("Expected resumed response, got %d: %s", w.Code, w.Body.String())
+	}
+	if approver.decision.Approved || approver.decision.Reason != "no" {
+		t.Errorf("Unexpected decision: %+v", approver.decision)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/approvals/a1/stream", strings.NewReader(`{"approved": true}`))
+	req.SetPathValue("id", "a1")
+	w = httptest.NewRecorder()
+	handler.ApproveStream(w, req)
+	if body := w.Body.String(); !strings.Contains(body, `"content":"resumed"`) || !strings.Contains(body, "event: done") {
+		t.Errorf("Expected resumed stream, got: %s", body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/approvals/unknown", strings.NewReader(`{"approved": true}`))
+	req.SetPathValue("id", "unknown")
+	w = httptest.NewRecorder()
+	handler.Approve(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	// Agents without approval support
+	req = httptest.NewRequest(http.MethodPost, "/api/approvals/a1", strings.NewReader(`{"approved": true}`))
+	req.SetPathValue("id", "a1")
+	w = httptest.NewRecorder()
+	NewHandler(&mockAgent{}).Approve(w, req)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
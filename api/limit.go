@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LimitConfig configures the rate limits and quotas of the API, zero values disable a limit
+type LimitConfig struct {
+	// RequestsPerSecond and Burst configure the token bucket of each authenticated subject of a tenant or client IP,
+	// every WebSocket chat or approval turn takes a token too
+	RequestsPerSecond float64
+	Burst             int
+	// MaxConcurrentRuns caps the chat runs of a tenant running at the same time
+	MaxConcurrentRuns int
+	// QueueTimeout is how long a chat waits for a free run slot of its tenant before it is rejected
+	QueueTimeout time.Duration
+	// DailyTokens is the LLM token quota of a tenant per UTC day, counted from the usage reported by the model
+	DailyTokens int
+}
+
+// maxBuckets is the number of rate limit buckets kept before the full ones are dropped
+const maxBuckets = 10000
+
+// LimitError is returned when a request exceeds a limit, it is sent as 429 with a Retry-After header
+type LimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Reason, e.RetryAfter)
+}
+
+// bucket is a token bucket of the rate limiter
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// dailyUsage is the token usage of a tenant on a day
+type dailyUsage struct {
+	day    string
+	tokens int
+}
+
+// limiter enforces the rate limits, run slots and token quotas
+type limiter struct {
+	cfg LimitConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	slots   map[string]chan struct{}
+	usage   map[string]*dailyUsage
+}
+
+func newLimiter(cfg LimitConfig) *limiter {
+	return &limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		slots:   make(map[string]chan struct{}),
+		usage:   make(map[string]*dailyUsage),
+	}
+}
+
+// allow takes a token from the bucket of key, returning a LimitError when the bucket is empty
+func (l *limiter) allow(key string) error {
+	if l == nil || l.cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(max(l.cfg.Burst, 1))
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.dropFullBuckets(now, burst)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.cfg.RequestsPerSecond)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.cfg.RequestsPerSecond * float64(time.Second))
+		return &LimitError{Reason: "rate limit exceeded", RetryAfter: wait}
+	}
+	b.tokens--
+	return nil
+}
+
+// dropFullBuckets removes the buckets refilled to the burst, the caller holds l.mu
+func (l *limiter) dropFullBuckets(now time.Time, burst float64) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.cfg.RequestsPerSecond >= burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// acquire checks the token quota of tenant and takes one of its run slots, waiting up to the queue timeout.
+// The returned release func frees the slot.
+func (l *limiter) acquire(ctx context.Context, tenant string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if err := l.checkQuota(tenant); err != nil {
+		return nil, err
+	}
+	if l.cfg.MaxConcurrentRuns <= 0 {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	slots, ok := l.slots[tenant]
+	if !ok {
+		slots = make(chan struct{}, l.cfg.MaxConcurrentRuns)
+		l.slots[tenant] = slots
+	}
+	l.mu.Unlock()
+
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	busy := &LimitError{Reason: "too many concurrent runs", RetryAfter: max(l.cfg.QueueTimeout, time.Second)}
+	if l.cfg.QueueTimeout <= 0 {
+		return nil, busy
+	}
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, busy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// checkQuota returns a LimitError when tenant used its daily tokens
+func (l *limiter) checkQuota(tenant string) error {
+	if l.cfg.DailyTokens <= 0 {
+		return nil
+	}
+	now := l.now().UTC()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if u, ok := l.usage[tenant]; ok && u.day == now.Format(time.DateOnly) && u.tokens >= l.cfg.DailyTokens {
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return &LimitError{Reason: "daily token quota exceeded", RetryAfter: midnight.Sub(now)}
+	}
+	return nil
+}
+
+// addUsage counts tokens used by tenant today
+func (l *limiter) addUsage(tenant string, tokens int) {
+	if l == nil || l.cfg.DailyTokens <= 0 || tokens <= 0 {
+		return
+	}
+	day := l.now().UTC().Format(time.DateOnly)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u, ok := l.usage[tenant]
+	if !ok || u.day != day {
+		u = &dailyUsage{day: day}
+		l.usage[tenant] = u
+	}
+	u.tokens += tokens
+}
+
+// rateLimitMiddleware limits the requests of each API key or client IP, the health check is not limited
+func rateLimitMiddleware(l *limiter, next http.Handler) http.Handler {
+	if l == nil || l.cfg.RequestsPerSecond <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := l.allow(rateLimitKey(r)); err != nil {
+			sendLimitError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey returns the tenant and subject of the request, the tenant alone when the identity has no subject,
+// or the client IP for anonymous requests
+func rateLimitKey(r *http.Request) string {
+	if id := IdentityFromContext(r.Context()); id != nil && id.Subject != "" {
+		return "id:" + id.tenant() + "/" + id.Subject
+	}
+	if id := IdentityFromContext(r.Context()); id != nil && id.tenant() != "" {
+		return "tenant:" + id.tenant()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// sendLimitError sends 429 with a Retry-After header for a LimitError, other errors are sent as 503
+func sendLimitError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusServiceUnavailable
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+	}
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		sendOpenAIError(w, status, err.Error())
+		return
+	}
+	sendErrorResponse(w, status, err.Error())
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/agent"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newLimiter(LimitConfig{RequestsPerSecond: 1, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := l.allow("k"); err != nil {
+			t.Fatalf("Request %d: expected to be allowed, got %v", i, err)
+		}
+	}
+	var limitErr *LimitError
+	if err := l.allow("k"); !errors.As(err, &limitErr) || limitErr.RetryAfter != time.Second {
+		t.Fatalf("Expected LimitError with 1s retry, got %v", err)
+	}
+	if err := l.allow("other"); err != nil {
+		t.Errorf("Expected another key to have its own bucket, got %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := l.allow("k"); err != nil {
+		t.Errorf("Expected the bucket to refill, got %v", err)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		name string
+		id   *Identity
+		want string
+	}{
+		{"anonymous", nil, "ip:192.0.2.1"},
+		{"subject", &Identity{Subject: "alice"}, "id:alice/alice"},
+		{"tenant subject", &Identity{Subject: "alice", Tenant: "acme"}, "id:acme/alice"},
+		{"tenant only", &Identity{Tenant: "acme"}, "tenant:acme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/chat", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tt.id != nil {
+				r = r.WithContext(context.WithValue(r.Context(), identityKey{}, tt.id))
+			}
+			if got := rateLimitKey(r); got != tt.want {
+				t.Errorf("Expected key '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLimiterConcurrentRuns(t *testing.T) {
+	l := newLimiter(LimitConfig{MaxConcurrentRuns: 1})
+	release, err := l.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(context.Background(), "a"); err == nil {
+		t.Fatal("Expected the second run of tenant a to be rejected")
+	}
+	releaseB, err := l.acquire(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("Expected tenant b to have its own slots, got %v", err)
+	}
+	releaseB()
+
+	// A queued run gets the slot when it is released
+	l.cfg.QueueTimeout = time.Second
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		release()
+	}()
+	if _, err := l.acquire(context.Background(), "a"); err != nil {
+		t.Errorf("Expected the queued run to start, got %v", err)
+	}
+}
+
+func TestLimiterDailyTokens(t *testing.T) {
+	now := time.Date(2026, 1, 2, 23, 0, 0, 0, time.UTC)
+	l := newLimiter(LimitConfig{DailyTokens: 100})
+	l.now = func() time.Time { return now }
+
+	l.addUsage("a", 60)
+	if err := l.checkQuota("a"); err != nil {
+		t.Fatalf("Expected tenant a within quota, got %v", err)
+	}
+	l.addUsage("a", 60)
+	var limitErr *LimitError
+	if err := l.checkQuota("a"); !errors.As(err, &limitErr) || limitErr.RetryAfter != time.Hour {
+		t.Fatalf("Expected quota error until midnight, got %v", err)
+	}
+	if err := l.checkQuota("b"); err != nil {
+		t.Errorf("Expected tenant b within quota, got %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if err := l.checkQuota("a"); err != nil {
+		t.Errorf("Expected the quota to reset the next day, got %v", err)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits LimitConfig
+		agent  agent.Agent
+		path   string
+	}{
+		{"rate limit", LimitConfig{RequestsPerSecond: 0.01, Burst: 1}, &mockAgent{chatResponse: "ok"}, "/api/chat"},
+		{"daily tokens", LimitConfig{DailyTokens: 10}, &mockAgent{
+			streamChunks: []string{"ok"},
+			events:       []agent.Event{{Type: agent.EventUsage, Usage: &agent.Usage{TotalTokens: 20}}},
+		}, "/api/chat/stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewServer(tt.agent, ServerConfig{Limits: tt.limits}).httpServer.Handler
+			post := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"message": "Hello"}`))
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				return w
+			}
+			if w := post(); w.Code != http.StatusOK {
+				t.Fatalf("Expected the first request to pass, got %d: %s", w.Code, w.Body.String())
+			}
+			w := post()
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("Expected status 429, got %d", w.Code)
+			}
+			if w.Header().Get("Retry-After") == "" {
+				t.Error("Expected a Retry-After header")
+			}
+		})
+	}
+}
+
+func TestServerConcurrentRuns(t *testing.T) {
+	a := &toolAgent{started: make(chan struct{})}
+	server := httptest.NewServer(NewServer(a, ServerConfig{Limits: LimitConfig{MaxConcurrentRuns: 1}}).httpServer.Handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/chat", strings.NewReader(`{"message": "Hello"}`))
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-a.started
+
+	resp, err := http.Post(server.URL+"/api/chat", "application/json", strings.NewReader(`{"message": "Hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("Expected status 429 with Retry-After 1, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
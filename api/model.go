@@ -1,16 +1,55 @@
 package api
 
+import "github.com/kinwyb/langchat/llm/agent"
+
 // ChatRequest represents a chat request
 type ChatRequest struct {
+	SessionID    string `json:"sessionId,omitempty"`
 	Message      string `json:"message"`
 	EnableSkills bool   `json:"enableSkills"`
 	EnableMCP    bool   `json:"enableMCP"`
+	// Skill runs the message with the named skill instead of selecting one, as the "/skill message" command does.
+	// It requires EnableSkills.
+	Skill string `json:"skill,omitempty"`
+	// SystemPrompt overrides the system prompt (persona) for the session, variables such as {{.UserName}} are supported
+	SystemPrompt string `json:"systemPrompt,omitempty"`
+	UserName     string `json:"userName,omitempty"`
+	Locale       string `json:"locale,omitempty"`
 }
 
 // ChatResponse represents a chat response
 type ChatResponse struct {
-	Response string `json:"response"`
-	Error    string `json:"error,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	Response  string `json:"response"`
+	Error     string `json:"error,omitempty"`
+	// Approval is set when tool calls wait for approval, the decision is posted to /api/approvals/{id}
+	Approval *agent.ApprovalRequest `json:"approval,omitempty"`
+}
+
+// ApprovalRequest represents the decision for tool calls waiting for approval
+type ApprovalRequest struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Stream events sent by the API in addition to the agent events (see agent.EventType)
+const (
+	// StreamEventDone carries the full response in Content
+	StreamEventDone agent.EventType = "done"
+	// StreamEventEnd is the last event of a stream
+	StreamEventEnd agent.EventType = "end"
+	// StreamEventApprovalRequired carries the tool calls waiting for approval in Approval
+	StreamEventApprovalRequired agent.EventType = "approval_required"
+	// StreamEventCanceled is sent when the client canceled the chat
+	StreamEventCanceled agent.EventType = "canceled"
+	// StreamEventSession carries the session ID of a WebSocket connection in Content
+	StreamEventSession agent.EventType = "session"
+)
+
+// StreamEvent is the JSON data of a streaming chat SSE event, the SSE event name is its type
+type StreamEvent struct {
+	agent.Event
+	Approval *agent.ApprovalRequest `json:"approval,omitempty"`
 }
 
 // ErrorResponse represents an error response
@@ -24,3 +63,6 @@ type HealthResponse struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
 }
+
+// SessionIDHeader carries the conversation session ID on requests and responses
+const SessionIDHeader = "X-Session-ID"
@@ -0,0 +1,489 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/agent"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// OpenAIModel is the model name served by the OpenAI compatible API.
+// Skills and MCP tools are enabled with the "+skills" and "+mcp" suffixes, e.g. "langchat+skills+mcp".
+const OpenAIModel = "langchat"
+
+// finishReasonApprovalRequired is the finish reason of a completion paused for tool approval
+const finishReasonApprovalRequired = "approval_required"
+
+// ChatCompletionRequest is an OpenAI chat completion request.
+// Client defined tools are not supported, the agent runs its own skills and MCP tools on the server:
+// a request with tools is rejected, a tool_choice of "none" disables the server tools and "auto" keeps them.
+// System and developer messages are used as plain text, they are not rendered as templates.
+type ChatCompletionRequest struct {
+	Model               string                  `json:"model"`
+	Messages            []ChatCompletionMessage `json:"messages"`
+	Stream              bool                    `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions          `json:"stream_options,omitempty"`
+	Tools               []json.RawMessage       `json:"tools,omitempty"`
+	ToolChoice          json.RawMessage         `json:"tool_choice,omitempty"`
+	Temperature         *float64                `json:"temperature,omitempty"`
+	TopP                *float64                `json:"top_p,omitempty"`
+	MaxTokens           *int                    `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                    `json:"max_completion_tokens,omitempty"`
+	Stop                json.RawMessage         `json:"stop,omitempty"`
+	User                string                  `json:"user,omitempty"`
+
+	// SessionID keeps the conversation on the server, only the last user message is used then.
+	// Without it the request is stateless and the messages are the whole conversation.
+	SessionID string `json:"session_id,omitempty"`
+	// EnableSkills and EnableMCP override the features selected by the model name
+	EnableSkills *bool `json:"enable_skills,omitempty"`
+	EnableMCP    *bool `json:"enable_mcp,omitempty"`
+}
+
+// StreamOptions are the options of a streaming chat completion
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatCompletionMessage is a message of the OpenAI chat API
+type ChatCompletionMessage struct {
+	Role       string                   `json:"role"`
+	Content    ChatCompletionContent    `json:"content"`
+	Name       string                   `json:"name,omitempty"`
+	ToolCalls  []ChatCompletionToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string                   `json:"tool_call_id,omitempty"`
+}
+
+// ChatCompletionContent is the text content of a message, it is decoded from a string or an array of text parts
+type ChatCompletionContent string
+
+func (c *ChatCompletionContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*c = ""
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = ChatCompletionContent(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of parts: %w", err)
+	}
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.Type != "text" {
+			return fmt.Errorf("unsupported content part type '%s'", part.Type)
+		}
+		sb.WriteString(part.Text)
+	}
+	*c = ChatCompletionContent(sb.String())
+	return nil
+}
+
+// ChatCompletionToolCall is a tool call of an assistant message
+type ChatCompletionToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// ChatCompletionResponse is an OpenAI chat completion or, with object chat.completion.chunk, a streamed chunk
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *ChatCompletionUsage   `json:"usage,omitempty"`
+	// SessionID is the server side session of the conversation
+	SessionID string `json:"session_id,omitempty"`
+	// Approval is set when tool calls wait for approval, the decision is posted to /api/approvals/{id}
+	Approval *agent.ApprovalRequest `json:"approval,omitempty"`
+}
+
+// ChatCompletionChoice is a choice of a completion, Message is set for completions and Delta for chunks
+type ChatCompletionChoice struct {
+	Index        int                    `json:"index"`
+	Message      *ChatCompletionMessage `json:"message,omitempty"`
+	Delta        *ChatCompletionDelta   `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+// ChatCompletionDelta is the message delta of a chunk
+type ChatCompletionDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ChatCompletionUsage is the token usage of a completion
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// OpenAIError is the error body of the OpenAI API
+type OpenAIError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// ModelList is the response of /v1/models
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+// Model is a model served by the OpenAI compatible API
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// sessionDeleter is implemented by agents that can drop a session, e.g. agent.TextChatAgent
+type sessionDeleter interface {
+	DeleteSession(ctx context.Context, sessionID string) error
+}
+
+// Models lists the models of the OpenAI compatible API
+func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	list := ModelList{Object: "list"}
+	for _, id := range []string{OpenAIModel, OpenAIModel + "+skills", OpenAIModel + "+mcp", OpenAIModel + "+skills+mcp"} {
+		list.Data = append(list.Data, Model{ID: id, Object: "model", OwnedBy: "langchat"})
+	}
+	sendJSONResponse(w, http.StatusOK, list)
+}
+
+// ChatCompletions handles OpenAI compatible chat completion requests, returning a chat.completion
+// or streaming chat.completion.chunk events terminated by [DONE]
+func (h *Handler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendOpenAIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendOpenAIError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	message, history, systemPrompt, err := req.conversation()
+	if err != nil {
+		sendOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(systemPrompt) > agent.MaxPromptOverrideSize {
+		sendOpenAIError(w, http.StatusBadRequest, fmt.Sprintf("system messages are longer than %d bytes", agent.MaxPromptOverrideSize))
+		return
+	}
+	if err := req.checkTools(); err != nil {
+		sendOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	enableSkills, enableMCP := req.features()
+
+	ctx := r.Context()
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = r.Header.Get(SessionIDHeader)
+	}
+	if err := agent.ValidateSessionID(sessionID); err != nil {
+		sendOpenAIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if sessionID == "" {
+		// Stateless request, the session only lives for this completion so tool calls cannot wait for approval
+		sessionID = "chatcmpl-" + newSessionID()
+		ctx = agent.WithHistory(ctx, history)
+		ctx = agent.WithoutApproval(ctx)
+		if deleter, ok := h.agent.(sessionDeleter); ok {
+			defer func() {
+				if err := deleter.DeleteSession(context.WithoutCancel(ctx), sessionID); err != nil {
+					log.Printf("Failed to delete session '%s': %v", sessionID, err)
+				}
+			}()
+		}
+	} else {
+		w.Header().Set(SessionIDHeader, sessionID)
+	}
+	ctx = agent.WithSessionID(ctx, sessionID)
+	ctx = agent.WithSessionPrompt(ctx, agent.SessionPrompt{SystemPrompt: systemPrompt, Literal: true})
+	ctx = agent.WithCallOptions(ctx, req.callOptions()...)
+
+	// Sum the token usage of all model calls
+	var (
+		usageMu sync.Mutex
+		usage   ChatCompletionUsage
+	)
+	ctx = agent.WithEventHandler(ctx, func(_ context.Context, event agent.Event) {
+		if event.Type != agent.EventUsage || event.Usage == nil {
+			return
+		}
+		usageMu.Lock()
+		defer usageMu.Unlock()
+		usage.PromptTokens += event.Usage.PromptTokens
+		usage.CompletionTokens += event.Usage.CompletionTokens
+		usage.TotalTokens += event.Usage.TotalTokens
+	})
+	totalUsage := func() *ChatCompletionUsage {
+		usageMu.Lock()
+		defer usageMu.Unlock()
+		total := usage
+		return &total
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	ctx, finish, err := h.trackRun(ctx, w, sessionID)
+	if err != nil {
+		sendLimitError(w, r, err)
+		return
+	}
+
+	completion := ChatCompletionResponse{
+		ID:      "chatcmpl-" + newSessionID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+	}
+	if completion.Model == "" {
+		completion.Model = OpenAIModel
+	}
+	if req.SessionID != "" || r.Header.Get(SessionIDHeader) != "" {
+		completion.SessionID = sessionID
+	}
+
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		finish(streamChatCompletion(ctx, w, completion, includeUsage, totalUsage, func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error) {
+			return h.agent.ChatStream(ctx, message, enableSkills, enableMCP, onChunk)
+		}))
+		return
+	}
+
+	response, err := h.agent.Chat(ctx, message, enableSkills, enableMCP)
+	finish(err)
+	finishReason := "stop"
+	var approval *agent.ApprovalRequiredError
+	switch {
+	case errors.As(err, &approval):
+		finishReason = finishReasonApprovalRequired
+		completion.Approval = &approval.Request
+	case err != nil:
+		log.Printf("Chat completion error: %v", err)
+		sendOpenAIError(w, http.StatusInternalServerError, fmt.Sprintf("chat failed: %v", err))
+		return
+	}
+	completion.Choices = []ChatCompletionChoice{{
+		Message:      &ChatCompletionMessage{Role: "assistant", Content: ChatCompletionContent(response)},
+		FinishReason: &finishReason,
+	}}
+	completion.Usage = totalUsage()
+	sendJSONResponse(w, http.StatusOK, completion)
+}
+
+// streamChatCompletion streams the answer of call as chat.completion.chunk events and returns the error of call
+func streamChatCompletion(ctx context.Context, w http.ResponseWriter, completion ChatCompletionResponse, includeUsage bool, usage func() *ChatCompletionUsage, call func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error)) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendOpenAIError(w, http.StatusInternalServerError, "streaming not supported")
+		return errors.New("streaming not supported")
+	}
+	setSSEHeaders(w)
+
+	completion.Object = "chat.completion.chunk"
+	send := func(chunk ChatCompletionResponse) {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			log.Printf("Failed to encode chunk: %v", err)
+			return
+		}
+		writeSSE(w, 0, "", data)
+		flusher.Flush()
+	}
+	delta := func(delta ChatCompletionDelta, finishReason *string) ChatCompletionResponse {
+		chunk := completion
+		chunk.Choices = []ChatCompletionChoice{{Delta: &delta, FinishReason: finishReason}}
+		return chunk
+	}
+
+	send(delta(ChatCompletionDelta{Role: "assistant"}, nil))
+	_, err := call(ctx, func(_ context.Context, chunk []byte) error {
+		send(delta(ChatCompletionDelta{Content: string(chunk)}, nil))
+		return nil
+	})
+
+	finishReason := "stop"
+	var approval *agent.ApprovalRequiredError
+	switch {
+	case errors.As(err, &approval):
+		finishReason = finishReasonApprovalRequired
+	case err != nil:
+		log.Printf("Chat completion stream error: %v", err)
+		var body OpenAIError
+		body.Error.Message = fmt.Sprintf("chat failed: %v", err)
+		body.Error.Type = "server_error"
+		data, _ := json.Marshal(body)
+		writeSSE(w, 0, "", data)
+		flusher.Flush()
+		return err
+	}
+	last := delta(ChatCompletionDelta{}, &finishReason)
+	if approval != nil {
+		last.Approval = &approval.Request
+	}
+	send(last)
+	if includeUsage {
+		chunk := completion
+		chunk.Choices = []ChatCompletionChoice{}
+		chunk.Usage = usage()
+		send(chunk)
+	}
+	writeSSE(w, 0, "", []byte("[DONE]"))
+	flusher.Flush()
+	return err
+}
+
+// conversation splits the messages into the last user message, the prior messages and the system prompt
+func (req ChatCompletionRequest) conversation() (string, []llms.MessageContent, string, error) {
+	if len(req.Messages) == 0 {
+		return "", nil, "", errors.New("messages are required")
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "user" || last.Content == "" {
+		return "", nil, "", errors.New("the last message must be a non-empty user message")
+	}
+
+	var system []string
+	var history []llms.MessageContent
+	for _, msg := range req.Messages[:len(req.Messages)-1] {
+		switch msg.Role {
+		case "system", "developer":
+			system = append(system, string(msg.Content))
+		case "user":
+			history = append(history, llms.TextParts(llms.ChatMessageTypeHuman, string(msg.Content)))
+		case "assistant":
+			m := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+			if msg.Content != "" {
+				m.Parts = append(m.Parts, llms.TextPart(string(msg.Content)))
+			}
+			for _, tc := range msg.ToolCalls {
+				m.Parts = append(m.Parts, llms.ToolCall{
+					ID:           tc.ID,
+					Type:         "function",
+					FunctionCall: &llms.FunctionCall{Name: tc.Function.Name, Arguments: tc.Function.Arguments},
+				})
+			}
+			history = append(history, m)
+		case "tool":
+			history = append(history, llms.MessageContent{
+				Role:  llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: msg.ToolCallID, Name: msg.Name, Content: string(msg.Content)}},
+			})
+		default:
+			return "", nil, "", fmt.Errorf("unsupported message role '%s'", msg.Role)
+		}
+	}
+	return string(last.Content), history, strings.Join(system, "\n\n"), nil
+}
+
+// checkTools rejects client defined tools, only a tool_choice of "none" or "auto" is accepted
+func (req ChatCompletionRequest) checkTools() error {
+	if len(req.Tools) > 0 {
+		return errors.New("client defined tools are not supported, the server runs its own skills and MCP tools")
+	}
+	if len(req.ToolChoice) == 0 || string(req.ToolChoice) == "null" {
+		return nil
+	}
+	var toolChoice string
+	if json.Unmarshal(req.ToolChoice, &toolChoice) != nil || (toolChoice != "none" && toolChoice != "auto") {
+		return fmt.Errorf("unsupported tool_choice %s, only \"none\" and \"auto\" are accepted", req.ToolChoice)
+	}
+	return nil
+}
+
+// features returns whether skills and MCP tools are enabled by the model name and the extension fields
+func (req ChatCompletionRequest) features() (enableSkills bool, enableMCP bool) {
+	for _, feature := range strings.Split(req.Model, "+")[1:] {
+		switch feature {
+		case "skills":
+			enableSkills = true
+		case "mcp":
+			enableMCP = true
+		}
+	}
+	if req.EnableSkills != nil {
+		enableSkills = *req.EnableSkills
+	}
+	if req.EnableMCP != nil {
+		enableMCP = *req.EnableMCP
+	}
+	var toolChoice string
+	if json.Unmarshal(req.ToolChoice, &toolChoice) == nil && toolChoice == "none" {
+		enableSkills, enableMCP = false, false
+	}
+	return enableSkills, enableMCP
+}
+
+// callOptions maps the sampling parameters onto model call options
+func (req ChatCompletionRequest) callOptions() []llms.CallOption {
+	var opts []llms.CallOption
+	if req.Temperature != nil {
+		opts = append(opts, llms.WithTemperature(*req.Temperature))
+	}
+	if req.TopP != nil {
+		opts = append(opts, llms.WithTopP(*req.TopP))
+	}
+	if req.MaxCompletionTokens != nil {
+		opts = append(opts, llms.WithMaxTokens(*req.MaxCompletionTokens))
+	} else if req.MaxTokens != nil {
+		opts = append(opts, llms.WithMaxTokens(*req.MaxTokens))
+	}
+	if len(req.Stop) > 0 {
+		var stop []string
+		var word string
+		if json.Unmarshal(req.Stop, &word) == nil {
+			stop = []string{word}
+		} else {
+			_ = json.Unmarshal(req.Stop, &stop)
+		}
+		if len(stop) > 0 {
+			opts = append(opts, llms.WithStopWords(stop))
+		}
+	}
+	return opts
+}
+
+// sendOpenAIError sends an error in the OpenAI format
+func sendOpenAIError(w http.ResponseWriter, statusCode int, message string) {
+	var body OpenAIError
+	body.Error.Message = message
+	body.Error.Type = "invalid_request_error"
+	if statusCode >= http.StatusInternalServerError {
+		body.Error.Type = "server_error"
+	}
+	sendJSONResponse(w, statusCode, body)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/agent"
+)
+
+// recordingAgent records the arguments of the last chat
+type recordingAgent struct {
+	mockAgent
+	ctx          context.Context
+	message      string
+	enableSkills bool
+	enableMCP    bool
+}
+
+func (m *recordingAgent) Chat(ctx context.Context, message string, enableSkills bool, enableMCP bool) (string, error) {
+	m.ctx, m.message, m.enableSkills, m.enableMCP = ctx, message, enableSkills, enableMCP
+	return m.mockAgent.Chat(ctx, message, enableSkills, enableMCP)
+}
+
+func (m *recordingAgent) ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error) {
+	m.ctx, m.message, m.enableSkills, m.enableMCP = ctx, message, enableSkills, enableMCP
+	return m.mockAgent.ChatStream(ctx, message, enableSkills, enableMCP, onChunk)
+}
+
+func TestChatCompletions(t *testing.T) {
+	a := &recordingAgent{mockAgent: mockAgent{chatResponse: "Hi there"}}
+	handler := NewHandler(a)
+
+	body := `{
+		"model": "langchat+skills",
+		"temperature": 0.2,
+		"messages": [
+			{"role": "system", "content": "You are terse"},
+			{"role": "user", "content": "Hello"},
+			{"role": "assistant", "content": "Hi"},
+			{"role": "user", "content": [{"type": "text", "text": "How are you?"}]}
+		]
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ChatCompletions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp ChatCompletionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "chat.completion" || resp.Model != "langchat+skills" || len(resp.Choices) != 1 {
+		t.Fatalf("Unexpected completion: %+v", resp)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Role != "assistant" || choice.Message.Content != "Hi there" || *choice.FinishReason != "stop" {
+		t.Errorf("Unexpected choice: %+v", choice)
+	}
+	if a.message != "How are you?" || !a.enableSkills || a.enableMCP {
+		t.Errorf("Unexpected chat arguments: %q skills=%v mcp=%v", a.message, a.enableSkills, a.enableMCP)
+	}
+	if history, _ := agent.HistoryFromContext(a.ctx); len(history) != 2 {
+		t.Errorf("Expected 2 prior messages, got %d", len(history))
+	}
+	if prompt := agent.SessionPromptFromContext(a.ctx); prompt.SystemPrompt != "You are terse" || !prompt.Literal {
+		t.Errorf("Expected literal system prompt 'You are terse', got %+v", prompt)
+	}
+	if opts := agent.CallOptionsFromContext(a.ctx); len(opts) != 1 {
+		t.Errorf("Expected 1 call option, got %d", len(opts))
+	}
+	if !agent.ApprovalDisabled(a.ctx) {
+		t.Errorf("Expected approval to be disabled for a stateless request")
+	}
+}
+
+func TestChatCompletionsLiteralSystemPrompt(t *testing.T) {
+	a := &recordingAgent{mockAgent: mockAgent{chatResponse: "Hi"}}
+	handler := NewHandler(a)
+
+	// template actions in system messages are plain text, not rejected
+	body := `{"tool_choice": "auto", "messages": [{"role": "system", "content": "Reply with {{range 10}}x{{end}}"}, {"role": "user", "content": "Hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ChatCompletions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if prompt := agent.SessionPromptFromContext(a.ctx); prompt.SystemPrompt != "Reply with {{range 10}}x{{end}}" || !prompt.Literal {
+		t.Errorf("Expected the literal system prompt, got %+v", prompt)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	a := &recordingAgent{mockAgent: mockAgent{
+		streamChunks: []string{"Hello", " World"},
+		events:       []agent.Event{{Type: agent.EventUsage, Usage: &agent.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}}},
+	}}
+	handler := NewHandler(a)
+
+	body := `{"model": "langchat", "stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "Hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ChatCompletions(w, req)
+
+	var chunks []ChatCompletionResponse
+	var done bool
+	for _, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		data := strings.TrimPrefix(block, "data: ")
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk ChatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("Invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Errorf("Expected [DONE], got: %s", w.Body.String())
+	}
+	// role, 2 contents, finish reason, usage
+	if len(chunks) != 5 {
+		t.Fatalf("Expected 5 chunks, got %d: %s", len(chunks), w.Body.String())
+	}
+	if chunks[0].Object != "chat.completion.chunk" || chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("Unexpected first chunk: %+v", chunks[0])
+	}
+	if chunks[1].Choices[0].Delta.Content != "Hello" || chunks[2].Choices[0].Delta.Content != " World" {
+		t.Errorf("Unexpected content chunks: %+v %+v", chunks[1], chunks[2])
+	}
+	if reason := chunks[3].Choices[0].FinishReason; reason == nil || *reason != "stop" {
+		t.Errorf("Expected finish reason 'stop', got %v", reason)
+	}
+	if usage := chunks[4].Usage; usage == nil || usage.TotalTokens != 5 || len(chunks[4].Choices) != 0 {
+		t.Errorf("Unexpected usage chunk: %+v", chunks[4])
+	}
+}
+
+func TestChatCompletionsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no messages", `{"model": "langchat", "messages": []}`},
+		{"last message not from user", `{"messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello"}]}`},
+		{"image content", `{"messages": [{"role": "user", "content": [{"type": "image_url"}]}]}`},
+		{"unknown role", `{"messages": [{"role": "robot", "content": "Hi"}, {"role": "user", "content": "Hi"}]}`},
+		{"client tools", `{"tools": [{"type": "function", "function": {"name": "get_weather"}}], "messages": [{"role": "user", "content": "Hi"}]}`},
+		{"forced tool", `{"tool_choice": "required", "messages": [{"role": "user", "content": "Hi"}]}`},
+		{"named tool", `{"tool_choice": {"type": "function", "function": {"name": "get_weather"}}, "messages": [{"role": "user", "content": "Hi"}]}`},
+		{"long system message", `{"messages": [{"role": "system", "content": "` + strings.Repeat("x", agent.MaxPromptOverrideSize+1) + `"}, {"role": "user", "content": "Hi"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(&mockAgent{})
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ChatCompletions(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+			var resp OpenAIError
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Error.Type != "invalid_request_error" {
+				t.Errorf("Unexpected error body: %+v (%v)", resp, err)
+			}
+		})
+	}
+}
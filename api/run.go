@@ -0,0 +1,424 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/agent"
+)
+
+const (
+	// RunIDHeader carries the ID of a streaming run, used to reconnect to its events
+	RunIDHeader = "X-Run-ID"
+	// maxRunEvents is the number of recent events buffered per run for reconnecting clients
+	maxRunEvents = 1000
+	// runRetention is how long a finished run and its events are kept
+	runRetention = 5 * time.Minute
+)
+
+// RunStatus is the status of a chat run
+type RunStatus string
+
+const (
+	RunRunning          RunStatus = "running"
+	RunDone             RunStatus = "done"
+	RunFailed           RunStatus = "failed"
+	RunCanceled         RunStatus = "canceled"
+	RunApprovalRequired RunStatus = "approval_required"
+)
+
+// RunInfo describes a chat run
+type RunInfo struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"sessionId,omitempty"`
+	Status    RunStatus `json:"status"`
+	// Node is the graph node currently running, e.g. agent or tools
+	Node       string     `json:"node,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// ElapsedMs is the run time in milliseconds, up to now for running runs
+	ElapsedMs int64 `json:"elapsedMs"`
+}
+
+// bufferedEvent is an encoded SSE event
+type bufferedEvent struct {
+	id   int
+	name string
+	data []byte
+}
+
+// chatRun is a chat invocation registered with its cancel func.
+// Its recent events are buffered so a streaming client can reconnect with Last-Event-ID.
+type chatRun struct {
+	id        string
+	tenant    string
+	sessionID string
+	started   time.Time
+	cancel    context.CancelFunc
+	// release frees the run slot of the tenant
+	release func()
+	limits  *limiter
+
+	mu       sync.Mutex
+	events   []bufferedEvent
+	lastID   int
+	node     string
+	status   RunStatus
+	finished time.Time
+	// changed is closed and replaced when an event is added or the run finishes
+	changed chan struct{}
+}
+
+// send buffers an event with the next ID and tracks the current node, it is safe for concurrent use
+func (r *chatRun) send(event StreamEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event.Type, err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch event.Type {
+	case agent.EventNodeStart:
+		r.node = event.Node
+	case agent.EventNodeEnd:
+		r.node = ""
+	case agent.EventUsage:
+		if event.Usage != nil {
+			r.limits.addUsage(r.tenant, event.Usage.TotalTokens)
+		}
+	}
+	r.lastID++
+	r.events = append(r.events, bufferedEvent{id: r.lastID, name: string(event.Type), data: data})
+	if len(r.events) > maxRunEvents {
+		r.events = r.events[len(r.events)-maxRunEvents:]
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// finish marks the run as finished, no more events are sent
+func (r *chatRun) finish(status RunStatus) {
+	r.cancel()
+	r.release()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+	r.node = ""
+	r.finished = time.Now()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// since returns the buffered events after lastID, whether events after lastID were dropped from the buffer,
+// whether the run is finished and a channel closed on the next change
+func (r *chatRun) since(lastID int) (events []bufferedEvent, lost bool, done bool, changed <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) > 0 && r.events[0].id > lastID+1 {
+		lost = true
+	}
+	for _, ev := range r.events {
+		if ev.id > lastID {
+			events = append(events, ev)
+		}
+	}
+	return events, lost, r.status != RunRunning, r.changed
+}
+
+// info returns the description of the run at now
+func (r *chatRun) info(now time.Time) RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := RunInfo{
+		ID:        r.id,
+		SessionID: r.sessionID,
+		Status:    r.status,
+		Node:      r.node,
+		StartedAt: r.started,
+	}
+	if r.status != RunRunning {
+		finished := r.finished
+		info.FinishedAt = &finished
+		now = finished
+	}
+	info.ElapsedMs = now.Sub(r.started).Milliseconds()
+	return info
+}
+
+// runRegistry holds the active and recently finished runs by ID
+type runRegistry struct {
+	// limits caps the runs and token usage of each tenant, nil for no limits
+	limits *limiter
+	mu     sync.Mutex
+	runs   map[string]*chatRun
+}
+
+func newRunRegistry() *runRegistry {
+	return &runRegistry{runs: make(map[string]*chatRun)}
+}
+
+// begin registers a running run of the tenant carried by parent once the tenant is within its limits,
+// the returned context is canceled by cancel or when the run finishes
+func (s *runRegistry) begin(parent context.Context, sessionID string) (*chatRun, context.Context, error) {
+	tenant := agent.TenantFromContext(parent)
+	release, err := s.limits.acquire(parent, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(parent)
+	run := &chatRun{
+		id:        newSessionID(),
+		tenant:    tenant,
+		sessionID: sessionID,
+		started:   time.Now(),
+		cancel:    cancel,
+		release:   sync.OnceFunc(release),
+		limits:    s.limits,
+		status:    RunRunning,
+		changed:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.evictFinished(run.started)
+	s.runs[run.id] = run
+	s.mu.Unlock()
+	return run, ctx, nil
+}
+
+// get returns a run of the tenant carried by ctx by ID
+func (s *runRegistry) get(ctx context.Context, id string) (*chatRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok || run.tenant != agent.TenantFromContext(ctx) {
+		return nil, false
+	}
+	return run, true
+}
+
+// list returns the runs of the tenant carried by ctx, the latest first
+func (s *runRegistry) list(ctx context.Context) []RunInfo {
+	now := time.Now()
+	tenant := agent.TenantFromContext(ctx)
+	s.mu.Lock()
+	s.evictFinished(now)
+	runs := make([]RunInfo, 0, len(s.runs))
+	for _, run := range s.runs {
+		if run.tenant == tenant {
+			runs = append(runs, run.info(now))
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs
+}
+
+// evictFinished removes the runs finished longer than runRetention ago, the caller holds s.mu
+func (s *runRegistry) evictFinished(now time.Time) {
+	for id, run := range s.runs {
+		run.mu.Lock()
+		expired := run.status != RunRunning && now.Sub(run.finished) > runRetention
+		run.mu.Unlock()
+		if expired {
+			delete(s.runs, id)
+		}
+	}
+}
+
+// runStatus maps the outcome of an agent call onto the run status, ctx is the context of the run
+func runStatus(ctx context.Context, err error) RunStatus {
+	var approval *agent.ApprovalRequiredError
+	switch {
+	case errors.As(err, &approval):
+		return RunApprovalRequired
+	case err != nil && errors.Is(ctx.Err(), context.Canceled):
+		return RunCanceled
+	case err != nil:
+		return RunFailed
+	default:
+		return RunDone
+	}
+}
+
+// startStream runs an agent call in the background and streams its tokens and agent events as typed
+// SSE events to the client, followed by the done and end events. Tool calls waiting for approval are
+// sent as an approval_required event. The call keeps running when the client disconnects, the client
+// can reconnect to /api/runs/{id}/events with the run ID from the X-Run-ID header. cancel is called when the call ends.
+func (h *Handler) startStream(ctx context.Context, cancel context.CancelFunc, w http.ResponseWriter, r *http.Request, sessionID string, call func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error)) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		cancel()
+		log.Printf("Streaming not supported")
+		sendSSEError(w, "streaming not supported")
+		return
+	}
+
+	run, ctx, err := h.runs.begin(ctx, sessionID)
+	if err != nil {
+		cancel()
+		sendLimitError(w, r, err)
+		return
+	}
+	go func() {
+		defer cancel()
+		run.finish(streamCall(ctx, run.send, call))
+	}()
+	w.Header().Set(RunIDHeader, run.id)
+	serveRun(w, flusher, r, run, 0)
+}
+
+// streamCall runs an agent call and sends its tokens and agent events, followed by the outcome
+// (done, approval_required, canceled or error) and the end event
+func streamCall(ctx context.Context, send func(StreamEvent), call func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error)) RunStatus {
+	callCtx := agent.WithEventHandler(ctx, func(_ context.Context, event agent.Event) {
+		send(StreamEvent{Event: event})
+	})
+	response, err := call(callCtx, func(_ context.Context, chunk []byte) error {
+		send(StreamEvent{Event: agent.Event{Type: agent.EventToken, Content: string(chunk)}})
+		return nil
+	})
+
+	status := runStatus(ctx, err)
+	switch status {
+	case RunApprovalRequired:
+		var approval *agent.ApprovalRequiredError
+		errors.As(err, &approval)
+		send(StreamEvent{Event: agent.Event{Type: StreamEventApprovalRequired}, Approval: &approval.Request})
+	case RunCanceled:
+		send(StreamEvent{Event: agent.Event{Type: StreamEventCanceled}})
+	case RunFailed:
+		log.Printf("Chat stream error: %v", err)
+		send(StreamEvent{Event: agent.Event{Type: agent.EventError, Error: fmt.Sprintf("chat failed: %v", err)}})
+	default:
+		// Send final response
+		send(StreamEvent{Event: agent.Event{Type: StreamEventDone, Content: response}})
+	}
+	send(StreamEvent{Event: agent.Event{Type: StreamEventEnd}})
+	return status
+}
+
+// trackRun registers a run for a non-streaming agent call, the agent events are buffered in the run.
+// The returned finish func records the outcome of the call. It returns a LimitError when the tenant is over its limits.
+func (h *Handler) trackRun(ctx context.Context, w http.ResponseWriter, sessionID string) (context.Context, func(error), error) {
+	run, ctx, err := h.runs.begin(ctx, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.Header().Set(RunIDHeader, run.id)
+	runCtx := ctx
+	ctx = agent.WithEventHandler(ctx, func(_ context.Context, event agent.Event) {
+		run.send(StreamEvent{Event: event})
+	})
+	return ctx, func(err error) {
+		run.finish(runStatus(runCtx, err))
+	}, nil
+}
+
+// ListRuns lists the active and recently finished runs of the caller, the status query parameter filters them
+func (h *Handler) ListRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	runs := h.runs.list(r.Context())
+	if status := RunStatus(r.URL.Query().Get("status")); status != "" {
+		runs = slices.DeleteFunc(runs, func(run RunInfo) bool { return run.Status != status })
+	}
+	sendJSONResponse(w, http.StatusOK, runs)
+}
+
+// CancelRun cancels a running run, the tools it is running are canceled with it
+func (h *Handler) CancelRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	run, ok := h.runs.get(r.Context(), r.PathValue("id"))
+	if !ok {
+		sendErrorResponse(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if info := run.info(time.Now()); info.Status != RunRunning {
+		sendErrorResponse(w, http.StatusConflict, fmt.Sprintf("run is %s", info.Status))
+		return
+	}
+	run.cancel()
+	sendJSONResponse(w, http.StatusAccepted, run.info(time.Now()))
+}
+
+// RunEvents streams the events of a run after the Last-Event-ID header (or lastEventId query parameter),
+// following the run until it ends
+func (h *Handler) RunEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	run, ok := h.runs.get(r.Context(), r.PathValue("id"))
+	if !ok {
+		sendErrorResponse(w, http.StatusNotFound, "run not found")
+		return
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	lastID := 0
+	if lastEventID != "" {
+		var err error
+		if lastID, err = strconv.Atoi(lastEventID); err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendErrorResponse(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	setSSEHeaders(w)
+	w.Header().Set(RunIDHeader, run.id)
+	serveRun(w, flusher, r, run, lastID)
+}
+
+// serveRun writes the events of a run after lastID until the run ends or the client disconnects
+func serveRun(w http.ResponseWriter, flusher http.Flusher, r *http.Request, run *chatRun, lastID int) {
+	for {
+		events, lost, done, changed := run.since(lastID)
+		if lost {
+			writeSSE(w, 0, string(agent.EventError), mustJSON(StreamEvent{Event: agent.Event{
+				Type:  agent.EventError,
+				Error: fmt.Sprintf("events after %d are no longer available", lastID),
+			}}))
+		}
+		for _, ev := range events {
+			writeSSE(w, ev.id, ev.name, ev.data)
+			lastID = ev.id
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func mustJSON(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
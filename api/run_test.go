@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/agent"
+)
+
+// toolAgent reports running the tools node until the chat is canceled
+type toolAgent struct {
+	mockAgent
+	started chan struct{}
+}
+
+func (m *toolAgent) Chat(ctx context.Context, message string, enableSkills bool, enableMCP bool) (string, error) {
+	return m.ChatStream(ctx, message, enableSkills, enableMCP, nil)
+}
+
+func (m *toolAgent) ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error) {
+	agent.EmitEvent(ctx, agent.Event{Type: agent.EventNodeStart, Node: "tools"})
+	close(m.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+// blockingAgent streams "a", waits for release and streams "b"
+type blockingAgent struct {
+	mockAgent
+	release chan struct{}
+}
+
+func (m *blockingAgent) ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error) {
+	if err := onChunk(ctx, []byte("a")); err != nil {
+		return "", err
+	}
+	select {
+	case <-m.release:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if err := onChunk(ctx, []byte("b")); err != nil {
+		return "", err
+	}
+	return "ab", nil
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	writeSSE(&buf, 3, "token", []byte("line 1\r\nline 2\n"))
+	want := "id: 3\nevent: token\ndata: line 1\ndata: line 2\ndata: \n\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestRunReconnect(t *testing.T) {
+	a := &blockingAgent{release: make(chan struct{})}
+	server := httptest.NewServer(NewServer(a, DefaultServerConfig()).httpServer.Handler)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/chat/stream", "application/json", strings.NewReader(`{"message": "Hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runID := resp.Header.Get(RunIDHeader)
+	if runID == "" {
+		t.Fatal("Expected X-Run-ID header")
+	}
+	// Read the first event and drop the connection
+	reader := bufio.NewReader(resp.Body)
+	var first strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "\n" {
+			break
+		}
+		first.WriteString(line)
+	}
+	resp.Body.Close()
+	if events := parseSSE(t, first.String()); len(events) != 1 || events[0].id != "1" || events[0].data.Content != "a" {
+		t.Fatalf("Unexpected first event: %q", first.String())
+	}
+
+	// The generation continues without the client
+	close(a.release)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/runs/"+runID+"/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := parseSSE(t, string(body))
+	wantTypes := []string{"token", "done", "end"}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("Expected %d events, got %d: %s", len(wantTypes), len(events), body)
+	}
+	for i, want := range wantTypes {
+		if events[i].name != want {
+			t.Errorf("Event %d: expected %s, got %s", i, want, events[i].name)
+		}
+	}
+	if events[0].id != "2" || events[0].data.Content != "b" || events[1].data.Content != "ab" {
+		t.Errorf("Unexpected resumed events: %s", body)
+	}
+
+	resp, err = http.Get(server.URL + "/api/runs/unknown/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown run, got %d", resp.StatusCode)
+	}
+}
+
+func TestRunLostEvents(t *testing.T) {
+	run, _, _ := newRunRegistry().begin(context.Background(), "")
+	for i := 0; i < maxRunEvents+5; i++ {
+		run.send(StreamEvent{})
+	}
+	events, lost, _, _ := run.since(2)
+	if !lost {
+		t.Error("Expected evicted events to be reported as lost")
+	}
+	if len(events) != maxRunEvents || events[0].id != 6 {
+		t.Errorf("Expected %d events from id 6, got %d", maxRunEvents, len(events))
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	a := &toolAgent{started: make(chan struct{})}
+	server := httptest.NewServer(NewServer(a, DefaultServerConfig()).httpServer.Handler)
+	defer server.Close()
+
+	type result struct {
+		status int
+		body   ChatResponse
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := http.Post(server.URL+"/api/chat", "application/json", strings.NewReader(`{"message": "Hello", "sessionId": "s1"}`))
+		if err != nil {
+			done <- result{}
+			return
+		}
+		defer resp.Body.Close()
+		var body ChatResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		done <- result{resp.StatusCode, body}
+	}()
+	<-a.started
+
+	resp, err := http.Get(server.URL + "/api/runs?status=running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs []RunInfo
+	json.NewDecoder(resp.Body).Decode(&runs)
+	resp.Body.Close()
+	if len(runs) != 1 || runs[0].Status != RunRunning || runs[0].Node != "tools" || runs[0].SessionID != "s1" {
+		t.Fatalf("Unexpected runs: %+v", runs)
+	}
+
+	resp, err = http.Post(server.URL+"/api/runs/"+runs[0].ID+"/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", resp.StatusCode)
+	}
+	if res := <-done; res.status != http.StatusInternalServerError {
+		t.Errorf("Expected the canceled chat to fail, got %d", res.status)
+	}
+
+	resp, err = http.Get(server.URL + "/api/runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs = nil
+	json.NewDecoder(resp.Body).Decode(&runs)
+	resp.Body.Close()
+	if len(runs) != 1 || runs[0].Status != RunCanceled || runs[0].FinishedAt == nil || runs[0].Node != "" {
+		t.Errorf("Expected the run to be canceled, got %+v", runs)
+	}
+
+	resp, err = http.Post(server.URL+"/api/runs/"+runs[0].ID+"/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409 for a finished run, got %d", resp.StatusCode)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/kinwyb/langchat/llm/agent"
@@ -20,6 +21,14 @@ type Server struct {
 type ServerConfig struct {
 	Host string
 	Port int
+	// Auth authenticates the API requests, e.g. APIKeys, JWTAuth or Authenticators combining them.
+	// The API is open when it is nil.
+	Auth Authenticator
+	// AllowedOrigins are the origins allowed to call the API from a browser, "*" allows any origin.
+	// Only same-origin requests are allowed when it is empty.
+	AllowedOrigins []string
+	// Limits configures the rate limits, concurrent runs and daily token quotas
+	Limits LimitConfig
 }
 
 // DefaultServerConfig returns default server configuration
@@ -33,14 +42,27 @@ func DefaultServerConfig() ServerConfig {
 // NewServer creates a new HTTP server for the chat API
 func NewServer(a agent.Agent, cfg ServerConfig) *Server {
 	handler := NewHandler(a)
+	handler.allowedOrigins = cfg.AllowedOrigins
+	limits := newLimiter(cfg.Limits)
+	handler.runs.limits = limits
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", handler.HealthCheck)
 	mux.HandleFunc("/api/chat", handler.Chat)
 	mux.HandleFunc("/api/chat/stream", handler.ChatStream)
+	mux.HandleFunc("/api/chat/ws", handler.ChatWebSocket)
+	mux.HandleFunc("/api/approvals/{id}", handler.Approve)
+	mux.HandleFunc("/api/approvals/{id}/stream", handler.ApproveStream)
+	mux.HandleFunc("/api/runs", handler.ListRuns)
+	mux.HandleFunc("/api/runs/{id}/events", handler.RunEvents)
+	mux.HandleFunc("/api/runs/{id}/cancel", handler.CancelRun)
+	mux.HandleFunc("/api/admin/skills", adminOnly(handler.SkillsStatus))
+	mux.HandleFunc("/api/admin/skills/reload", adminOnly(handler.ReloadSkills))
+	mux.HandleFunc("/v1/chat/completions", handler.ChatCompletions)
+	mux.HandleFunc("/v1/models", handler.Models)
 
-	// Add CORS middleware
-	corsMux := corsMiddleware(mux)
+	// Add CORS, auth and rate limit middleware, CORS preflight requests carry no credentials
+	corsMux := corsMiddleware(cfg.AllowedOrigins, authMiddleware(cfg.Auth, rateLimitMiddleware(limits, mux)))
 
 	return &Server{
 		httpServer: &http.Server{
@@ -69,12 +91,17 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.httpServer.Shutdown(ctx)
 }
 
-// corsMiddleware adds CORS headers to all responses
-func corsMiddleware(next http.Handler) http.Handler {
+// corsMiddleware adds CORS headers to the responses of allowed origins
+func corsMiddleware(allowedOrigins []string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin != "" && originAllowed(allowedOrigins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Last-Event-ID, "+SessionIDHeader)
+			w.Header().Set("Access-Control-Expose-Headers", SessionIDHeader+", "+RunIDHeader)
+		}
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -84,3 +111,13 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// originAllowed reports whether origin is one of the allowed origins
+func originAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
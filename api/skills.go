@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/kinwyb/langchat/llm/agent"
+)
+
+// SkillsStatus returns the state of the skills directory: the loaded skills and the packages which failed to load
+func (h *Handler) SkillsStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	reloader, ok := h.agent.(agent.SkillReloader)
+	if !ok {
+		sendErrorResponse(w, http.StatusNotImplemented, "skill reload not supported")
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, reloader.SkillsStatus())
+}
+
+// ReloadSkills rescans the skills directory now and returns its new state
+func (h *Handler) ReloadSkills(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	reloader, ok := h.agent.(agent.SkillReloader)
+	if !ok {
+		sendErrorResponse(w, http.StatusNotImplemented, "skill reload not supported")
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, reloader.ReloadSkills())
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/agent"
+	"github.com/kinwyb/langchat/llm/llmtest"
+	"github.com/kinwyb/langchat/llm/skills"
+)
+
+func TestSkillsReload(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill := func(name, content string) {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "SKILL.md"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSkill("greeter", "---\nname: greeter\ndescription: Greets\n---\nSay hello.")
+	a := agent.NewTextChatAgent(llmtest.New(), agent.WithSkill(dir))
+	defer a.Close()
+	handler := NewServer(a, DefaultServerConfig()).httpServer.Handler
+
+	do := func(method, path string) (int, skills.Status) {
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var status skills.Status
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, status
+	}
+
+	code, status := do(http.MethodGet, "/api/admin/skills")
+	if code != http.StatusOK || !slices.Equal(status.Skills, []string{"greeter"}) {
+		t.Fatalf("Expected skill 'greeter', got %d %+v", code, status)
+	}
+
+	writeSkill("counter", "---\nname: counter\ndescription: Counts\n---\nCount.")
+	writeSkill("broken", "no frontmatter")
+	code, status = do(http.MethodPost, "/api/admin/skills/reload")
+	if code != http.StatusOK || !slices.Equal(status.Skills, []string{"counter", "greeter"}) {
+		t.Errorf("Expected skills 'counter' and 'greeter', got %d %+v", code, status)
+	}
+	if len(status.Errors) != 1 || status.Errors[0].Path != filepath.Join(dir, "broken") {
+		t.Errorf("Expected a load error for 'broken', got %+v", status.Errors)
+	}
+
+	if code, _ := do(http.MethodGet, "/api/admin/skills/reload"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", code)
+	}
+}
+
+func TestSkillsReloadNotSupported(t *testing.T) {
+	handler := NewHandler(&mockAgent{})
+	w := httptest.NewRecorder()
+	handler.SkillsStatus(w, httptest.NewRequest(http.MethodGet, "/api/admin/skills", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
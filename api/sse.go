@@ -0,0 +1,48 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// writeSSE writes an event in the text/event-stream format.
+// Every line of data is sent as its own data field so multi-line data survives the round trip,
+// an id of 0 omits the id field.
+func writeSSE(w io.Writer, id int, name string, data []byte) {
+	var buf bytes.Buffer
+	if id > 0 {
+		fmt.Fprintf(&buf, "id: %d\n", id)
+	}
+	if name != "" {
+		fmt.Fprintf(&buf, "event: %s\n", name)
+	}
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	w.Write(buf.Bytes())
+}
+
+// setSSEHeaders sets the response headers of an event stream
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+}
+
+// writeSSEEvent writes a typed JSON event without an id
+func writeSSEEvent(w io.Writer, event StreamEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event.Type, err)
+		return
+	}
+	writeSSE(w, 0, string(event.Type), data)
+}
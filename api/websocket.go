@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/agent"
+	"golang.org/x/net/websocket"
+)
+
+// WebSocket client message types
+const (
+	// WSMessageChat starts a chat turn. Sent while a turn is running it interjects:
+	// the running turn is canceled and the message continues the conversation.
+	WSMessageChat = "chat"
+	// WSMessageCancel cancels the running turn
+	WSMessageCancel = "cancel"
+	// WSMessageApproval posts the decision for tool calls waiting for approval and resumes the chat
+	WSMessageApproval = "approval"
+)
+
+// WSClientMessage is a message sent by the client over the WebSocket connection
+type WSClientMessage struct {
+	Type string `json:"type"`
+	// ChatRequest is the chat of a chat message, the session ID switches the session of the connection
+	ChatRequest
+	// ApprovalID, Approved and Reason are the decision of an approval message
+	ApprovalID string `json:"approvalId,omitempty"`
+	Approved   bool   `json:"approved,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// WSServerMessage is a message sent by the server over the WebSocket connection,
+// the events of a turn are the events of the SSE stream
+type WSServerMessage struct {
+	StreamEvent
+	// Turn numbers the chat and approval turns of the connection, events of a canceled turn can be told apart
+	Turn int `json:"turn,omitempty"`
+	// RunID is the run of the turn, see /api/runs
+	RunID string `json:"runId,omitempty"`
+}
+
+// ChatWebSocket handles bidirectional chat sessions over WebSocket.
+// The client sends chat, cancel and approval messages, the server sends the tokens and events of each turn.
+func (h *Handler) ChatWebSocket(w http.ResponseWriter, r *http.Request) {
+	server := websocket.Server{
+		Handshake: h.checkOrigin,
+		Handler:   h.serveWebSocket,
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkOrigin accepts WebSocket connections from the same origin, from the allowed origins
+// and from clients which are not browsers (no Origin header)
+func (h *Handler) checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	if originAllowed(h.allowedOrigins, origin) {
+		return nil
+	}
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// wsSession is the state of a WebSocket connection
+type wsSession struct {
+	h         *Handler
+	conn      *websocket.Conn
+	sessionID string
+	// rateKey is the rate limit bucket of the connection, each turn takes a token
+	rateKey string
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	turn int
+	// cancel and done belong to the running turn
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (h *Handler) serveWebSocket(conn *websocket.Conn) {
+	r := conn.Request()
+	s := &wsSession{h: h, conn: conn, sessionID: r.URL.Query().Get("sessionId"), rateKey: rateLimitKey(r)}
+	if s.sessionID == "" {
+		s.sessionID = r.Header.Get(SessionIDHeader)
+	}
+	if err := agent.ValidateSessionID(s.sessionID); err != nil {
+		s.sendError(0, err.Error())
+		return
+	}
+	if s.sessionID == "" {
+		s.sessionID = newSessionID()
+	}
+	defer s.interrupt()
+	s.send(0, StreamEvent{Event: agent.Event{Type: StreamEventSession, Content: s.sessionID}})
+
+	for {
+		var msg WSClientMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("WebSocket receive error: %v", err)
+			}
+			return
+		}
+		switch msg.Type {
+		case WSMessageChat:
+			s.chat(r.Context(), msg.ChatRequest)
+		case WSMessageCancel:
+			s.interrupt()
+		case WSMessageApproval:
+			s.approve(r.Context(), msg)
+		default:
+			s.sendError(0, "unknown message type: "+msg.Type)
+		}
+	}
+}
+
+// chat starts a chat turn, interrupting the running turn
+func (s *wsSession) chat(parent context.Context, req ChatRequest) {
+	if err := validateChatRequest(req); err != nil {
+		s.sendError(0, err.Error())
+		return
+	}
+	if !s.allow() {
+		return
+	}
+	s.interrupt()
+	if req.SessionID != "" && req.SessionID != s.sessionID {
+		s.sessionID = req.SessionID
+		s.send(0, StreamEvent{Event: agent.Event{Type: StreamEventSession, Content: s.sessionID}})
+	}
+	ctx := agent.WithSessionID(parent, s.sessionID)
+	ctx = agent.WithSessionPrompt(ctx, agent.SessionPrompt{
+		SystemPrompt: req.SystemPrompt,
+		UserName:     req.UserName,
+		Locale:       req.Locale,
+	})
+	if req.Skill != "" {
+		ctx = agent.WithSkillName(ctx, req.Skill)
+	}
+	s.start(ctx, func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error) {
+		return s.h.agent.ChatStream(ctx, req.Message, req.EnableSkills, req.EnableMCP, onChunk)
+	})
+}
+
+// approve resumes the chat with the decision for tool calls waiting for approval
+func (s *wsSession) approve(parent context.Context, msg WSClientMessage) {
+	approver, ok := s.h.agent.(agent.Approver)
+	if !ok {
+		s.sendError(0, "tool approval not supported")
+		return
+	}
+	if msg.ApprovalID == "" {
+		s.sendError(0, "approval id is required")
+		return
+	}
+	if !s.allow() {
+		return
+	}
+	s.interrupt()
+	decision := agent.ApprovalDecision{Approved: msg.Approved, Reason: msg.Reason}
+	s.start(parent, func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error) {
+		return approver.Resume(ctx, msg.ApprovalID, decision, onChunk)
+	})
+}
+
+// allow takes a rate limit token for a turn, sending the error when the connection is over its rate limit.
+// The run slot of the tenant is taken when the turn starts.
+func (s *wsSession) allow() bool {
+	if err := s.h.runs.limits.allow(s.rateKey); err != nil {
+		s.sendError(0, err.Error())
+		return false
+	}
+	return true
+}
+
+// start runs a turn in the background, no turn is running
+func (s *wsSession) start(parent context.Context, call func(ctx context.Context, onChunk func(context.Context, []byte) error) (string, error)) {
+	ctx, cancel := context.WithTimeout(parent, 2*time.Minute)
+	run, ctx, err := s.h.runs.begin(ctx, s.sessionID)
+	if err != nil {
+		cancel()
+		s.sendError(0, err.Error())
+		return
+	}
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.turn++
+	turn := s.turn
+	s.cancel, s.done = run.cancel, done
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		run.finish(streamCall(ctx, func(event StreamEvent) {
+			run.send(event)
+			s.sendRun(turn, run.id, event)
+		}, call))
+	}()
+}
+
+// interrupt cancels the running turn and waits for it to end
+func (s *wsSession) interrupt() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// send writes a server message, it is safe for concurrent use
+func (s *wsSession) send(turn int, event StreamEvent) {
+	s.sendRun(turn, "", event)
+}
+
+// sendRun writes a server message of a run
+func (s *wsSession) sendRun(turn int, runID string, event StreamEvent) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := websocket.JSON.Send(s.conn, WSServerMessage{StreamEvent: event, Turn: turn, RunID: runID}); err != nil {
+		log.Printf("WebSocket send error: %v", err)
+	}
+}
+
+func (s *wsSession) sendError(turn int, message string) {
+	s.send(turn, StreamEvent{Event: agent.Event{Type: agent.EventError, Error: message}})
+}
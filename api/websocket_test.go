@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/agent"
+	"github.com/tmc/langchaingo/llms"
+	"golang.org/x/net/websocket"
+)
+
+// blockingModel streams a partial answer and blocks until the call is canceled,
+// messages containing "quick" are answered at once
+type blockingModel struct{}
+
+func (m *blockingModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	last := messages[len(messages)-1].Parts[0].(llms.TextContent).Text
+	if strings.Contains(last, "quick") {
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "ok"}}}, nil
+	}
+	if opts.StreamingFunc != nil {
+		if err := opts.StreamingFunc(ctx, []byte("partial")); err != nil {
+			return nil, err
+		}
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m *blockingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestChatWebSocketCancel(t *testing.T) {
+	a := agent.NewTextChatAgent(&blockingModel{})
+	defer a.Close()
+	server := httptest.NewServer(NewServer(a, DefaultServerConfig()).httpServer.Handler)
+	defer server.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/chat/ws?sessionId=s1", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// receive reads server messages until one of type typ
+	receive := func(typ agent.EventType) WSServerMessage {
+		t.Helper()
+		for {
+			var msg WSServerMessage
+			if err := websocket.JSON.Receive(conn, &msg); err != nil {
+				t.Fatalf("Waiting for %s: %v", typ, err)
+			}
+			if msg.Type == typ {
+				return msg
+			}
+		}
+	}
+
+	if msg := receive(StreamEventSession); msg.Content != "s1" {
+		t.Errorf("Expected session 's1', got %q", msg.Content)
+	}
+	if err := websocket.JSON.Send(conn, WSClientMessage{Type: WSMessageChat, ChatRequest: ChatRequest{Message: "tell me a long story"}}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(agent.EventToken); msg.Content != "partial" || msg.Turn != 1 {
+		t.Errorf("Unexpected token: %+v", msg)
+	}
+
+	// Cancel while the model is generating
+	if err := websocket.JSON.Send(conn, WSClientMessage{Type: WSMessageCancel}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(StreamEventCanceled); msg.Turn != 1 {
+		t.Errorf("Expected turn 1 to be canceled, got %+v", msg)
+	}
+	receive(StreamEventEnd)
+
+	// The session accepts the next message
+	if err := websocket.JSON.Send(conn, WSClientMessage{Type: WSMessageChat, ChatRequest: ChatRequest{Message: "quick question"}}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(StreamEventDone); msg.Content != "ok" || msg.Turn != 2 {
+		t.Errorf("Unexpected done: %+v", msg)
+	}
+}
+
+func TestChatWebSocketInterject(t *testing.T) {
+	a := agent.NewTextChatAgent(&blockingModel{})
+	defer a.Close()
+	server := httptest.NewServer(NewServer(a, DefaultServerConfig()).httpServer.Handler)
+	defer server.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/chat/ws", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	websocket.JSON.Send(conn, WSClientMessage{Type: WSMessageChat, ChatRequest: ChatRequest{Message: "tell me a long story"}})
+	websocket.JSON.Send(conn, WSClientMessage{Type: WSMessageChat, ChatRequest: ChatRequest{Message: "quick, stop"}})
+
+	var types []string
+	for {
+		var msg WSServerMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, string(msg.Type))
+		if msg.Type == StreamEventDone {
+			if msg.Turn != 2 || msg.Content != "ok" {
+				t.Errorf("Unexpected done: %+v", msg)
+			}
+			break
+		}
+	}
+	if !strings.Contains(strings.Join(types, ","), "canceled,end") {
+		t.Errorf("Expected the first turn to be canceled, got %v", types)
+	}
+}
+
+func TestChatWebSocketInvalidSession(t *testing.T) {
+	server := httptest.NewServer(NewServer(&mockAgent{}, DefaultServerConfig()).httpServer.Handler)
+	defer server.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/chat/ws?sessionId=tenant%2Fs1", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var msg WSServerMessage
+	if err := websocket.JSON.Receive(conn, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agent.EventError || !strings.Contains(msg.Error, "session ID") {
+		t.Errorf("Expected a session ID error, got %+v", msg)
+	}
+}
+
+func TestChatWebSocketRateLimit(t *testing.T) {
+	a := agent.NewTextChatAgent(&blockingModel{})
+	defer a.Close()
+	// the upgrade request takes the first token, the first turn the second one
+	cfg := DefaultServerConfig()
+	cfg.Limits = LimitConfig{RequestsPerSecond: 0.01, Burst: 2}
+	server := httptest.NewServer(NewServer(a, cfg).httpServer.Handler)
+	defer server.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/chat/ws?sessionId=s1", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	receive := func() WSServerMessage {
+		t.Helper()
+		for {
+			var msg WSServerMessage
+			if err := websocket.JSON.Receive(conn, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == StreamEventDone || msg.Type == agent.EventError {
+				return msg
+			}
+		}
+	}
+	for i, want := range []agent.EventType{StreamEventDone, agent.EventError} {
+		if err := websocket.JSON.Send(conn, WSClientMessage{Type: WSMessageChat, ChatRequest: ChatRequest{Message: "quick question"}}); err != nil {
+			t.Fatal(err)
+		}
+		if msg := receive(); msg.Type != want {
+			t.Errorf("Turn %d: expected %s, got %+v", i+1, want, msg)
+		}
+	}
+}
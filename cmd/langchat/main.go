@@ -0,0 +1,42 @@
+// Command langchat provides maintenance tools for langchat deployments.
+//
+// Usage:
+//
+//	langchat skills lint [-json] [-strict] [-tools name,...] [-max-body bytes] <dir>
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	switch args[0] {
+	case "skills":
+		return runSkills(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command '%s'\n", args[0])
+		usage(stderr)
+		return 2
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, `Usage: langchat <command> [arguments]
+
+Commands:
+  skills lint <dir>   validate the skill packages of a skills directory`)
+}
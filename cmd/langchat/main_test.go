@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkillsLint(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("greeter/SKILL.md", "---\nname: greeter\ndescription: Greets people by name when they say hello\nallowed-tools: [send_mail]\n---\nSay hello.\n")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"skills", "lint", "-json", dir}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1, got %d: %s", code, stderr.String())
+	}
+	var report lintReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Skills != 1 || report.Errors != 1 || report.Diagnostics[0].Code != "unknown-tool" {
+		t.Errorf("Expected an unknown tool error, got %+v", report)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"skills", "lint", "-tools", "send_mail", dir}, &stdout, &stderr); code != 0 {
+		t.Errorf("Expected exit code 0, got %d: %s", code, stdout.String())
+	}
+
+	if code := run([]string{"skills", "lint"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 without a directory, got %d", code)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kinwyb/langchat/llm/skills"
+)
+
+// lintReport is the JSON output of skills lint
+type lintReport struct {
+	Dir         string              `json:"dir"`
+	Skills      int                 `json:"skills"`
+	Errors      int                 `json:"errors"`
+	Warnings    int                 `json:"warnings"`
+	Diagnostics []skills.Diagnostic `json:"diagnostics"`
+}
+
+func runSkills(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "lint" {
+		fmt.Fprintln(stderr, "Usage: langchat skills lint [flags] <dir>")
+		return 2
+	}
+	return lintSkills(args[1:], stdout, stderr)
+}
+
+// lintSkills validates the skills directory, it exits with 1 when errors are found
+func lintSkills(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("skills lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "write the diagnostics as JSON")
+	strict := fs.Bool("strict", false, "fail on warnings too")
+	knownTools := fs.String("tools", "", "comma separated tools registered to the agent that allowed-tools may name")
+	maxBody := fs.Int("max-body", skills.DefaultMaxBodySize, "SKILL.md body size in bytes above which a warning is reported")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: langchat skills lint [flags] <dir>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	dir := fs.Arg(0)
+	opts := []skills.ValidateOption{skills.WithMaxBodySize(*maxBody)}
+	for _, name := range strings.Split(*knownTools, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts = append(opts, skills.WithKnownTools(name))
+		}
+	}
+	packages, diagnostics := skills.ValidateDir(dir, opts...)
+
+	report := lintReport{Dir: dir, Skills: len(packages), Diagnostics: diagnostics}
+	if report.Diagnostics == nil {
+		report.Diagnostics = []skills.Diagnostic{}
+	}
+	for _, d := range diagnostics {
+		if d.Severity == skills.SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	} else {
+		for _, d := range diagnostics {
+			fmt.Fprintln(stdout, d)
+		}
+		fmt.Fprintf(stdout, "%d skills, %d errors, %d warnings\n", report.Skills, report.Errors, report.Warnings)
+	}
+	if report.Errors > 0 || (*strict && report.Warnings > 0) {
+		return 1
+	}
+	return 0
+}
@@ -29,12 +29,25 @@ func main() {
 	// 可以替换为其他 agent 实现，如 ReactAgent
 	textAgent := agent.NewTextChatAgent(llm,
 		agent.WithSkill("./skills"), // 配置技能目录
+		// agent.WithSkillReload(5*time.Second), // 检查技能目录变更并自动重新加载，状态见 /api/admin/skills
+		// agent.WithSkillRouter(agent.NewEmbeddingSkillRouter(embedder)), // 按向量相似度选择技能，embedder 如 embeddings.NewEmbedder(llm)
 		// agent.WithMCP("./mcp"),    // 配置 MCP 目录
+		// agent.WithConversationStore(store), // 配置会话持久化存储，如 agent.NewFileConversationStore("./conversations")
+		// agent.WithSandbox(tools.DefaultSandbox()), // 技能生成的代码默认在 tools.DefaultSandbox() 中执行，可传入自定义沙箱，agent.WithHostExecution() 直接在本机执行
+		// agent.WithWorkspace(&tools.Workspace{Root: "./workspace"}), // 限制技能文件读写范围，按会话隔离
+		// agent.WithToolTimeout(30*time.Second),     // 工具调用超时时间，可用 agent.WithToolTimeoutFor 按工具配置
+		// agent.WithToolPolicy(agent.RequireApproval("run_shell_code", "write_file")), // 危险工具调用需用户审批，决定提交到 /api/approvals/{id}
 	)
 
 	// 创建 API 服务器
 	serverCfg := api.DefaultServerConfig()
 	serverCfg.Port = 8080
+	// serverCfg.AllowedOrigins = []string{"http://localhost:3000"} // 允许跨域访问的前端地址，默认只允许同源访问
+	// serverCfg.Limits = api.LimitConfig{RequestsPerSecond: 2, Burst: 10, MaxConcurrentRuns: 2, QueueTimeout: 10 * time.Second, DailyTokens: 1_000_000} // 限流、租户并发和每日token配额
+	// serverCfg.Auth = api.Authenticators{ // 接口鉴权，API key 或 HS256 JWT，身份映射到租户隔离会话
+	// 	api.APIKeys{"your-api-key": {Subject: "web", Tenant: "default"}, "your-admin-key": {Subject: "ops", Admin: true}}, // Admin 身份才能访问 /api/admin
+	// 	&api.JWTAuth{Key: []byte("your-jwt-secret")},
+	// }
 	server := api.NewServer(textAgent, serverCfg)
 
 	// 启动服务器
@@ -1,6 +1,12 @@
 package agent
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/skills"
+	"github.com/kinwyb/langchat/llm/tools"
+)
 
 // Agent interface defines the contract for chat agents
 type Agent interface {
@@ -8,13 +14,64 @@ type Agent interface {
 	ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error)
 }
 
+// SkillReloader is implemented by agents which reload their skills at runtime
+type SkillReloader interface {
+	// SkillsStatus returns the state of the skills directory after the last scan
+	SkillsStatus() skills.Status
+	// ReloadSkills scans the skills directory now and returns its new state
+	ReloadSkills() skills.Status
+}
+
 // config agent config
 type config struct {
-	skillDir    string
+	skillDir string
+	// skillReload 技能目录变更检查间隔，小于等于0时不自动重新加载
+	skillReload time.Duration
+	// skillRouter 技能选择器，默认每条消息调用一次LLM选择技能
+	skillRouter SkillRouter
 	mcpDir      string
 	toolSupport bool
+	// sessionIdleTimeout 会话空闲过期时间
+	sessionIdleTimeout time.Duration
+	// store 会话持久化存储
+	store ConversationStore
+	// maxContextTokens 上下文token预算，小于等于0时不限制
+	maxContextTokens int
+	tokenCounter     TokenCounter
+	summarizeHistory bool
+	// systemPrompt 系统提示词模板
+	systemPrompt string
+	// maxToolIterations 工具调用最大轮数
+	maxToolIterations int
+	// tools 自定义工具
+	tools []tools.ITool
+	// sandbox 技能代码执行沙箱，为 nil 时使用 tools.DefaultSandbox()
+	sandbox *tools.Sandbox
+	// hostExecution 不使用沙箱，直接在本机执行技能代码
+	hostExecution bool
+	// workspace 文件工具工作目录，Root 下按租户会话创建子目录
+	workspace *tools.Workspace
+	// toolPolicy 工具调用审批策略
+	toolPolicy ToolPolicy
+	// approvals 等待审批的工具调用存储
+	approvals ApprovalStore
+	// toolTimeout 工具调用默认超时时间，小于等于0时不限制
+	toolTimeout time.Duration
+	// toolTimeouts 按工具名称配置的超时时间
+	toolTimeouts map[string]time.Duration
+}
+
+// toolTimeoutFor returns the timeout of the named tool
+func (c *config) toolTimeoutFor(name string) time.Duration {
+	if d, ok := c.toolTimeouts[name]; ok {
+		return d
+	}
+	return c.toolTimeout
 }
 
+// DefaultMaxToolIterations is the default limit of model calls in a tool calling loop
+const DefaultMaxToolIterations = 10
+
 type Option func(*config)
 
 // WithSkill 配置技能目录
@@ -24,6 +81,21 @@ func WithSkill(skillDir string) Option {
 	}
 }
 
+// WithSkillReload 按间隔检查技能目录，新增、修改、删除的技能自动重新加载
+func WithSkillReload(interval time.Duration) Option {
+	return func(c *config) {
+		c.skillReload = interval
+	}
+}
+
+// WithSkillRouter 配置技能选择器，如 NewEmbeddingSkillRouter(embedder) 按向量相似度检索候选技能，
+// 实现 SkillIndexer 的选择器在技能加载和重新加载时建立索引
+func WithSkillRouter(router SkillRouter) Option {
+	return func(c *config) {
+		c.skillRouter = router
+	}
+}
+
 // WithMCP 配置MCP目录
 func WithMCP(mcpDir string) Option {
 	return func(c *config) {
@@ -37,3 +109,115 @@ func ModelToolSupport(support bool) Option {
 		c.toolSupport = support
 	}
 }
+
+// WithSessionIdleTimeout 配置会话空闲过期时间，小于等于0时不过期
+func WithSessionIdleTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.sessionIdleTimeout = timeout
+	}
+}
+
+// WithConversationStore 配置会话持久化存储
+func WithConversationStore(store ConversationStore) Option {
+	return func(c *config) {
+		c.store = store
+	}
+}
+
+// WithTokenBudget 配置发送给模型的上下文token预算，超出时裁剪较早的对话
+func WithTokenBudget(maxTokens int) Option {
+	return func(c *config) {
+		c.maxContextTokens = maxTokens
+	}
+}
+
+// WithTokenCounter 配置token计数器，默认使用 tiktoken cl100k_base
+func WithTokenCounter(counter TokenCounter) Option {
+	return func(c *config) {
+		c.tokenCounter = counter
+	}
+}
+
+// WithHistorySummary 超出token预算时使用LLM将较早的对话总结为摘要，而不是直接丢弃
+func WithHistorySummary(enable bool) Option {
+	return func(c *config) {
+		c.summarizeHistory = enable
+	}
+}
+
+// WithSystemPrompt 配置系统提示词，支持Go模板变量，如 {{.Date}}、{{.UserName}}、{{.Locale}}，见 PromptData，模板无效时使用 DefaultSystemPrompt
+func WithSystemPrompt(prompt string) Option {
+	return func(c *config) {
+		c.systemPrompt = prompt
+	}
+}
+
+// WithMaxToolIterations 配置工具调用循环中模型调用的最大次数
+func WithMaxToolIterations(maxIterations int) Option {
+	return func(c *config) {
+		if maxIterations <= 0 {
+			maxIterations = DefaultMaxToolIterations
+		}
+		c.maxToolIterations = maxIterations
+	}
+}
+
+// WithTools 注册自定义工具，启用MCP时与MCP工具一起提供给模型，技能可在 allowed-tools 中引用
+func WithTools(t ...tools.ITool) Option {
+	return func(c *config) {
+		c.tools = append(c.tools, t...)
+	}
+}
+
+// WithToolTimeout 配置工具调用默认超时时间，超时后取消工具执行并终止其子进程
+func WithToolTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.toolTimeout = timeout
+	}
+}
+
+// WithToolTimeoutFor 配置指定工具的超时时间，覆盖默认超时，0表示不限制
+func WithToolTimeoutFor(name string, timeout time.Duration) Option {
+	return func(c *config) {
+		if c.toolTimeouts == nil {
+			c.toolTimeouts = make(map[string]time.Duration)
+		}
+		c.toolTimeouts[name] = timeout
+	}
+}
+
+// WithWorkspace 限制技能 read_file、write_file 的访问范围，每个租户会话使用 workspace.Root 下的独立子目录，技能目录只读挂载；未配置时 Root 为系统临时目录下的 langchat-workspace
+func WithWorkspace(workspace *tools.Workspace) Option {
+	return func(c *config) {
+		c.workspace = workspace
+	}
+}
+
+// WithToolPolicy 配置工具调用审批策略，需要审批的工具调用会暂停执行并返回 *ApprovalRequiredError，
+// 用户决定后通过 Approver.Resume 继续，如 WithToolPolicy(RequireApproval("run_shell_code", "write_file"))
+func WithToolPolicy(policy ToolPolicy) Option {
+	return func(c *config) {
+		c.toolPolicy = policy
+	}
+}
+
+// WithApprovalStore 配置等待审批的工具调用存储，默认保存在内存中
+func WithApprovalStore(store ApprovalStore) Option {
+	return func(c *config) {
+		c.approvals = store
+	}
+}
+
+// WithSandbox 配置技能代码和脚本（run_shell_code、run_python_code 等）的执行沙箱，默认使用 tools.DefaultSandbox()
+func WithSandbox(sandbox *tools.Sandbox) Option {
+	return func(c *config) {
+		c.sandbox = sandbox
+	}
+}
+
+// WithHostExecution 不使用沙箱，直接在本机以服务进程的环境变量和网络执行技能代码（不推荐）
+func WithHostExecution() Option {
+	return func(c *config) {
+		c.hostExecution = true
+	}
+}
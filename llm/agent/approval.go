@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrApprovalNotFound is returned when a pending approval does not exist (unknown ID or already decided)
+var ErrApprovalNotFound = errors.New("approval not found")
+
+// ToolPolicy reports whether a tool call must be approved by the user before it runs
+type ToolPolicy func(ctx context.Context, call llms.ToolCall) bool
+
+// RequireApproval returns a policy requiring approval for the named tools, e.g. run_shell_code and write_file
+func RequireApproval(names ...string) ToolPolicy {
+	return func(_ context.Context, call llms.ToolCall) bool {
+		return call.FunctionCall != nil && slices.Contains(names, call.FunctionCall.Name)
+	}
+}
+
+type noApprovalKey struct{}
+
+// WithoutApproval returns a copy of ctx in which tool calls requiring approval are rejected instead of paused,
+// e.g. for stateless requests whose session does not outlive the request
+func WithoutApproval(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noApprovalKey{}, true)
+}
+
+// ApprovalDisabled reports whether ctx was created by WithoutApproval
+func ApprovalDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noApprovalKey{}).(bool)
+	return disabled
+}
+
+// ApprovalToolCall is a tool call waiting for approval
+type ApprovalToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ApprovalRequest is sent to the client when the agent pauses for approval
+type ApprovalRequest struct {
+	ID        string             `json:"id"`
+	SessionID string             `json:"sessionId"`
+	ToolCalls []ApprovalToolCall `json:"toolCalls"`
+	CreatedAt time.Time          `json:"createdAt"`
+}
+
+// ApprovalDecision is the user decision for all tool calls of an approval request
+type ApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PendingApproval is the persisted state of a tool loop paused for approval
+type PendingApproval struct {
+	ApprovalRequest
+	// Skill is the skill whose tools were running, empty for the registered tools
+	Skill string `json:"skill,omitempty"`
+	// Tenant is the tenant of the session, only the same tenant can decide
+	Tenant string `json:"tenant,omitempty"`
+	// Messages is the graph state at the pause including the input messages
+	Messages []llms.MessageContent `json:"messages"`
+	// InputLen is the number of input messages, the messages after it were produced by the loop
+	InputLen       int `json:"inputLen"`
+	IterationCount int `json:"iterationCount"`
+}
+
+// ApprovalRequiredError is returned by Chat and ChatStream when a tool call waits for approval.
+// The request is resumed with Approver.Resume.
+type ApprovalRequiredError struct {
+	Request ApprovalRequest
+	pending *PendingApproval
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	names := make([]string, 0, len(e.Request.ToolCalls))
+	for _, tc := range e.Request.ToolCalls {
+		names = append(names, tc.Name)
+	}
+	return fmt.Sprintf("tool calls %v wait for approval %s", names, e.Request.ID)
+}
+
+// Approver is implemented by agents that can pause tool calls for approval
+type Approver interface {
+	// Resume continues the paused request with the user decision and returns the final response.
+	// It may return another *ApprovalRequiredError when the model calls a tool requiring approval again.
+	Resume(ctx context.Context, approvalID string, decision ApprovalDecision, onChunk func(context.Context, []byte) error) (string, error)
+}
+
+// ApprovalStore persists paused tool loops until the decision arrives
+type ApprovalStore interface {
+	Save(ctx context.Context, pending *PendingApproval) error
+	// Load returns ErrApprovalNotFound when the approval does not exist
+	Load(ctx context.Context, id string) (*PendingApproval, error)
+	// Take loads and removes the approval atomically, only one caller gets it.
+	// It returns ErrApprovalNotFound when the approval does not exist or was already taken.
+	Take(ctx context.Context, id string) (*PendingApproval, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// newApprovalID generates a random approval ID
+func newApprovalID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MemoryApprovalStore keeps pending approvals in memory
+type MemoryApprovalStore struct {
+	mu      sync.Mutex
+	pending map[string]*PendingApproval
+}
+
+// NewMemoryApprovalStore creates an in-memory approval store
+func NewMemoryApprovalStore() *MemoryApprovalStore {
+	return &MemoryApprovalStore{
+		pending: make(map[string]*PendingApproval),
+	}
+}
+
+func (s *MemoryApprovalStore) Save(_ context.Context, pending *PendingApproval) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[pending.ID] = pending
+	return nil
+}
+
+func (s *MemoryApprovalStore) Load(_ context.Context, id string) (*PendingApproval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending, ok := s.pending[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	return pending, nil
+}
+
+func (s *MemoryApprovalStore) Take(_ context.Context, id string) (*PendingApproval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending, ok := s.pending[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	delete(s.pending, id)
+	return pending, nil
+}
+
+func (s *MemoryApprovalStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+	return nil
+}
+
+// FileApprovalStore stores each pending approval as a JSON file in a directory,
+// so a decision can arrive after a server restart
+type FileApprovalStore struct {
+	dir string
+}
+
+// NewFileApprovalStore creates a file based approval store in dir, creating the directory if needed
+func NewFileApprovalStore(dir string) (*FileApprovalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create approval directory '%s': %w", dir, err)
+	}
+	return &FileApprovalStore{dir: dir}, nil
+}
+
+func (s *FileApprovalStore) file(id string) (string, error) {
+	if id == "" {
+		return "", errors.New("approval ID is empty")
+	}
+	return filepath.Join(s.dir, sessionFileName(id)+".json"), nil
+}
+
+func (s *FileApprovalStore) Save(_ context.Context, pending *PendingApproval) error {
+	path, err := s.file(pending.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to marshal approval: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write approval '%s': %w", pending.ID, err)
+	}
+	return nil
+}
+
+func (s *FileApprovalStore) Load(_ context.Context, id string) (*PendingApproval, error) {
+	path, err := s.file(id)
+	if err != nil {
+		return nil, err
+	}
+	return readApproval(path, id)
+}
+
+func (s *FileApprovalStore) Take(_ context.Context, id string) (*PendingApproval, error) {
+	path, err := s.file(id)
+	if err != nil {
+		return nil, err
+	}
+	// Renaming is atomic, only one caller moves the file away
+	taken := path + "." + newApprovalID() + ".taken"
+	if err := os.Rename(path, taken); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to take approval '%s': %w", id, err)
+	}
+	defer os.Remove(taken)
+	return readApproval(taken, id)
+}
+
+// readApproval decodes the approval file path
+func readApproval(path string, id string) (*PendingApproval, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval '%s': %w", id, err)
+	}
+	var pending PendingApproval
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to decode approval '%s': %w", id, err)
+	}
+	return &pending, nil
+}
+
+func (s *FileApprovalStore) Delete(_ context.Context, id string) error {
+	path, err := s.file(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete approval '%s': %w", id, err)
+	}
+	return nil
+}
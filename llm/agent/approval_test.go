@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/tools"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestReactAgentApproval(t *testing.T) {
+	tests := []struct {
+		name       string
+		decision   ApprovalDecision
+		wantInputs int
+		wantResult string
+	}{
+		{"approved", ApprovalDecision{Approved: true}, 1, "echo: a"},
+		{"rejected", ApprovalDecision{Approved: false, Reason: "too risky"}, 0, "too risky"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &scriptedModel{responses: []*llms.ContentResponse{
+				toolCallResponse("call_1", `{"input":"a"}`),
+				{Choices: []*llms.ContentChoice{{Content: "done"}}},
+			}}
+			tool := &echoTool{}
+			newAgent := func() *ReactAgent {
+				return NewReactAgent(model, nil, ReactWithTools([]tools.ITool{tool}), ReactWithMaxIterations(5),
+					ReactSupportTool(true), ReactWithToolPolicy(RequireApproval("echo")))
+			}
+
+			ctx := WithSessionID(context.Background(), "s1")
+			_, err := newAgent().Run(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+			var approval *ApprovalRequiredError
+			if !errors.As(err, &approval) {
+				t.Fatalf("Expected ApprovalRequiredError, got %v", err)
+			}
+			if len(tool.inputs) != 0 {
+				t.Fatalf("Expected the tool not to run before approval, got %v", tool.inputs)
+			}
+			req := approval.Request
+			if req.ID == "" || req.SessionID != "s1" || len(req.ToolCalls) != 1 || req.ToolCalls[0].Name != "echo" {
+				t.Errorf("Unexpected approval request: %+v", req)
+			}
+
+			// The paused state survives a round trip through the file store
+			store, err := NewFileApprovalStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(ctx, approval.pending); err != nil {
+				t.Fatal(err)
+			}
+			pending, err := store.Load(ctx, req.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A new agent resumes the loop
+			produced, err := newAgent().Resume(ctx, pending, tt.decision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tool.inputs) != tt.wantInputs {
+				t.Errorf("Expected %d tool calls, got %v", tt.wantInputs, tool.inputs)
+			}
+			if len(produced) != 3 {
+				t.Fatalf("Expected tool call, tool response and answer, got %+v", produced)
+			}
+			resp := produced[1].Parts[0].(llms.ToolCallResponse)
+			if resp.ToolCallID != "call_1" || !strings.Contains(resp.Content, tt.wantResult) {
+				t.Errorf("Unexpected tool response: %+v", resp)
+			}
+			if lastText(produced) != "done" {
+				t.Errorf("Expected final answer 'done', got %q", lastText(produced))
+			}
+		})
+	}
+}
+
+func TestReactAgentWithoutApproval(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		toolCallResponse("call_1", `{"input":"a"}`),
+		{Choices: []*llms.ContentChoice{{Content: "done"}}},
+	}}
+	tool := &echoTool{}
+	agent := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{tool}), ReactWithMaxIterations(5),
+		ReactSupportTool(true), ReactWithToolPolicy(RequireApproval("echo")))
+
+	ctx := WithoutApproval(WithSessionID(context.Background(), "s1"))
+	produced, err := agent.Run(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	if err != nil {
+		t.Fatalf("Expected the tool call to be rejected without pausing, got %v", err)
+	}
+	if len(tool.inputs) != 0 {
+		t.Errorf("Expected the tool not to run, got %v", tool.inputs)
+	}
+	if len(produced) != 3 {
+		t.Fatalf("Expected tool call, tool response and answer, got %+v", produced)
+	}
+	if resp := produced[1].Parts[0].(llms.ToolCallResponse); !strings.Contains(resp.Content, "not available") {
+		t.Errorf("Unexpected tool response: %+v", resp)
+	}
+}
+
+func TestReactAgentApprovalRequiredAgain(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		toolCallResponse("call_1", `{"input":"a"}`),
+		toolCallResponse("call_1", `{"input":"b"}`),
+	}}
+	tool := &echoTool{}
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{tool}), ReactWithMaxIterations(5),
+		ReactSupportTool(true), ReactWithToolPolicy(RequireApproval("echo")))
+
+	_, err := rac.Run(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	var approval *ApprovalRequiredError
+	if !errors.As(err, &approval) {
+		t.Fatalf("Expected ApprovalRequiredError, got %v", err)
+	}
+	// The next tool call needs its own approval even with a reused tool call ID
+	_, err = rac.Resume(context.Background(), approval.pending, ApprovalDecision{Approved: true})
+	if !errors.As(err, &approval) {
+		t.Fatalf("Expected a second ApprovalRequiredError, got %v", err)
+	}
+	if len(tool.inputs) != 1 || tool.inputs[0] != "a" {
+		t.Errorf("Expected only the approved call to run, got %v", tool.inputs)
+	}
+	if approval.pending.InputLen != 1 {
+		t.Errorf("Expected the input length to be kept, got %d", approval.pending.InputLen)
+	}
+}
+
+func TestTextChatAgentResume(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		toolCallResponse("call_1", `{"input":"a"}`),
+		{Choices: []*llms.ContentChoice{{Content: "done"}}},
+	}}
+	store := NewMemoryConversationStore()
+	a := NewTextChatAgent(model, ModelToolSupport(true), WithTools(&echoTool{}), WithConversationStore(store),
+		WithToolPolicy(RequireApproval("echo")))
+	defer a.Close()
+
+	ctx := WithSessionID(context.Background(), "s1")
+	_, err := a.Chat(ctx, "hi", false, true)
+	var approval *ApprovalRequiredError
+	if !errors.As(err, &approval) {
+		t.Fatalf("Expected ApprovalRequiredError, got %v", err)
+	}
+
+	other := WithTenant(context.Background(), "other")
+	if _, err := a.Resume(other, approval.Request.ID, ApprovalDecision{Approved: true}, nil); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("Expected ErrApprovalNotFound for another tenant, got %v", err)
+	}
+
+	resp, err := a.Resume(context.Background(), approval.Request.ID, ApprovalDecision{Approved: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "done" {
+		t.Errorf("Expected 'done', got %q", resp)
+	}
+	history, _ := store.Load(ctx, "s1")
+	// user message, tool call, tool response, answer
+	if len(history) != 4 {
+		t.Errorf("Expected 4 persisted messages, got %d", len(history))
+	}
+
+	if _, err := a.Resume(context.Background(), approval.Request.ID, ApprovalDecision{Approved: true}, nil); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("Expected ErrApprovalNotFound for a decided approval, got %v", err)
+	}
+}
+
+func TestApprovalStoreTake(t *testing.T) {
+	fileStore, err := NewFileApprovalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]ApprovalStore{"memory": NewMemoryApprovalStore(), "file": fileStore} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := store.Save(ctx, &PendingApproval{ApprovalRequest: ApprovalRequest{ID: "a1", SessionID: "s1"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Concurrent decisions, only one gets the approval
+			var taken atomic.Int32
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Go(func() {
+					pending, err := store.Take(ctx, "a1")
+					switch {
+					case err == nil && pending.SessionID == "s1":
+						taken.Add(1)
+					case !errors.Is(err, ErrApprovalNotFound):
+						t.Errorf("Expected ErrApprovalNotFound, got %v", err)
+					}
+				})
+			}
+			wg.Wait()
+			if taken.Load() != 1 {
+				t.Errorf("Expected the approval to be taken once, got %d", taken.Load())
+			}
+			if _, err := store.Load(ctx, "a1"); !errors.Is(err, ErrApprovalNotFound) {
+				t.Errorf("Expected the approval to be removed, got %v", err)
+			}
+		})
+	}
+}
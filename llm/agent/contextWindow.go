@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// summaryPrefix marks the rolling summary system message
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// messageTokenOverhead approximates the tokens used by role and message framing
+const messageTokenOverhead = 4
+
+// TokenCounter counts the tokens of a text
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// TiktokenCounter counts tokens with a tiktoken encoding.
+// If the encoding cannot be loaded (e.g. offline) it falls back to an estimate.
+type TiktokenCounter struct {
+	encoding string
+	once     sync.Once
+	enc      *tiktoken.Tiktoken
+}
+
+// NewTiktokenCounter creates a token counter for the given tiktoken encoding, e.g. cl100k_base
+func NewTiktokenCounter(encoding string) *TiktokenCounter {
+	return &TiktokenCounter{encoding: encoding}
+}
+
+func (c *TiktokenCounter) CountTokens(text string) int {
+	c.once.Do(func() {
+		enc, err := tiktoken.GetEncoding(c.encoding)
+		if err != nil {
+			log.Printf("Failed to load tiktoken encoding '%s', falling back to approximate token count: %v", c.encoding, err)
+			return
+		}
+		c.enc = enc
+	})
+	if c.enc == nil {
+		return EstimateTokens(text)
+	}
+	return len(c.enc.EncodeOrdinary(text))
+}
+
+// EstimateTokens approximates the token count of a text:
+// about 4 ASCII characters per token and one token per non-ASCII character (e.g. CJK)
+func EstimateTokens(text string) int {
+	ascii := 0
+	other := 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// countMessageTokens counts the tokens of a message including tool calls and tool responses
+func countMessageTokens(counter TokenCounter, msg llms.MessageContent) int {
+	tokens := messageTokenOverhead
+	for _, part := range msg.Parts {
+		switch p := part.(type) {
+		case llms.TextContent:
+			tokens += counter.CountTokens(p.Text)
+		case llms.ToolCall:
+			if p.FunctionCall != nil {
+				tokens += counter.CountTokens(p.FunctionCall.Name) + counter.CountTokens(p.FunctionCall.Arguments)
+			}
+		case llms.ToolCallResponse:
+			tokens += counter.CountTokens(p.Name) + counter.CountTokens(p.Content)
+		}
+	}
+	return tokens
+}
+
+// hasToolCall reports whether the message contains a tool call
+func hasToolCall(msg llms.MessageContent) bool {
+	for _, part := range msg.Parts {
+		if _, ok := part.(llms.ToolCall); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// latestToolGroup returns the bounds [from, to) of the latest tool call message after skip and its tool responses,
+// from is -1 when there is none
+func latestToolGroup(messages []llms.MessageContent, skip int) (from, to int) {
+	for i := len(messages) - 1; i >= skip; i-- {
+		if messages[i].Role == llms.ChatMessageTypeAI && hasToolCall(messages[i]) {
+			to = i + 1
+			for to < len(messages) && messages[to].Role == llms.ChatMessageTypeTool {
+				to++
+			}
+			return i, to
+		}
+	}
+	return -1, -1
+}
+
+// leadingSystemMessages returns the number of system messages (the system prompt) at the start of messages
+func leadingSystemMessages(messages []llms.MessageContent) int {
+	head := 0
+	for head < len(messages) && messages[head].Role == llms.ChatMessageTypeSystem {
+		head++
+	}
+	return head
+}
+
+// contextMessages returns the session history that fits into the configured token budget.
+// Older turns are dropped from the model context (the session history itself is kept) and,
+// when summarization is enabled, folded into a rolling summary system message.
+// The leading system prompt, the latest tool call with its responses, whatever turn it belongs to,
+// and the latest message are always preserved, a tool call is never kept without its responses.
+// The messages produced by the tool calling loop are trimmed by fitContext.
+func (a *TextChatAgent) contextMessages(ctx context.Context, session *Session) []llms.MessageContent {
+	budget := a.cfg.maxContextTokens
+	if budget <= 0 {
+		return session.messages
+	}
+	counter := a.cfg.tokenCounter
+
+	messages := session.messages
+	// Leading system messages (the system prompt) are always kept
+	head := leadingSystemMessages(messages)
+	start := max(session.contextStart, head)
+	groupFrom, groupTo := latestToolGroup(messages, head)
+
+	tokens := make([]int, len(messages))
+	for i, msg := range messages {
+		tokens[i] = countMessageTokens(counter, msg)
+	}
+	sum := func(from, to int) int {
+		total := 0
+		for i := from; i < to; i++ {
+			total += tokens[i]
+		}
+		return total
+	}
+	// pinned returns the latest tool call group when it is before cut
+	pinned := func(cut int) []llms.MessageContent {
+		if groupFrom < 0 || groupFrom >= cut {
+			return nil
+		}
+		return messages[groupFrom:min(groupTo, cut)]
+	}
+	headTokens := sum(0, head)
+	pinnedTokens := 0
+	if groupFrom >= 0 && groupFrom < start {
+		pinnedTokens = sum(groupFrom, min(groupTo, start))
+	}
+	kept := sum(start, len(messages))
+	summaryTokens := 0
+	if session.summary != "" {
+		summaryTokens = counter.CountTokens(summaryPrefix+session.summary) + messageTokenOverhead
+	}
+	if headTokens+summaryTokens+pinnedTokens+kept <= budget {
+		return buildContext(messages[:head], session.summary, pinned(start), messages[start:])
+	}
+
+	// The cut can not go past the latest message, nor into the latest tool call group when it ends the history
+	limit := len(messages) - 1
+	if groupFrom >= start && groupTo == len(messages) {
+		limit = groupFrom
+	}
+	// Reserve room for the summary that will replace the dropped turns
+	reserve := 0
+	if a.cfg.summarizeHistory {
+		reserve = budget / 5
+	}
+	cut := start
+	for cut < limit && headTokens+reserve+pinnedTokens+kept > budget {
+		if cut == groupFrom {
+			// The latest tool call group is pinned instead of dropped
+			for ; cut < groupTo; cut++ {
+				kept -= tokens[cut]
+				pinnedTokens += tokens[cut]
+			}
+			continue
+		}
+		kept -= tokens[cut]
+		cut++
+	}
+	// Do not start the context with tool responses whose tool call was dropped
+	for cut < limit && messages[cut].Role == llms.ChatMessageTypeTool {
+		cut++
+	}
+	if cut == start {
+		return buildContext(messages[:head], session.summary, pinned(start), messages[start:])
+	}
+
+	if a.cfg.summarizeHistory {
+		var dropped []llms.MessageContent
+		for i := start; i < cut; i++ {
+			if i < groupFrom || i >= groupTo {
+				dropped = append(dropped, messages[i])
+			}
+		}
+		summary, err := a.summarizeHistory(ctx, session.summary, dropped)
+		if err != nil {
+			log.Printf("History summarization failed, trimming instead: %v", err)
+		} else {
+			session.summary = summary
+		}
+	}
+	session.contextStart = cut
+	return buildContext(messages[:head], session.summary, pinned(cut), messages[cut:])
+}
+
+// fitContext drops the oldest messages until messages fit into the token budget, it is applied to the
+// messages of every model call of the tool calling loop. The leading system messages, the latest tool call
+// with its responses and the latest message are kept, a tool call is dropped together with its responses.
+func fitContext(counter TokenCounter, budget int, messages []llms.MessageContent) []llms.MessageContent {
+	if budget <= 0 || len(messages) == 0 {
+		return messages
+	}
+	tokens := make([]int, len(messages))
+	total := 0
+	for i, msg := range messages {
+		tokens[i] = countMessageTokens(counter, msg)
+		total += tokens[i]
+	}
+	if total <= budget {
+		return messages
+	}
+
+	head := leadingSystemMessages(messages)
+	groupFrom, _ := latestToolGroup(messages, head)
+	drop := make([]bool, len(messages))
+	for i := head; i < len(messages) && total > budget; {
+		// A tool call and its responses are dropped together
+		end := i + 1
+		if messages[i].Role == llms.ChatMessageTypeAI && hasToolCall(messages[i]) {
+			for end < len(messages) && messages[end].Role == llms.ChatMessageTypeTool {
+				end++
+			}
+		}
+		if i != groupFrom && end < len(messages) {
+			for j := i; j < end; j++ {
+				drop[j] = true
+				total -= tokens[j]
+			}
+		}
+		i = end
+	}
+	ret := make([]llms.MessageContent, 0, len(messages))
+	for i, msg := range messages {
+		if !drop[i] {
+			ret = append(ret, msg)
+		}
+	}
+	return ret
+}
+
+// buildContext assembles the model context from the system prompt, the rolling summary,
+// the pinned tool call group and the recent turns
+func buildContext(head []llms.MessageContent, summary string, pinned, recent []llms.MessageContent) []llms.MessageContent {
+	ret := make([]llms.MessageContent, 0, len(head)+len(pinned)+len(recent)+1)
+	ret = append(ret, head...)
+	if summary != "" {
+		ret = append(ret, llms.TextParts(llms.ChatMessageTypeSystem, summaryPrefix+summary))
+	}
+	ret = append(ret, pinned...)
+	return append(ret, recent...)
+}
+
+// summarizeHistory asks the LLM to fold the dropped turns into the rolling summary
+func (a *TextChatAgent) summarizeHistory(ctx context.Context, previous string, dropped []llms.MessageContent) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range dropped {
+		for _, part := range msg.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				transcript.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, p.Text))
+			case llms.ToolCall:
+				if p.FunctionCall != nil {
+					transcript.WriteString(fmt.Sprintf("%s called tool %s with %s\n", msg.Role, p.FunctionCall.Name, p.FunctionCall.Arguments))
+				}
+			case llms.ToolCallResponse:
+				transcript.WriteString(fmt.Sprintf("tool %s returned: %s\n", p.Name, p.Content))
+			}
+		}
+	}
+
+	var prompt strings.Builder
+	if previous != "" {
+		prompt.WriteString("Existing summary:\n")
+		prompt.WriteString(previous)
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("New conversation turns:\n")
+	prompt.WriteString(transcript.String())
+	prompt.WriteString("\nUpdate the summary so it covers the existing summary and the new turns. Keep facts, decisions, names, numbers and open tasks. Return only the summary.")
+
+	response, err := a.llm.GenerateContent(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You are a helpful assistant that summarizes conversations concisely."),
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt.String()),
+	})
+	emitUsage(ctx, response)
+	if err != nil {
+		return "", fmt.Errorf("LLM call failed for history summary: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no response from LLM")
+	}
+	return strings.TrimSpace(response.Choices[0].Content), nil
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// wordCounter counts one token per word
+type wordCounter struct{}
+
+func (wordCounter) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+// summaryModel answers every call with a fixed summary and records the prompts
+type summaryModel struct {
+	calls [][]llms.MessageContent
+}
+
+func (m *summaryModel) GenerateContent(_ context.Context, messages []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls = append(m.calls, messages)
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "user asked about go"}}}, nil
+}
+
+func (m *summaryModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func newContextTestSession() *Session {
+	return &Session{
+		ID: "test",
+		messages: []llms.MessageContent{
+			llms.TextParts(llms.ChatMessageTypeSystem, "system prompt"),
+			llms.TextParts(llms.ChatMessageTypeHuman, "one two three four five six seven eight"),
+			llms.TextParts(llms.ChatMessageTypeAI, "one two three four five six seven eight"),
+			{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{
+				ID: "call_1", Type: "function",
+				FunctionCall: &llms.FunctionCall{Name: "search", Arguments: "go"},
+			}}},
+			{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{
+				ToolCallID: "call_1", Name: "search", Content: "one two three four five six seven eight",
+			}}},
+			llms.TextParts(llms.ChatMessageTypeHuman, "and then"),
+		},
+	}
+}
+
+func TestContextMessagesWithinBudget(t *testing.T) {
+	a := &TextChatAgent{cfg: &config{maxContextTokens: 1000, tokenCounter: wordCounter{}}}
+	session := newContextTestSession()
+	if got := a.contextMessages(context.Background(), session); len(got) != len(session.messages) {
+		t.Errorf("Expected full history within budget, got %d of %d messages", len(got), len(session.messages))
+	}
+}
+
+func TestContextMessagesTrim(t *testing.T) {
+	a := &TextChatAgent{cfg: &config{maxContextTokens: 31, tokenCounter: wordCounter{}}}
+	session := newContextTestSession()
+
+	got := a.contextMessages(context.Background(), session)
+	if got[0].Role != llms.ChatMessageTypeSystem {
+		t.Fatalf("Expected system prompt to be kept first, got %s", got[0].Role)
+	}
+	// The tool call and its response are kept together
+	if len(got) != 4 || !hasToolCall(got[1]) || got[2].Role != llms.ChatMessageTypeTool {
+		t.Errorf("Expected [system, tool call, tool response, human], got %+v", got)
+	}
+	if len(session.messages) != 6 {
+		t.Errorf("Expected session history to be kept, got %d messages", len(session.messages))
+	}
+
+	// The latest tool call is kept with its response even when it belongs to an earlier turn
+	a.cfg.maxContextTokens = 20
+	session = newContextTestSession()
+	got = a.contextMessages(context.Background(), session)
+	if len(got) != 4 || !hasToolCall(got[1]) || got[3].Role != llms.ChatMessageTypeHuman {
+		t.Errorf("Expected [system, tool call, tool response, human], got %+v", got)
+	}
+}
+
+func TestContextMessagesTrimCurrentToolCall(t *testing.T) {
+	a := &TextChatAgent{cfg: &config{maxContextTokens: 20, tokenCounter: wordCounter{}}}
+	session := newContextTestSession()
+	// the tool calling loop of the current turn
+	session.messages = append(session.messages,
+		llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{
+			ID: "call_2", Type: "function",
+			FunctionCall: &llms.FunctionCall{Name: "search", Arguments: "then"},
+		}}},
+		llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{
+			ToolCallID: "call_2", Name: "search", Content: "one two three four five six seven eight",
+		}}},
+	)
+
+	got := a.contextMessages(context.Background(), session)
+	if len(got) != 3 || !hasToolCall(got[1]) || got[2].Role != llms.ChatMessageTypeTool {
+		t.Errorf("Expected [system, tool call, tool response], got %+v", got)
+	}
+}
+
+func TestContextMessagesBudgetAfterToolCall(t *testing.T) {
+	const budget = 40
+	counter := wordCounter{}
+	a := &TextChatAgent{cfg: &config{maxContextTokens: budget, tokenCounter: counter}}
+	session := newContextTestSession()
+
+	// many turns after an early tool call
+	for i := 0; i < 50; i++ {
+		session.messages = append(session.messages,
+			llms.TextParts(llms.ChatMessageTypeAI, "one two three four five"),
+			llms.TextParts(llms.ChatMessageTypeHuman, "one two three four five"),
+		)
+		got := a.contextMessages(context.Background(), session)
+		total := 0
+		for _, msg := range got {
+			total += countMessageTokens(counter, msg)
+		}
+		if total > budget {
+			t.Fatalf("Expected the context to fit the budget of %d tokens after %d turns, got %d", budget, i+1, total)
+		}
+	}
+	if session.contextStart <= 4 {
+		t.Errorf("Expected the context to start after the early tool call, got %d", session.contextStart)
+	}
+	// the early tool call is pinned in front of the recent turns
+	if got := a.contextMessages(context.Background(), session); !hasToolCall(got[1]) || got[2].Role != llms.ChatMessageTypeTool {
+		t.Errorf("Expected the early tool call to be kept, got %+v", got[:3])
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	toolCall := func(id string) llms.MessageContent {
+		return llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{
+			ID: id, Type: "function", FunctionCall: &llms.FunctionCall{Name: "search", Arguments: "go"},
+		}}}
+	}
+	toolResponse := func(id string) llms.MessageContent {
+		return llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{
+			ToolCallID: id, Name: "search", Content: "one two three four five six seven eight",
+		}}}
+	}
+	// the messages of a tool calling loop growing past the budget
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "system prompt"),
+		llms.TextParts(llms.ChatMessageTypeHuman, "search three times"),
+		toolCall("call_1"), toolResponse("call_1"),
+		toolCall("call_2"), toolResponse("call_2"),
+		toolCall("call_3"), toolResponse("call_3"),
+	}
+	counter := wordCounter{}
+	got := fitContext(counter, 40, messages)
+	total := 0
+	for _, msg := range got {
+		total += countMessageTokens(counter, msg)
+	}
+	if total > 40 {
+		t.Errorf("Expected the messages to fit 40 tokens, got %d", total)
+	}
+	// the oldest tool calls are dropped with their responses, the latest one is kept
+	if len(got) != 3 || got[0].Role != llms.ChatMessageTypeSystem || got[1].Parts[0].(llms.ToolCall).ID != "call_3" || got[2].Role != llms.ChatMessageTypeTool {
+		t.Errorf("Expected [system, call_3, response], got %+v", got)
+	}
+	if got := fitContext(counter, 0, messages); len(got) != len(messages) {
+		t.Errorf("Expected no trimming without a budget, got %d messages", len(got))
+	}
+}
+
+func TestContextMessagesSummary(t *testing.T) {
+	model := &summaryModel{}
+	a := &TextChatAgent{llm: model, cfg: &config{maxContextTokens: 40, tokenCounter: wordCounter{}, summarizeHistory: true}}
+	session := newContextTestSession()
+
+	got := a.contextMessages(context.Background(), session)
+	if len(model.calls) != 1 {
+		t.Fatalf("Expected one summary call, got %d", len(model.calls))
+	}
+	if session.summary != "user asked about go" {
+		t.Errorf("Expected summary to be stored, got '%s'", session.summary)
+	}
+	if got[1].Role != llms.ChatMessageTypeSystem || !strings.HasPrefix(got[1].Parts[0].(llms.TextContent).Text, summaryPrefix) {
+		t.Errorf("Expected summary system message after the system prompt, got %+v", got[1])
+	}
+	last := got[len(got)-1]
+	if last.Parts[0].(llms.TextContent).Text != "and then" {
+		t.Errorf("Expected latest message to be kept, got %+v", last)
+	}
+
+	// Within budget now, the summary is reused without another LLM call
+	a.contextMessages(context.Background(), session)
+	if len(model.calls) != 1 {
+		t.Errorf("Expected summary to be reused, got %d calls", len(model.calls))
+	}
+}
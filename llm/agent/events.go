@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// EventType is the type of a chat event
+type EventType string
+
+const (
+	// EventToken is a chunk of the model answer
+	EventToken EventType = "token"
+	// EventToolCallStart is sent when the model calls a tool
+	EventToolCallStart EventType = "tool_call_start"
+	// EventToolCallArgs carries the arguments of a tool call
+	EventToolCallArgs EventType = "tool_call_args"
+	// EventToolResult carries the result of a tool call
+	EventToolResult EventType = "tool_result"
+	// EventNodeStart is sent when a graph node starts
+	EventNodeStart EventType = "node_start"
+	// EventNodeEnd is sent when a graph node ends
+	EventNodeEnd EventType = "node_end"
+	// EventSkillSelected is sent when a skill is selected for the message
+	EventSkillSelected EventType = "skill_selected"
+	// EventUsage carries the token usage of a model call
+	EventUsage EventType = "usage"
+	// EventError is sent when the chat fails
+	EventError EventType = "error"
+)
+
+// Event is a typed chat event, only the fields of its type are set
+type Event struct {
+	Type EventType `json:"type"`
+	// Content is the token text
+	Content string `json:"content,omitempty"`
+	// Node is the graph node of node_start and node_end
+	Node       string `json:"node,omitempty"`
+	ToolCallID string `json:"toolCallId,omitempty"`
+	ToolName   string `json:"toolName,omitempty"`
+	Arguments  string `json:"arguments,omitempty"`
+	Result     string `json:"result,omitempty"`
+	// IsError reports whether the tool call failed
+	IsError bool   `json:"isError,omitempty"`
+	Skill   string `json:"skill,omitempty"`
+	Usage   *Usage `json:"usage,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Usage is the token usage of a model call
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// EventHandler receives the chat events
+type EventHandler func(ctx context.Context, event Event)
+
+type eventHandlerKey struct{}
+
+// WithEventHandler returns a copy of ctx carrying a handler for the chat events.
+// The handlers already carried by ctx still receive the events after it.
+// Tokens are still delivered to the onChunk callback of ChatStream.
+func WithEventHandler(ctx context.Context, handler EventHandler) context.Context {
+	if parent, ok := ctx.Value(eventHandlerKey{}).(EventHandler); ok && parent != nil {
+		next := handler
+		handler = func(ctx context.Context, event Event) {
+			next(ctx, event)
+			parent(ctx, event)
+		}
+	}
+	return context.WithValue(ctx, eventHandlerKey{}, handler)
+}
+
+// EmitEvent sends an event to the handler carried by ctx, agents call it to report their progress
+func EmitEvent(ctx context.Context, event Event) {
+	if handler, ok := ctx.Value(eventHandlerKey{}).(EventHandler); ok && handler != nil {
+		handler(ctx, event)
+	}
+}
+
+// emitUsage sends the token usage reported by a model response
+func emitUsage(ctx context.Context, resp *llms.ContentResponse) {
+	if usage, ok := UsageFromResponse(resp); ok {
+		EmitEvent(ctx, Event{Type: EventUsage, Usage: &usage})
+	}
+}
+
+// UsageFromResponse reads the token usage from the generation info of a model response.
+// Providers report it as PromptTokens/CompletionTokens (OpenAI, Ollama) or InputTokens/OutputTokens (Anthropic).
+func UsageFromResponse(resp *llms.ContentResponse) (Usage, bool) {
+	if resp == nil || len(resp.Choices) == 0 {
+		return Usage{}, false
+	}
+	info := resp.Choices[0].GenerationInfo
+	prompt, okPrompt := intValue(info, "PromptTokens", "InputTokens")
+	completion, okCompletion := intValue(info, "CompletionTokens", "OutputTokens")
+	if !okPrompt && !okCompletion {
+		return Usage{}, false
+	}
+	total, ok := intValue(info, "TotalTokens")
+	if !ok {
+		total = prompt + completion
+	}
+	return Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: total}, true
+}
+
+// intValue returns the first numeric value found under keys
+func intValue(info map[string]any, keys ...string) (int, bool) {
+	for _, key := range keys {
+		switch v := info[key].(type) {
+		case int:
+			return v, true
+		case int32:
+			return int(v), true
+		case int64:
+			return int(v), true
+		case float64:
+			return int(v), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/tools"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestReactAgentEvents(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		toolCallResponse("call_1", `{"input":"a"}`),
+		{Choices: []*llms.ContentChoice{{
+			Content:        "done",
+			GenerationInfo: map[string]any{"PromptTokens": 10, "CompletionTokens": 2, "TotalTokens": 12},
+		}}},
+	}}
+	var content []string
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{&echoTool{}}), ReactWithMaxIterations(5), ReactSupportTool(true),
+		ReactWithStream(func(_ context.Context, chunk []byte) error {
+			content = append(content, string(chunk))
+			return nil
+		}))
+
+	var events []Event
+	ctx := WithEventHandler(context.Background(), func(_ context.Context, event Event) {
+		events = append(events, event)
+	})
+	if _, err := rac.Run(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []EventType{
+		EventNodeStart, EventToolCallStart, EventToolCallArgs, EventNodeEnd,
+		EventNodeStart, EventToolResult, EventNodeEnd,
+		EventNodeStart, EventUsage, EventNodeEnd,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(want), len(events), events)
+	}
+	for i, typ := range want {
+		if events[i].Type != typ {
+			t.Errorf("Event %d: expected %s, got %s", i, typ, events[i].Type)
+		}
+	}
+	if ev := events[2]; ev.ToolCallID != "call_1" || ev.ToolName != "echo" || ev.Arguments != `{"input":"a"}` {
+		t.Errorf("Unexpected tool_call_args event: %+v", ev)
+	}
+	if ev := events[5]; ev.Result != "echo: a" || ev.IsError {
+		t.Errorf("Unexpected tool_result event: %+v", ev)
+	}
+	if ev := events[8]; ev.Usage == nil || ev.Usage.TotalTokens != 12 {
+		t.Errorf("Unexpected usage event: %+v", ev)
+	}
+	for _, c := range content {
+		if strings.Contains(c, "tool result") {
+			t.Errorf("Expected tool results not to be streamed as content, got %q", c)
+		}
+	}
+}
+
+func TestUsageFromResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		info map[string]any
+		want Usage
+		ok   bool
+	}{
+		{"openai", map[string]any{"PromptTokens": 3, "CompletionTokens": 4, "TotalTokens": 7}, Usage{3, 4, 7}, true},
+		{"anthropic", map[string]any{"InputTokens": 5, "OutputTokens": 6}, Usage{5, 6, 11}, true},
+		{"float", map[string]any{"PromptTokens": float64(1), "CompletionTokens": float64(2)}, Usage{1, 2, 3}, true},
+		{"missing", map[string]any{}, Usage{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := UsageFromResponse(&llms.ContentResponse{Choices: []*llms.ContentChoice{{GenerationInfo: tt.info}}})
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Expected %+v (%v), got %+v (%v)", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestWithEventHandlerChain(t *testing.T) {
+	var got []string
+	ctx := WithEventHandler(context.Background(), func(_ context.Context, event Event) {
+		got = append(got, "outer:"+string(event.Type))
+	})
+	ctx = WithEventHandler(ctx, func(_ context.Context, event Event) {
+		got = append(got, "inner:"+string(event.Type))
+	})
+	EmitEvent(ctx, Event{Type: EventUsage})
+	if strings.Join(got, ",") != "inner:usage,outer:usage" {
+		t.Errorf("Expected both handlers to receive the event, got %v", got)
+	}
+}
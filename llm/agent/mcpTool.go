@@ -0,0 +1,18 @@
+package agent
+
+import (
+	"github.com/kinwyb/langchat/llm/tools"
+	"github.com/smallnest/langgraphgo/adapter/mcp"
+	tls "github.com/tmc/langchaingo/tools"
+)
+
+// newMCPTools wraps MCP tools as tools.ITool, tools without a schema are skipped
+func newMCPTools(mcpTools []tls.Tool) []tools.ITool {
+	var ret []tools.ITool
+	for _, t := range mcpTools {
+		if param, ok := mcp.GetToolSchema(t); ok {
+			ret = append(ret, tools.WrapTool(t, param))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultSystemPrompt is the system prompt used when none is configured
+const DefaultSystemPrompt = "You are a helpful AI assistant. Be concise and friendly."
+
+// PromptData is the data available to system prompt templates, e.g. "Today is {{.Date}}, reply in {{.Locale}}."
+type PromptData struct {
+	Date      string // 2006-01-02
+	Time      string // 15:04
+	Weekday   string
+	UserName  string
+	Locale    string
+	SessionID string
+}
+
+// SessionPrompt carries per-request prompt settings
+type SessionPrompt struct {
+	// SystemPrompt overrides the agent system prompt for the session.
+	// Overrides come from clients, only {{.Var}} substitutions of PromptData fields are allowed, see ValidatePromptOverride.
+	SystemPrompt string
+	// Literal uses SystemPrompt as plain text, it is not rendered as a template
+	Literal  bool
+	UserName string
+	Locale   string
+}
+
+type sessionPromptKey struct{}
+
+// WithSessionPrompt returns a copy of ctx carrying per-request prompt settings
+func WithSessionPrompt(ctx context.Context, prompt SessionPrompt) context.Context {
+	return context.WithValue(ctx, sessionPromptKey{}, prompt)
+}
+
+// SessionPromptFromContext returns the prompt settings carried by ctx
+func SessionPromptFromContext(ctx context.Context) SessionPrompt {
+	prompt, _ := ctx.Value(sessionPromptKey{}).(SessionPrompt)
+	return prompt
+}
+
+// ValidatePromptTemplate checks that a system prompt template can be parsed
+func ValidatePromptTemplate(text string) error {
+	_, err := template.New("system").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid system prompt template: %w", err)
+	}
+	return nil
+}
+
+// MaxPromptOverrideSize is the size limit of a system prompt override in bytes
+const MaxPromptOverrideSize = 16 * 1024
+
+// promptActionPattern matches the actions of a template, promptVariablePattern the {{.Var}} substitutions
+var (
+	promptActionPattern   = regexp.MustCompile(`{{.*?}}`)
+	promptVariablePattern = regexp.MustCompile(`^{{-? *\.([A-Za-z]+) *-?}}$`)
+)
+
+// ValidatePromptOverride checks a system prompt override sent by a client.
+// Unlike the configured prompt, an override is not a full template: loops, functions and pipelines
+// could use unbounded resources, only {{.Var}} substitutions of the PromptData fields are allowed.
+func ValidatePromptOverride(text string) error {
+	if len(text) > MaxPromptOverrideSize {
+		return fmt.Errorf("invalid system prompt: longer than %d bytes", MaxPromptOverrideSize)
+	}
+	data := reflect.TypeFor[PromptData]()
+	for _, action := range promptActionPattern.FindAllString(text, -1) {
+		m := promptVariablePattern.FindStringSubmatch(action)
+		if m == nil {
+			return fmt.Errorf("invalid system prompt: only variables such as {{.Date}} are allowed, got %s", action)
+		}
+		if _, ok := data.FieldByName(m[1]); !ok {
+			return fmt.Errorf("invalid system prompt: unknown variable %s", action)
+		}
+	}
+	// unterminated actions
+	if strings.Contains(promptActionPattern.ReplaceAllString(text, ""), "{{") {
+		return fmt.Errorf("invalid system prompt: unterminated action")
+	}
+	return ValidatePromptTemplate(text)
+}
+
+// RenderPromptOverride validates a system prompt override and executes it with data
+func RenderPromptOverride(text string, data PromptData) (string, error) {
+	if err := ValidatePromptOverride(text); err != nil {
+		return "", err
+	}
+	return RenderPrompt(text, data)
+}
+
+// RenderPrompt executes a system prompt template with data
+func RenderPrompt(text string, data PromptData) (string, error) {
+	tmpl, err := template.New("system").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid system prompt template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render system prompt: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// newPromptData builds the template data for a session
+func newPromptData(sessionID string, prompt SessionPrompt) PromptData {
+	now := time.Now()
+	return PromptData{
+		Date:      now.Format("2006-01-02"),
+		Time:      now.Format("15:04"),
+		Weekday:   now.Weekday().String(),
+		UserName:  prompt.UserName,
+		Locale:    prompt.Locale,
+		SessionID: sessionID,
+	}
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/llmtest"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	got, err := RenderPrompt("Hi {{.UserName}}, today is {{.Date}}, reply in {{.Locale}}.", PromptData{
+		Date:     "2025-01-02",
+		UserName: "Li",
+		Locale:   "zh-CN",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Hi Li, today is 2025-01-02, reply in zh-CN." {
+		t.Errorf("Unexpected prompt: %s", got)
+	}
+	if err := ValidatePromptTemplate("{{.Date"); err == nil {
+		t.Errorf("Expected invalid template error")
+	}
+}
+
+func TestValidatePromptOverride(t *testing.T) {
+	tests := []struct {
+		prompt string
+		valid  bool
+	}{
+		{"You are a pirate talking to {{.UserName}} on {{ .Date }}", true},
+		{"{{- .Locale -}} only", true},
+		{"No variables at all", true},
+		{"{{range 1000000000}}x{{end}}", false},
+		{"{{printf \"%0999999999d\" 1}}", false},
+		{"{{.Date | len}}", false},
+		{"{{.Secret}}", false},
+		{"{{.Date", false},
+		{"{{range\n1000}}x{{end}}", false},
+		{strings.Repeat("x", MaxPromptOverrideSize+1), false},
+	}
+	for _, tt := range tests {
+		if err := ValidatePromptOverride(tt.prompt); (err == nil) != tt.valid {
+			t.Errorf("Expected valid=%v for %.40q, got %v", tt.valid, tt.prompt, err)
+		}
+	}
+}
+
+func TestApplySystemPrompt(t *testing.T) {
+	a := &TextChatAgent{cfg: &config{systemPrompt: "Default assistant, today is {{.Date}}"}}
+	a.sessions = NewSessionManager(0, a.newSessionHistory)
+	defer a.sessions.Close()
+
+	ctx := context.Background()
+	session, err := a.sessions.Get(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemText := func() string {
+		return session.messages[0].Parts[0].(llms.TextContent).Text
+	}
+	if want := "Default assistant, today is " + time.Now().Format("2006-01-02"); systemText() != want {
+		t.Errorf("Expected '%s', got '%s'", want, systemText())
+	}
+
+	ctx = WithSessionPrompt(ctx, SessionPrompt{SystemPrompt: "You are a pirate talking to {{.UserName}}", UserName: "Jack"})
+	if err := a.applySystemPrompt(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	if systemText() != "You are a pirate talking to Jack" {
+		t.Errorf("Unexpected override prompt: %s", systemText())
+	}
+
+	// Overrides are limited to variables
+	loop := WithSessionPrompt(ctx, SessionPrompt{SystemPrompt: "{{range 10}}x{{end}}"})
+	if err := a.applySystemPrompt(loop, &Session{}); err == nil {
+		t.Errorf("Expected an error for a loop in the override")
+	}
+
+	// Literal overrides are not rendered
+	literal := WithSessionPrompt(ctx, SessionPrompt{SystemPrompt: "{{range 10}}x{{end}}", Literal: true})
+	other, err := a.sessions.Get(ctx, "s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.applySystemPrompt(literal, other); err != nil {
+		t.Fatal(err)
+	}
+	if text := other.messages[0].Parts[0].(llms.TextContent).Text; text != "{{range 10}}x{{end}}" {
+		t.Errorf("Expected the literal prompt, got '%s'", text)
+	}
+
+	// The override is kept for later requests of the same session
+	session.messages = append(session.messages, llms.TextParts(llms.ChatMessageTypeHuman, "hello"))
+	if err := a.applySystemPrompt(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(systemText(), "You are a pirate") || session.messages[0].Role != llms.ChatMessageTypeSystem {
+		t.Errorf("Expected override to persist, got '%s'", systemText())
+	}
+}
+
+func TestInvalidSystemPrompt(t *testing.T) {
+	model := llmtest.New(llmtest.Text("hi").Expecting(func(call llmtest.Call) error {
+		if call.Text(0) != DefaultSystemPrompt {
+			return fmt.Errorf("expected the default system prompt, got '%s'", call.Text(0))
+		}
+		return nil
+	}))
+	a := NewTextChatAgent(model, WithSystemPrompt("{{.Date"))
+	defer a.Close()
+
+	if _, err := a.Chat(context.Background(), "hello", false, false); err != nil {
+		t.Fatal(err)
+	}
+	model.AssertExpectations(t)
+}
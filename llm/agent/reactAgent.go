@@ -6,23 +6,30 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kinwyb/langchat/llm/skills"
 	"github.com/kinwyb/langchat/llm/tools"
 	"github.com/smallnest/langgraphgo/graph"
-	"github.com/smallnest/langgraphgo/prebuilt"
 	"github.com/tmc/langchaingo/llms"
-	tls "github.com/tmc/langchaingo/tools"
 )
 
+// ReactEvent is the type of the events streamed by ReactAgent.
+// The data is the node name for ReactNodeStart and ReactNodeEnd, the content chunk for ReactLLMContent
+// and the JSON encoded Event for the tool and usage events.
 type ReactEvent int
 
 const (
 	ReactNodeStart ReactEvent = iota + 1
 	ReactNodeEnd
 	ReactLLMContent
+	ReactToolCallStart
+	ReactToolCallArgs
+	ReactToolResult
+	ReactUsage
 )
 
 type ReactOption func(*ReactAgent)
@@ -55,7 +62,39 @@ func ReactWithStreamEvent(event func(context.Context, ReactEvent, []byte)) React
 
 func ReactWithTools(tool []tools.ITool) ReactOption {
 	return func(a *ReactAgent) {
-		a.inputTools = tool
+		a.inputTools = append(a.inputTools, tool...)
+	}
+}
+
+// ReactWithRegistry 使用注册表中的工具，可与 ReactWithTools 同时使用
+func ReactWithRegistry(registry *tools.Registry) ReactOption {
+	return func(a *ReactAgent) {
+		if registry != nil {
+			a.inputTools = append(a.inputTools, registry.Tools()...)
+		}
+	}
+}
+
+// ReactWithToolTimeout limits the execution time of each tool call, timeoutFor returns the timeout of a tool by name
+func ReactWithToolTimeout(timeoutFor func(name string) time.Duration) ReactOption {
+	return func(a *ReactAgent) {
+		a.toolTimeout = timeoutFor
+	}
+}
+
+// ReactWithToolPolicy pauses the loop before running tool calls the policy requires approval for,
+// Run then returns an *ApprovalRequiredError and the loop is continued with Resume
+func ReactWithToolPolicy(policy ToolPolicy) ReactOption {
+	return func(a *ReactAgent) {
+		a.toolPolicy = policy
+	}
+}
+
+// ReactWithContextLimit trims the messages of every model call, e.g. to a token budget.
+// The loop state keeps all messages.
+func ReactWithContextLimit(limit func(messages []llms.MessageContent) []llms.MessageContent) ReactOption {
+	return func(a *ReactAgent) {
+		a.contextLimit = limit
 	}
 }
 
@@ -71,8 +110,11 @@ func ReactWithMaxIterations(maxIterations int) ReactOption {
 type ReactAgent struct {
 	model         llms.Model
 	inputTools    []tools.ITool
-	toolExecutor  *prebuilt.ToolExecutor
+	tools         *tools.Registry
 	maxIterations int
+	toolTimeout   func(name string) time.Duration
+	toolPolicy    ToolPolicy
+	contextLimit  func([]llms.MessageContent) []llms.MessageContent
 	supportTool   bool
 	initLock      sync.Mutex
 	isInit        bool
@@ -104,12 +146,16 @@ func (r *ReactAgent) InitAgent() error {
 		r.maxIterations = 20
 	}
 
-	var inputTools []tls.Tool
+	// Register the tools, the first tool with a name wins
+	r.tools, _ = tools.NewRegistry()
 	for _, tool := range r.inputTools {
-		inputTools = append(inputTools, tool)
+		if r.toolTimeout != nil {
+			tool = tools.WithTimeout(tool, r.toolTimeout(tool.Name()))
+		}
+		if err := r.tools.Register(tool); err != nil {
+			log.Printf("Skip tool: %v", err)
+		}
 	}
-	// Define the tool executor
-	r.toolExecutor = prebuilt.NewToolExecutor(inputTools)
 
 	// Define the graph
 	workflow := graph.NewStateGraph[map[string]any]()
@@ -138,13 +184,26 @@ func (r *ReactAgent) streamEvent(ctx context.Context, event ReactEvent, data []b
 	r.streaming(ctx, event, data)
 }
 
+// emit sends an event to the stream callback and to the event handler of the context
+func (r *ReactAgent) emit(ctx context.Context, event ReactEvent, ev Event) {
+	var data []byte
+	switch event {
+	case ReactNodeStart, ReactNodeEnd:
+		data = []byte(ev.Node)
+	default:
+		data, _ = json.Marshal(ev)
+	}
+	r.streamEvent(ctx, event, data)
+	EmitEvent(ctx, ev)
+}
+
 // AgentNode 思考节点
 func (r *ReactAgent) agentNode(ctx context.Context, state map[string]any) (map[string]any, error) {
 	messages, ok := state["messages"].([]llms.MessageContent)
 	if !ok {
 		return nil, fmt.Errorf("messages key not found or invalid type")
 	}
-	r.streamEvent(ctx, ReactNodeStart, []byte("agent"))
+	r.emit(ctx, ReactNodeStart, Event{Type: EventNodeStart, Node: "agent"})
 	// Check iteration count
 	iterationCount := 0
 	if count, ok := state["iteration_count"].(int); ok {
@@ -158,6 +217,7 @@ func (r *ReactAgent) agentNode(ctx context.Context, state map[string]any) (map[s
 				llms.TextPart("Maximum iterations reached. Please try a simpler query."),
 			},
 		}
+		r.emit(ctx, ReactNodeEnd, Event{Type: EventNodeEnd, Node: "agent"})
 		return map[string]any{
 			"messages": []llms.MessageContent{finalMsg},
 		}, nil
@@ -166,7 +226,7 @@ func (r *ReactAgent) agentNode(ctx context.Context, state map[string]any) (map[s
 	// Convert tools to ToolInfo for the model
 	var toolDefs = r.initTool()
 
-	opts := []llms.CallOption{llms.WithTools(toolDefs)}
+	opts := append([]llms.CallOption{llms.WithTools(toolDefs)}, CallOptionsFromContext(ctx)...)
 	if r.streaming != nil {
 		opts = append(opts, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
 			r.streamEvent(ctx, ReactLLMContent, chunk)
@@ -175,11 +235,20 @@ func (r *ReactAgent) agentNode(ctx context.Context, state map[string]any) (map[s
 	}
 
 	// Call model with tools
+	if r.contextLimit != nil {
+		messages = r.contextLimit(messages)
+	}
 	resp, err := r.model.GenerateContent(ctx, messages, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	if resp == nil || len(resp.Choices) == 0 {
+		return nil, errors.New("no response from LLM")
+	}
+	if usage, ok := UsageFromResponse(resp); ok {
+		r.emit(ctx, ReactUsage, Event{Type: EventUsage, Usage: &usage})
+	}
 	choice := resp.Choices[0]
 	aiMsg := llms.MessageContent{
 		Role: llms.ChatMessageTypeAI,
@@ -189,8 +258,12 @@ func (r *ReactAgent) agentNode(ctx context.Context, state map[string]any) (map[s
 	}
 	for _, tc := range choice.ToolCalls {
 		aiMsg.Parts = append(aiMsg.Parts, tc)
+		if tc.FunctionCall != nil {
+			r.emit(ctx, ReactToolCallStart, Event{Type: EventToolCallStart, ToolCallID: tc.ID, ToolName: tc.FunctionCall.Name})
+			r.emit(ctx, ReactToolCallArgs, Event{Type: EventToolCallArgs, ToolCallID: tc.ID, ToolName: tc.FunctionCall.Name, Arguments: tc.FunctionCall.Arguments})
+		}
 	}
-	r.streamEvent(ctx, ReactNodeEnd, []byte("agent"))
+	r.emit(ctx, ReactNodeEnd, Event{Type: EventNodeEnd, Node: "agent"})
 	return map[string]any{
 		"messages":        []llms.MessageContent{aiMsg},
 		"iteration_count": iterationCount + 1,
@@ -206,28 +279,52 @@ func (r *ReactAgent) toolNode(ctx context.Context, state map[string]any) (map[st
 		return nil, fmt.Errorf("last message is not an AI message")
 	}
 
-	r.streamEvent(ctx, ReactNodeStart, []byte("tool"))
+	// Pause before running tool calls that need approval and have not been decided yet
+	resume := takeApprovalResume(ctx)
+	if r.toolPolicy != nil {
+		var waiting []ApprovalToolCall
+		for _, part := range lastMsg.Parts {
+			if tc, ok := part.(llms.ToolCall); ok && tc.FunctionCall != nil && r.toolPolicy(ctx, tc) && !resume.decided(tc.ID) {
+				waiting = append(waiting, ApprovalToolCall{ID: tc.ID, Name: tc.FunctionCall.Name, Arguments: tc.FunctionCall.Arguments})
+			}
+		}
+		if len(waiting) > 0 && ApprovalDisabled(ctx) {
+			// Nobody can decide, reject the calls
+			resume = &approvalResume{callIDs: make(map[string]bool), decision: ApprovalDecision{Reason: "approval is not available for this request"}}
+			for _, tc := range waiting {
+				resume.callIDs[tc.ID] = true
+			}
+		} else if len(waiting) > 0 {
+			return nil, &graph.NodeInterrupt{Node: "tools", Value: waiting}
+		}
+	}
+
+	r.emit(ctx, ReactNodeStart, Event{Type: EventNodeStart, Node: "tool"})
 
 	var toolMessages []llms.MessageContent
 	for _, part := range lastMsg.Parts {
 		if tc, ok := part.(llms.ToolCall); ok {
+			if resume.decided(tc.ID) && !resume.decision.Approved {
+				toolMsg := rejectedToolMessage(tc, resume.decision.Reason)
+				r.emit(ctx, ReactToolResult, Event{Type: EventToolResult, ToolCallID: tc.ID, ToolName: tc.FunctionCall.Name,
+					Result: toolMsg.Parts[0].(llms.ToolCallResponse).Content, IsError: true})
+				toolMessages = append(toolMessages, toolMsg)
+				continue
+			}
 			var args map[string]any
 			_ = json.Unmarshal([]byte(tc.FunctionCall.Arguments), &args)
 
-			inputVal := ""
-			if val, ok := args["input"].(string); ok {
+			// Legacy tools take {"input": "..."} as the bare string, tools with more arguments get the object
+			inputVal := tc.FunctionCall.Arguments
+			if val, ok := args["input"].(string); ok && len(args) == 1 {
 				inputVal = val
-			} else {
-				inputVal = tc.FunctionCall.Arguments
 			}
 
-			res, err := r.toolExecutor.Execute(ctx, prebuilt.ToolInvocation{
-				Tool:      tc.FunctionCall.Name,
-				ToolInput: inputVal,
-			})
+			res, err := r.tools.Call(ctx, tc.FunctionCall.Name, inputVal)
 			if err != nil {
 				res = fmt.Sprintf("Error: %v", err)
 			}
+			r.emit(ctx, ReactToolResult, Event{Type: EventToolResult, ToolCallID: tc.ID, ToolName: tc.FunctionCall.Name, Result: res, IsError: err != nil})
 
 			toolMsg := llms.MessageContent{
 				Role: llms.ChatMessageTypeTool,
@@ -239,12 +336,11 @@ func (r *ReactAgent) toolNode(ctx context.Context, state map[string]any) (map[st
 					},
 				},
 			}
-			r.streamEvent(ctx, ReactLLMContent, []byte("tool result: "+res))
 			toolMessages = append(toolMessages, toolMsg)
 		}
 	}
 
-	r.streamEvent(ctx, ReactNodeEnd, []byte("tool"))
+	r.emit(ctx, ReactNodeEnd, Event{Type: EventNodeEnd, Node: "tool"})
 
 	return map[string]any{
 		"messages": toolMessages,
@@ -288,7 +384,7 @@ func (r *ReactAgent) nodeConditionalEdge(ctx context.Context, state map[string]a
 					}
 					if toolDecision.UseTool {
 						// Find the selected tool
-						for _, tool := range r.inputTools {
+						for _, tool := range r.tools.Tools() {
 							if strings.EqualFold(tool.Name(), toolDecision.ToolName) {
 								log.Printf("Selected tool '%s' because: %s", toolDecision.ToolName, toolDecision.Reason)
 								argsJSON, _ := json.MarshalIndent(toolDecision.Args, "", "  ")
@@ -296,12 +392,19 @@ func (r *ReactAgent) nodeConditionalEdge(ctx context.Context, state map[string]a
 								if argsStr == "null" {
 									argsStr = "{}"
 								}
-								res, err := r.toolExecutor.Execute(ctx, prebuilt.ToolInvocation{
-									Tool:      toolDecision.ToolName,
-									ToolInput: argsStr,
-								})
-								if err != nil {
-									res = fmt.Sprintf("Error: %v", err)
+								var res string
+								var err error
+								call := llms.ToolCall{Type: "function", FunctionCall: &llms.FunctionCall{Name: tool.Name(), Arguments: argsStr}}
+								if r.toolPolicy != nil && r.toolPolicy(ctx, call) {
+									// Approval needs native tool calling to pause the graph, refuse the call instead
+									res = "Error: the tool requires user approval which is not supported without native tool calling"
+								} else {
+									r.emit(ctx, ReactToolCallStart, Event{Type: EventToolCallStart, ToolName: tool.Name()})
+									r.emit(ctx, ReactToolCallArgs, Event{Type: EventToolCallArgs, ToolName: tool.Name(), Arguments: argsStr})
+									if res, err = tool.Call(ctx, argsStr); err != nil {
+										res = fmt.Sprintf("Error: %v", err)
+									}
+									r.emit(ctx, ReactToolResult, Event{Type: EventToolResult, ToolName: tool.Name(), Result: res, IsError: err != nil})
 								}
 								aiMsg := llms.MessageContent{
 									Role: llms.ChatMessageTypeAI,
@@ -323,24 +426,15 @@ func (r *ReactAgent) nodeConditionalEdge(ctx context.Context, state map[string]a
 
 // Convert tools to ToolInfo for the model
 func (r *ReactAgent) initTool() []llms.Tool {
-	if len(r.inputTools) < 1 {
+	if r.tools.Len() < 1 {
 		return nil
 	}
 	var toolDefs []llms.Tool
 	if r.supportTool {
-		for _, t := range r.inputTools {
-			toolDefs = append(toolDefs, llms.Tool{
-				Type: "function",
-				Function: &llms.FunctionDefinition{
-					Name:        t.Name(),
-					Description: t.Description(),
-					Parameters:  t.Paramters(),
-				},
-			})
-		}
+		toolDefs = r.tools.Definitions()
 	} else {
 		var toolsInfo strings.Builder
-		for _, tool := range r.inputTools {
+		for _, tool := range r.tools.Tools() {
 			if strings.HasPrefix(tool.Name(), "run_") {
 				continue
 			}
@@ -369,7 +463,10 @@ If not use tool normal return content
 	return toolDefs
 }
 
-func (r *ReactAgent) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+// Run executes the agent loop (model call, tool calls, tool results, model call again ...) and
+// returns the messages produced after the input messages, in order: assistant tool call
+// messages, tool responses and the final assistant message.
+func (r *ReactAgent) Run(ctx context.Context, messages []llms.MessageContent) ([]llms.MessageContent, error) {
 	if !r.isInit {
 		err := r.InitAgent()
 		if err != nil {
@@ -377,17 +474,120 @@ func (r *ReactAgent) GenerateContent(ctx context.Context, messages []llms.Messag
 		}
 	}
 	r.initTool()
-	ms := append(r.message, messages...)
+	ms := slices.Concat(r.message, messages)
 	initialState := map[string]any{
 		"messages": ms,
 	}
-	ret, err := r.runnable.Invoke(ctx, initialState)
+	return r.invoke(ctx, initialState, len(ms), nil)
+}
+
+// Resume continues a loop paused for approval. Approved tool calls are executed, rejected ones
+// are answered with the rejection so the model can react. It returns the messages produced after
+// the original input messages, like Run.
+func (r *ReactAgent) Resume(ctx context.Context, pending *PendingApproval, decision ApprovalDecision) ([]llms.MessageContent, error) {
+	if !r.isInit {
+		err := r.InitAgent()
+		if err != nil {
+			return nil, err
+		}
+	}
+	resume := &approvalResume{callIDs: make(map[string]bool), decision: decision}
+	for _, tc := range pending.ToolCalls {
+		resume.callIDs[tc.ID] = true
+	}
+	state := map[string]any{
+		"messages":        pending.Messages,
+		"iteration_count": pending.IterationCount,
+	}
+	return r.invoke(ctx, state, pending.InputLen, &graph.Config{
+		ResumeFrom:  []string{"tools"},
+		ResumeValue: resume,
+	})
+}
+
+// invoke runs the graph and returns the messages after the first inputLen messages.
+// A pause for approval is returned as *ApprovalRequiredError carrying the graph state.
+func (r *ReactAgent) invoke(ctx context.Context, state map[string]any, inputLen int, config *graph.Config) ([]llms.MessageContent, error) {
+	ret, err := r.runnable.InvokeWithConfig(ctx, state, config)
+	var interrupt *graph.GraphInterrupt
+	if errors.As(err, &interrupt) {
+		waiting, _ := interrupt.InterruptValue.([]ApprovalToolCall)
+		messages, _ := ret["messages"].([]llms.MessageContent)
+		iterationCount, _ := ret["iteration_count"].(int)
+		pending := &PendingApproval{
+			ApprovalRequest: ApprovalRequest{
+				ID:        newApprovalID(),
+				SessionID: SessionIDFromContext(ctx),
+				ToolCalls: waiting,
+				CreatedAt: time.Now(),
+			},
+			Messages:       messages,
+			InputLen:       inputLen,
+			IterationCount: iterationCount,
+		}
+		return nil, &ApprovalRequiredError{Request: pending.ApprovalRequest, pending: pending}
+	}
 	if err != nil {
 		return nil, err
 	}
+	result, ok := ret["messages"].([]llms.MessageContent)
+	if !ok || len(result) < inputLen {
+		return nil, errors.New("no messages found")
+	}
+	return result[inputLen:], nil
+}
+
+// approvalResume is the resume value of the graph carrying the decision for the paused tool calls
+type approvalResume struct {
+	callIDs  map[string]bool
+	decision ApprovalDecision
+	used     bool
+}
+
+// takeApprovalResume returns the resume value once, for the first tools node run after a resume.
+// Later tool calls need a new approval even if the model reuses tool call IDs.
+func takeApprovalResume(ctx context.Context) *approvalResume {
+	resume, _ := graph.GetResumeValue(ctx).(*approvalResume)
+	if resume == nil || resume.used {
+		return nil
+	}
+	resume.used = true
+	return resume
+}
+
+// decided reports whether the tool call was part of the approval being resumed
+func (a *approvalResume) decided(toolCallID string) bool {
+	return a != nil && a.callIDs[toolCallID]
+}
+
+// rejectedToolMessage answers a rejected tool call
+func rejectedToolMessage(tc llms.ToolCall, reason string) llms.MessageContent {
+	content := "The user rejected this tool call."
+	if reason != "" {
+		content += " Reason: " + reason
+	}
+	return llms.MessageContent{
+		Role: llms.ChatMessageTypeTool,
+		Parts: []llms.ContentPart{
+			llms.ToolCallResponse{
+				ToolCallID: tc.ID,
+				Name:       tc.FunctionCall.Name,
+				Content:    content,
+			},
+		},
+	}
+}
+
+func (r *ReactAgent) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	produced, err := r.Run(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	if len(produced) == 0 {
+		return nil, errors.New("no messages found")
+	}
 	// Print Result
-	messages = ret["messages"].([]llms.MessageContent)
-	lastMsg := messages[len(messages)-1]
+	lastMsg := produced[len(produced)-1]
 	if len(lastMsg.Parts) > 0 {
 		if textPart, ok := lastMsg.Parts[0].(llms.TextContent); ok {
 			return &llms.ContentResponse{Choices: []*llms.ContentChoice{
@@ -398,21 +598,12 @@ func (r *ReactAgent) GenerateContent(ctx context.Context, messages []llms.Messag
 	return nil, errors.New("no messages found")
 }
 
-// skillDoTask skill 执行
-func skillDoTask(ctx context.Context, model llms.Model, skill *skills.Skill, toolSupport bool, message string, onChunk func(ctx context.Context, data []byte) error) (string, error) {
+// skillDoTask skill 执行，extraTools 为技能可用的注册工具，与技能工具同名时技能工具优先
+func skillDoTask(ctx context.Context, model llms.Model, skill *skills.Skill, extraTools []tools.ITool, toolSupport bool, message string, onChunk func(ctx context.Context, data []byte) error, extraOpts ...ReactOption) (string, error) {
 	if skill == nil {
 		return "", errors.New("skill is nil")
 	}
-	skillPropemt := fmt.Sprintf("Skill: %s\n%s\n\n", skill.Package.Meta.Name, skill.Package.Body)
-	opts := []ReactOption{
-		ReactWithTools(skill.Tools),
-		ReactWithMaxIterations(5),
-		ReactSupportTool(toolSupport),
-	}
-	if onChunk != nil {
-		opts = append(opts, ReactWithStream(onChunk))
-	}
-	rac := NewReactAgent(model, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, skillPropemt)}, opts...)
+	rac := newSkillAgent(model, skill, extraTools, toolSupport, onChunk, extraOpts...)
 	response, err := rac.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, message)})
 	if err != nil {
 		return "", err
@@ -425,3 +616,35 @@ func skillDoTask(ctx context.Context, model llms.Model, skill *skills.Skill, too
 
 	return responseText, nil
 }
+
+// newSkillAgent creates the ReAct agent running a skill
+func newSkillAgent(model llms.Model, skill *skills.Skill, extraTools []tools.ITool, toolSupport bool, onChunk func(ctx context.Context, data []byte) error, extraOpts ...ReactOption) *ReactAgent {
+	skillPropemt := fmt.Sprintf("Skill: %s\n%s\n\n", skill.Package.Meta.Name, skill.Package.Body)
+	if resources := skills.ResourcesPrompt(skill.Package); resources != "" {
+		skillPropemt += resources + "\n"
+	}
+	opts := []ReactOption{
+		ReactWithTools(skill.Tools),
+		ReactWithTools(extraTools),
+		ReactWithMaxIterations(5),
+		ReactSupportTool(toolSupport),
+	}
+	if onChunk != nil {
+		opts = append(opts, ReactWithStream(onChunk))
+	}
+	opts = append(opts, extraOpts...)
+	return NewReactAgent(model, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, skillPropemt)}, opts...)
+}
+
+// lastText returns the text of the last message
+func lastText(messages []llms.MessageContent) string {
+	var text string
+	if len(messages) > 0 {
+		for _, part := range messages[len(messages)-1].Parts {
+			if textPart, ok := part.(llms.TextContent); ok {
+				text += textPart.Text
+			}
+		}
+	}
+	return text
+}
@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/llmtest"
+	"github.com/kinwyb/langchat/llm/tools"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// scriptedModel returns the scripted responses in order
+type scriptedModel struct {
+	responses []*llms.ContentResponse
+	calls     [][]llms.MessageContent
+}
+
+func (m *scriptedModel) GenerateContent(_ context.Context, messages []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls = append(m.calls, messages)
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return resp, nil
+}
+
+func (m *scriptedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// echoTool returns its input
+type echoTool struct {
+	inputs []string
+}
+
+func (t *echoTool) Name() string                     { return "echo" }
+func (t *echoTool) Description() string              { return "Echo the input" }
+func (t *echoTool) Paramters() any                   { return map[string]any{"type": "object"} }
+func (t *echoTool) DescriptionWithParamters() string { return t.Description() }
+func (t *echoTool) Call(_ context.Context, input string) (string, error) {
+	t.inputs = append(t.inputs, input)
+	return "echo: " + input, nil
+}
+
+func toolCallResponse(id string, arguments string) *llms.ContentResponse {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		ToolCalls: []llms.ToolCall{{
+			ID:           id,
+			Type:         "function",
+			FunctionCall: &llms.FunctionCall{Name: "echo", Arguments: arguments},
+		}},
+	}}}
+}
+
+func TestReactAgentRunToolLoop(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		toolCallResponse("call_1", `{"input":"a"}`),
+		toolCallResponse("call_2", `{"input":"b"}`),
+		{Choices: []*llms.ContentChoice{{Content: "done"}}},
+	}}
+	tool := &echoTool{}
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{tool}), ReactWithMaxIterations(5), ReactSupportTool(true))
+
+	produced, err := rac.Run(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(model.calls) != 3 {
+		t.Errorf("Expected 3 model calls, got %d", len(model.calls))
+	}
+	if len(tool.inputs) != 2 || tool.inputs[0] != "a" || tool.inputs[1] != "b" {
+		t.Errorf("Unexpected tool inputs: %v", tool.inputs)
+	}
+	wantRoles := []llms.ChatMessageType{
+		llms.ChatMessageTypeAI, llms.ChatMessageTypeTool,
+		llms.ChatMessageTypeAI, llms.ChatMessageTypeTool,
+		llms.ChatMessageTypeAI,
+	}
+	if len(produced) != len(wantRoles) {
+		t.Fatalf("Expected %d messages, got %d: %+v", len(wantRoles), len(produced), produced)
+	}
+	for i, role := range wantRoles {
+		if produced[i].Role != role {
+			t.Errorf("Message %d: expected role %s, got %s", i, role, produced[i].Role)
+		}
+	}
+	if resp := produced[3].Parts[0].(llms.ToolCallResponse); resp.ToolCallID != "call_2" || resp.Content != "echo: b" {
+		t.Errorf("Unexpected tool response: %+v", resp)
+	}
+	// The second model call sees the first tool call and its result
+	if n := len(model.calls[1]); n != 3 {
+		t.Errorf("Expected 3 messages in the second call, got %d", n)
+	}
+}
+
+func TestReactAgentFuncToolInputField(t *testing.T) {
+	type replaceArgs struct {
+		Input string `json:"input"`
+		Old   string `json:"old"`
+		New   string `json:"new"`
+	}
+	replace := tools.NewFunc("replace", "Replace text", func(_ context.Context, args replaceArgs) (string, error) {
+		return strings.ReplaceAll(args.Input, args.Old, args.New), nil
+	})
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		{Choices: []*llms.ContentChoice{{ToolCalls: []llms.ToolCall{{ID: "call_1", Type: "function",
+			FunctionCall: &llms.FunctionCall{Name: "replace", Arguments: `{"input":"hello world","old":"world","new":"go"}`}}}}}},
+		{Choices: []*llms.ContentChoice{{Content: "done"}}},
+	}}
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{replace}), ReactWithMaxIterations(5), ReactSupportTool(true))
+
+	produced, err := rac.Run(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the object with an input field is passed as is
+	if resp := produced[1].Parts[0].(llms.ToolCallResponse); resp.Content != "hello go" {
+		t.Errorf("Expected 'hello go', got %q", resp.Content)
+	}
+}
+
+func TestReactAgentContextLimit(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		toolCallResponse("call_1", `{"input":"a"}`),
+		toolCallResponse("call_2", `{"input":"b"}`),
+		{Choices: []*llms.ContentChoice{{Content: "done"}}},
+	}}
+	// keep the latest tool call group only
+	limit := func(messages []llms.MessageContent) []llms.MessageContent {
+		return fitContext(wordCounter{}, 1, messages)
+	}
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{&echoTool{}}), ReactWithMaxIterations(5),
+		ReactSupportTool(true), ReactWithContextLimit(limit))
+
+	produced, err := rac.Run(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(produced) != 5 {
+		t.Errorf("Expected the loop state to keep all messages, got %d", len(produced))
+	}
+	// every model call is trimmed, the last one sees the second tool call only
+	last := model.calls[2]
+	if len(last) != 2 || last[0].Parts[0].(llms.ToolCall).ID != "call_2" {
+		t.Errorf("Expected [call_2, response], got %+v", last)
+	}
+}
+
+func TestReactAgentMaxIterations(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		toolCallResponse("call_1", `{"input":"a"}`),
+		toolCallResponse("call_2", `{"input":"b"}`),
+	}}
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{&echoTool{}}), ReactWithMaxIterations(2), ReactSupportTool(true))
+
+	resp, err := rac.GenerateContent(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Content != "Maximum iterations reached. Please try a simpler query." {
+		t.Errorf("Unexpected response: %s", resp.Choices[0].Content)
+	}
+}
+
+func TestReactAgentStream(t *testing.T) {
+	model := llmtest.New(
+		llmtest.ToolCall("echo", `{"input":"a"}`),
+		llmtest.Stream("do", "ne"),
+	)
+	tool := &echoTool{}
+	var streamed strings.Builder
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{tool}), ReactWithMaxIterations(5), ReactSupportTool(true),
+		ReactWithStream(func(_ context.Context, chunk []byte) error {
+			streamed.Write(chunk)
+			return nil
+		}))
+
+	produced, err := rac.Run(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastText(produced); got != "done" {
+		t.Errorf("Expected final answer 'done', got '%s'", got)
+	}
+	if streamed.String() != "done" {
+		t.Errorf("Expected 'done' to be streamed, got '%s'", streamed.String())
+	}
+	model.AssertExpectations(t)
+}
+
+func TestReactAgentTextToolSelection(t *testing.T) {
+	model := llmtest.New(
+		llmtest.Text(`{"use_tool": true, "tool_name": "echo", "args": {"input": "a"}, "reason": "echo it"}`).
+			Expecting(llmtest.ExpectContains("- echo: Echo the input")),
+		llmtest.Text("done").Expecting(llmtest.ExpectLastText("echo:")),
+	)
+	tool := &echoTool{}
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{tool}), ReactWithMaxIterations(5))
+
+	produced, err := rac.Run(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tool.inputs) != 1 || !strings.Contains(tool.inputs[0], `"a"`) {
+		t.Errorf("Unexpected tool inputs: %v", tool.inputs)
+	}
+	if got := lastText(produced); got != "done" {
+		t.Errorf("Expected final answer 'done', got '%s'", got)
+	}
+	model.AssertExpectations(t)
+}
+
+func TestReactAgentModelError(t *testing.T) {
+	errDown := errors.New("model down")
+	model := llmtest.New(llmtest.ToolCall("echo", `{"input":"a"}`), llmtest.Fail(errDown))
+	rac := NewReactAgent(model, nil, ReactWithTools([]tools.ITool{&echoTool{}}), ReactWithMaxIterations(5), ReactSupportTool(true))
+
+	if _, err := rac.Run(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")}); !errors.Is(err, errDown) {
+		t.Errorf("Expected the model error, got %v", err)
+	}
+	model.AssertCalls(t, 2)
+}
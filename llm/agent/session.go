@@ -0,0 +1,252 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// DefaultSessionID is used when the context carries no session ID
+const DefaultSessionID = "default"
+
+// DefaultSessionIdleTimeout is how long an untouched session is kept in memory
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+// ErrInvalidSessionID is returned for client provided session IDs which cannot be scoped to a tenant
+var ErrInvalidSessionID = errors.New("invalid session ID: '/' is not allowed")
+
+// ValidateSessionID checks a client provided session ID, "/" is reserved to separate the tenant in TenantSessionKey
+func ValidateSessionID(sessionID string) error {
+	if strings.Contains(sessionID, "/") {
+		return ErrInvalidSessionID
+	}
+	return nil
+}
+
+type sessionIDKey struct{}
+
+// WithSessionID returns a copy of ctx carrying the conversation session ID
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionID)
+}
+
+// SessionIDFromContext returns the session ID carried by ctx, or DefaultSessionID
+func SessionIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(sessionIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultSessionID
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant of the caller.
+// Sessions, conversation history, workspaces and approvals are scoped to the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx, empty for the default tenant
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// TenantSessionKey returns the key of a tenant session in the session manager and the conversation store,
+// the session ID itself for the default tenant. Session IDs must not contain "/", see ValidateSessionID.
+func TenantSessionKey(tenant, sessionID string) string {
+	if tenant == "" {
+		return sessionID
+	}
+	return tenant + "/" + sessionID
+}
+
+// sessionKey returns the key of the session carried by ctx
+func sessionKey(ctx context.Context) string {
+	return TenantSessionKey(TenantFromContext(ctx), SessionIDFromContext(ctx))
+}
+
+// Session holds the conversation history of a single caller
+type Session struct {
+	ID string
+	// mu serializes the turns of the session, turns of different sessions run in parallel
+	mu         sync.Mutex
+	messages   []llms.MessageContent
+	lastActive time.Time
+	// busy counts the turns holding or waiting for the session, busy sessions are not evicted
+	busy int
+	// contextStart is the index of the first message still sent to the model,
+	// earlier messages were trimmed or folded into summary
+	contextStart int
+	summary      string
+	// prompt holds the prompt overrides of the session
+	prompt SessionPrompt
+}
+
+// Messages returns a copy of the session history
+func (s *Session) Messages() []llms.MessageContent {
+	return append([]llms.MessageContent(nil), s.messages...)
+}
+
+// SessionManager keys conversation histories by session ID.
+// Sessions are created lazily on first use and evicted after being idle for too long.
+type SessionManager struct {
+	mu          sync.Mutex
+	sessions    map[string]*Session
+	idleTimeout time.Duration
+	newHistory  func(ctx context.Context, sessionID string) ([]llms.MessageContent, error)
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewSessionManager creates a session manager.
+// newHistory builds the initial history of a new session (e.g. the system prompt followed by
+// the messages restored from a ConversationStore). A non-positive idleTimeout disables eviction.
+func NewSessionManager(idleTimeout time.Duration, newHistory func(ctx context.Context, sessionID string) ([]llms.MessageContent, error)) *SessionManager {
+	m := &SessionManager{
+		sessions:    make(map[string]*Session),
+		idleTimeout: idleTimeout,
+		newHistory:  newHistory,
+		stop:        make(chan struct{}),
+	}
+	if idleTimeout > 0 {
+		go m.janitor()
+	}
+	return m
+}
+
+// Get returns the session with the given ID, creating it if needed
+func (m *SessionManager) Get(ctx context.Context, sessionID string) (*Session, error) {
+	if sessionID == "" {
+		sessionID = DefaultSessionID
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		s = &Session{ID: sessionID}
+		if m.newHistory != nil {
+			messages, err := m.newHistory(ctx, sessionID)
+			if err != nil {
+				return nil, err
+			}
+			s.messages = messages
+		}
+		m.sessions[sessionID] = s
+	}
+	s.lastActive = time.Now()
+	return s, nil
+}
+
+// Acquire returns the session with the given ID locked for a turn, creating it if needed.
+// Turns of the same session are serialized, the returned release func unlocks the session.
+func (m *SessionManager) Acquire(ctx context.Context, sessionID string) (*Session, func(), error) {
+	s, err := m.Get(ctx, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.mu.Lock()
+	s.busy++
+	m.mu.Unlock()
+	s.mu.Lock()
+	release := func() {
+		s.mu.Unlock()
+		m.mu.Lock()
+		s.busy--
+		s.lastActive = time.Now()
+		m.mu.Unlock()
+	}
+	return s, release, nil
+}
+
+// Delete removes the session with the given ID
+func (m *SessionManager) Delete(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sessionID)
+}
+
+// Len returns the number of live sessions
+func (m *SessionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// EvictIdle removes sessions that have not been used since now minus the idle timeout
+func (m *SessionManager) EvictIdle(now time.Time) int {
+	if m.idleTimeout <= 0 {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	evicted := 0
+	for id, s := range m.sessions {
+		if s.busy == 0 && now.Sub(s.lastActive) > m.idleTimeout {
+			delete(m.sessions, id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Close stops the background eviction
+func (m *SessionManager) Close() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+}
+
+// janitor periodically evicts idle sessions
+func (m *SessionManager) janitor() {
+	interval := m.idleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			if n := m.EvictIdle(now); n > 0 {
+				log.Printf("Evicted %d idle sessions", n)
+			}
+		}
+	}
+}
+
+type historyKey struct{}
+
+// WithHistory returns a copy of ctx carrying the prior messages of a new session.
+// Stateless clients (e.g. the OpenAI compatible API) send the whole conversation with every request,
+// the messages replace the history restored from the conversation store.
+func WithHistory(ctx context.Context, messages []llms.MessageContent) context.Context {
+	return context.WithValue(ctx, historyKey{}, messages)
+}
+
+// HistoryFromContext returns the prior messages carried by ctx
+func HistoryFromContext(ctx context.Context) ([]llms.MessageContent, bool) {
+	messages, ok := ctx.Value(historyKey{}).([]llms.MessageContent)
+	return messages, ok
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions returns a copy of ctx carrying model call options (e.g. llms.WithTemperature)
+// applied to the calls answering the user
+func WithCallOptions(ctx context.Context, opts ...llms.CallOption) context.Context {
+	return context.WithValue(ctx, callOptionsKey{}, opts)
+}
+
+// CallOptionsFromContext returns the model call options carried by ctx
+func CallOptionsFromContext(ctx context.Context) []llms.CallOption {
+	opts, _ := ctx.Value(callOptionsKey{}).([]llms.CallOption)
+	return opts
+}
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kinwyb/langchat/llm/tools"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestSessionIDFromContext(t *testing.T) {
+	if got := SessionIDFromContext(context.Background()); got != DefaultSessionID {
+		t.Errorf("Expected default session ID, got '%s'", got)
+	}
+	ctx := WithSessionID(context.Background(), "abc")
+	if got := SessionIDFromContext(ctx); got != "abc" {
+		t.Errorf("Expected session ID 'abc', got '%s'", got)
+	}
+}
+
+func TestSessionManagerIsolation(t *testing.T) {
+	m := NewSessionManager(0, func(context.Context, string) ([]llms.MessageContent, error) {
+		return []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, "system")}, nil
+	})
+	defer m.Close()
+
+	ctx := context.Background()
+	a, _ := m.Get(ctx, "a")
+	a.messages = append(a.messages, llms.TextParts(llms.ChatMessageTypeHuman, "hello"))
+	b, _ := m.Get(ctx, "b")
+
+	if len(a.Messages()) != 2 {
+		t.Errorf("Expected 2 messages in session a, got %d", len(a.Messages()))
+	}
+	if len(b.Messages()) != 1 {
+		t.Errorf("Expected 1 message in session b, got %d", len(b.Messages()))
+	}
+	if again, _ := m.Get(ctx, "a"); again != a {
+		t.Errorf("Expected the same session to be returned for the same ID")
+	}
+	if m.Len() != 2 {
+		t.Errorf("Expected 2 sessions, got %d", m.Len())
+	}
+}
+
+func TestSessionManagerEvictIdle(t *testing.T) {
+	m := NewSessionManager(time.Hour, nil)
+	defer m.Close()
+
+	m.Get(context.Background(), "old")
+	m.Get(context.Background(), "new")
+	m.sessions["old"].lastActive = time.Now().Add(-2 * time.Hour)
+
+	if n := m.EvictIdle(time.Now()); n != 1 {
+		t.Errorf("Expected 1 evicted session, got %d", n)
+	}
+	if m.Len() != 1 {
+		t.Errorf("Expected 1 session left, got %d", m.Len())
+	}
+	if _, ok := m.sessions["new"]; !ok {
+		t.Errorf("Expected session 'new' to be kept")
+	}
+}
+
+func TestSessionManagerKeepsBusySessions(t *testing.T) {
+	m := NewSessionManager(time.Hour, nil)
+	defer m.Close()
+
+	s, release, err := m.Acquire(context.Background(), "busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.lastActive = time.Now().Add(-2 * time.Hour)
+	if n := m.EvictIdle(time.Now()); n != 0 {
+		t.Errorf("Expected busy session to be kept, got %d evicted", n)
+	}
+	release()
+	if n := m.EvictIdle(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Errorf("Expected released session to be evicted, got %d evicted", n)
+	}
+}
+
+// concurrentModel answers with the last user message, it is safe for concurrent use.
+// It records the highest number of calls in flight, calls wait for each other up to the latency.
+type concurrentModel struct {
+	latency time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	calls       int
+}
+
+func (m *concurrentModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.mu.Lock()
+	m.inFlight++
+	m.calls++
+	m.maxInFlight = max(m.maxInFlight, m.inFlight)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+		m.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(m.latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	last := messages[len(messages)-1].Parts[0].(llms.TextContent).Text
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "re: " + last}}}, nil
+}
+
+func (m *concurrentModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestTextChatAgentConcurrentSessions(t *testing.T) {
+	model := &concurrentModel{latency: 50 * time.Millisecond}
+	a := NewTextChatAgent(model)
+	defer a.Close()
+
+	const sessions, turns = 8, 3
+	var wg sync.WaitGroup
+	errs := make(chan error, sessions*turns)
+	for i := range sessions {
+		for j := range turns {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx := WithSessionID(context.Background(), fmt.Sprintf("s%d", i))
+				message := fmt.Sprintf("message %d", j)
+				resp, err := a.Chat(ctx, message, false, false)
+				if err == nil && resp != "re: "+message {
+					err = fmt.Errorf("expected 're: %s', got '%s'", message, resp)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if model.calls != sessions*turns {
+		t.Errorf("Expected %d model calls, got %d", sessions*turns, model.calls)
+	}
+	// Sessions run in parallel, the turns of a session do not
+	if model.maxInFlight < 2 || model.maxInFlight > sessions {
+		t.Errorf("Expected between 2 and %d calls in flight, got %d", sessions, model.maxInFlight)
+	}
+	for i := range sessions {
+		session, err := a.sessions.Get(context.Background(), fmt.Sprintf("s%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages := session.Messages()
+		// system prompt followed by a question and an answer per turn
+		if len(messages) != 1+2*turns {
+			t.Fatalf("Expected %d messages in session s%d, got %d", 1+2*turns, i, len(messages))
+		}
+		for k := 1; k < len(messages); k += 2 {
+			if messages[k].Role != llms.ChatMessageTypeHuman || messages[k+1].Role != llms.ChatMessageTypeAI {
+				t.Errorf("Expected interleaved questions and answers in session s%d, got %+v", i, messages)
+				break
+			}
+		}
+	}
+}
+
+func TestTextChatAgentHistoryFromContext(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		{Choices: []*llms.ContentChoice{{Content: "blue"}}},
+	}}
+	store := NewMemoryConversationStore()
+	_ = store.Append(context.Background(), "s1", llms.TextParts(llms.ChatMessageTypeHuman, "stored"))
+	a := NewTextChatAgent(model, WithConversationStore(store))
+	defer a.Close()
+
+	ctx := WithSessionID(context.Background(), "s1")
+	ctx = WithHistory(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "my favourite color is blue"),
+		llms.TextParts(llms.ChatMessageTypeAI, "noted"),
+	})
+	if _, err := a.Chat(ctx, "what is my favourite color?", false, false); err != nil {
+		t.Fatal(err)
+	}
+	// system prompt, the 2 history messages and the question replace the stored history
+	sent := model.calls[0]
+	if len(sent) != 4 || sent[1].Parts[0].(llms.TextContent).Text != "my favourite color is blue" {
+		t.Errorf("Expected the history from the context to be sent, got %+v", sent)
+	}
+}
+
+func TestTextChatAgentTenantSessions(t *testing.T) {
+	model := &scriptedModel{responses: []*llms.ContentResponse{
+		{Choices: []*llms.ContentChoice{{Content: "hi a"}}},
+		{Choices: []*llms.ContentChoice{{Content: "hi b"}}},
+	}}
+	store := NewMemoryConversationStore()
+	a := NewTextChatAgent(model, WithConversationStore(store))
+	defer a.Close()
+
+	ctxA := WithSessionID(WithTenant(context.Background(), "a"), "s1")
+	ctxB := WithSessionID(WithTenant(context.Background(), "b"), "s1")
+	if _, err := a.Chat(ctxA, "secret of a", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Chat(ctxB, "hello", false, false); err != nil {
+		t.Fatal(err)
+	}
+	// system prompt and the message of tenant b only
+	if sent := model.calls[1]; len(sent) != 2 {
+		t.Errorf("Expected tenant b not to see the history of tenant a, got %+v", sent)
+	}
+	if history, _ := store.Load(context.Background(), TenantSessionKey("a", "s1")); len(history) != 2 {
+		t.Errorf("Expected 2 messages stored for tenant a, got %d", len(history))
+	}
+}
+
+func TestSessionWorkspace(t *testing.T) {
+	root := t.TempDir()
+	configured := NewTextChatAgent(&scriptedModel{}, WithWorkspace(&tools.Workspace{Root: root}))
+	defer configured.Close()
+	unconfigured := NewTextChatAgent(&scriptedModel{})
+	defer unconfigured.Close()
+
+	tests := []struct {
+		agent *TextChatAgent
+		key   string
+		want  string
+	}{
+		{configured, TenantSessionKey("a", "s1"), filepath.Join(root, "a%2Fs1")},
+		{configured, TenantSessionKey("b", "s1"), filepath.Join(root, "b%2Fs1")},
+		{configured, "..", filepath.Join(root, "%2E%2E")},
+		{unconfigured, TenantSessionKey("a", "s1"), filepath.Join(os.TempDir(), "langchat-workspace", "a%2Fs1")},
+	}
+	for _, tt := range tests {
+		ws := tools.WorkspaceFromContext(tt.agent.withSessionWorkspace(context.Background(), tt.key))
+		if ws == nil || ws.Root != tt.want {
+			t.Errorf("Expected workspace %s for %s, got %+v", tt.want, tt.key, ws)
+		}
+	}
+}
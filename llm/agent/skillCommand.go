@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/kinwyb/langchat/llm/skills"
+	"github.com/tmc/langchaingo/llms"
+)
+
+var (
+	// ErrSkillNotFound is returned when the skill requested with WithSkillName is not loaded
+	ErrSkillNotFound = errors.New("skill not found")
+	// ErrSkillsDisabled is returned when a skill is requested with WithSkillName while skills are disabled
+	ErrSkillsDisabled = errors.New("skills are disabled")
+)
+
+// ListSkillsCommand is the chat command listing the available skills, a loaded skill named "skills" takes precedence
+const ListSkillsCommand = "/skills"
+
+// skillCommandPattern matches the skill name of a "/name args" command
+var skillCommandPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+type skillNameKey struct{}
+
+// WithSkillName returns a copy of ctx running the chat with the named skill,
+// the skill selection is skipped and the message is the task of the skill. Skills must be enabled for the chat.
+func WithSkillName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, skillNameKey{}, name)
+}
+
+// SkillNameFromContext returns the skill name carried by ctx
+func SkillNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(skillNameKey{}).(string)
+	return name
+}
+
+// parseSkillCommand splits a "/name args" message, ok is false when the message is not a command
+func parseSkillCommand(message string) (name, args string, ok bool) {
+	text := strings.TrimSpace(message)
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	text = text[1:]
+	name, args = text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		name, args = text[:i], strings.TrimSpace(text[i:])
+	}
+	if !skillCommandPattern.MatchString(name) {
+		return "", "", false
+	}
+	return name, args, true
+}
+
+// findSkill returns the loaded skill with name, nil when it is not loaded
+func findSkill(loaded []*skills.Skill, name string) *skills.Skill {
+	for _, skill := range loaded {
+		if skill.Name == name {
+			return skill
+		}
+	}
+	return nil
+}
+
+// lastUserText returns the text of the last user message of messages, empty when there is none
+func lastUserText(messages []llms.MessageContent) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != llms.ChatMessageTypeHuman {
+			continue
+		}
+		var text string
+		for _, part := range messages[i].Parts {
+			if textPart, ok := part.(llms.TextContent); ok {
+				text += textPart.Text
+			}
+		}
+		return text
+	}
+	return ""
+}
+
+// skillsListing returns the answer of the /skills command
+func skillsListing(loaded []*skills.Skill) string {
+	if len(loaded) == 0 {
+		return "No skills are available."
+	}
+	var sb strings.Builder
+	sb.WriteString("Available skills, run one with /<skill> <task>:\n")
+	for _, skill := range loaded {
+		sb.WriteString("- /" + skill.Name + ": " + skill.Description + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,276 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kinwyb/langchat/llm/skills"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// SkillRouter selects the skill used for a message
+type SkillRouter interface {
+	// SelectSkill returns the name of the loaded skill to use for message, empty when no skill is needed
+	SelectSkill(ctx context.Context, message string, loaded []*skills.Skill) (string, error)
+}
+
+// SkillIndexer is implemented by routers which prepare the skills when they are loaded or reloaded
+type SkillIndexer interface {
+	// IndexSkills is called with all the loaded skills after each change
+	IndexSkills(ctx context.Context, loaded []*skills.Skill) error
+}
+
+// llmSkillRouter asks the model to choose among all the skills, one model call per message
+type llmSkillRouter struct {
+	model llms.Model
+}
+
+// SelectSkill implements SkillRouter, it asks the model which skill should be used for the message
+func (r *llmSkillRouter) SelectSkill(ctx context.Context, message string, loaded []*skills.Skill) (string, error) {
+	if len(loaded) == 0 {
+		return "", nil // No skills available
+	}
+
+	var info strings.Builder
+	info.WriteString("Available Skills:\n\n")
+
+	for _, skill := range loaded {
+		info.WriteString(fmt.Sprintf("- %s: %s\n", skill.Name, skill.Description))
+	}
+	skillsOverview := info.String()
+
+	skillPrompt := fmt.Sprintf(`Based on the user's message, determine if any of the available skills should be used to help with this task.
+
+%s
+
+User message: %s
+
+Respond with a JSON object:
+- If no skill is needed: {"use_skill": false, "reason": "reason why no skill is needed"}
+- If a skill is needed: {"use_skill": true, "skill_name": "exact skill name", "reason": "why this skill is appropriate"}
+
+IMPORTANT:
+- Return ONLY valid JSON
+- Do NOT use markdown code fences
+- Do NOT use `+"```json"+` wrapper
+- Choose the skill that best matches the user's needs`, skillsOverview, message)
+
+	// Create LLM call for skill selection
+	skillMsg := []llms.MessageContent{
+		{Role: llms.ChatMessageTypeSystem, Parts: []llms.ContentPart{llms.TextPart("You are a helpful assistant that selects appropriate skills for tasks. Respond only with valid JSON.")}},
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(skillPrompt)}},
+	}
+
+	response, err := r.model.GenerateContent(ctx, skillMsg)
+	emitUsage(ctx, response)
+	if err != nil {
+		return "", fmt.Errorf("LLM call failed for skill selection: %w", err)
+	}
+
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no response from LLM")
+	}
+
+	decision := response.Choices[0].Content
+	log.Printf("Skill selection decision: %s", decision)
+
+	// Clean up the decision
+	cleanDecision := strings.TrimSpace(decision)
+	if after, ok := strings.CutPrefix(cleanDecision, "```json"); ok {
+		cleanDecision = after
+		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
+		cleanDecision = strings.TrimSpace(cleanDecision)
+	} else if after, ok := strings.CutPrefix(cleanDecision, "```"); ok {
+		cleanDecision = after
+		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
+		cleanDecision = strings.TrimSpace(cleanDecision)
+	}
+
+	// Parse the decision
+	var skillDecision struct {
+		UseSkill  bool   `json:"use_skill"`
+		SkillName string `json:"skill_name"`
+		Reason    string `json:"reason"`
+	}
+
+	if err := json.Unmarshal([]byte(cleanDecision), &skillDecision); err != nil {
+		return "", fmt.Errorf("failed to parse skill decision: %w", err)
+	}
+
+	if skillDecision.UseSkill {
+		log.Printf("Selected skill '%s' because: %s", skillDecision.SkillName, skillDecision.Reason)
+		return skillDecision.SkillName, nil
+	}
+
+	log.Printf("No skill selected: %s", skillDecision.Reason)
+	return "", nil
+}
+
+// Defaults of the EmbeddingSkillRouter
+const (
+	DefaultSkillRouterTopK     = 3
+	DefaultSkillRouterMinScore = 0.5
+)
+
+// EmbeddingSkillRouter selects skills by the similarity of the message with their name and description.
+// The skills are embedded once when they are loaded, each message then costs one embedding of the query
+// and, when a confirmation model is configured, one model call choosing among the top candidates only.
+type EmbeddingSkillRouter struct {
+	embedder embeddings.Embedder
+	index    *VectorIndex
+	topK     int
+	minScore float32
+	confirm  llms.Model
+
+	// mu serializes the indexing, texts holds the embedded text of each skill
+	mu    sync.Mutex
+	texts map[string]string
+}
+
+type EmbeddingRouterOption func(*EmbeddingSkillRouter)
+
+// RouterWithTopK 配置相似度检索返回的候选技能数量
+func RouterWithTopK(k int) EmbeddingRouterOption {
+	return func(r *EmbeddingSkillRouter) {
+		if k <= 0 {
+			k = DefaultSkillRouterTopK
+		}
+		r.topK = k
+	}
+}
+
+// RouterWithMinScore 配置候选技能的最低余弦相似度，低于该值的技能不会被选中
+func RouterWithMinScore(score float32) EmbeddingRouterOption {
+	return func(r *EmbeddingSkillRouter) {
+		r.minScore = score
+	}
+}
+
+// RouterWithConfirm 使用LLM在检索到的候选技能中确认最终技能，未配置时直接使用相似度最高的技能
+func RouterWithConfirm(model llms.Model) EmbeddingRouterOption {
+	return func(r *EmbeddingSkillRouter) {
+		r.confirm = model
+	}
+}
+
+// NewEmbeddingSkillRouter creates a skill router backed by embedder and an in-process vector index
+func NewEmbeddingSkillRouter(embedder embeddings.Embedder, opts ...EmbeddingRouterOption) *EmbeddingSkillRouter {
+	r := &EmbeddingSkillRouter{
+		embedder: embedder,
+		index:    NewVectorIndex(),
+		topK:     DefaultSkillRouterTopK,
+		minScore: DefaultSkillRouterMinScore,
+		texts:    make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// skillText returns the text embedded for a skill
+func skillText(skill *skills.Skill) string {
+	return skill.Name + ": " + skill.Description
+}
+
+// IndexSkills implements SkillIndexer, it embeds the new and changed skills and drops the removed ones
+func (r *EmbeddingSkillRouter) IndexSkills(ctx context.Context, loaded []*skills.Skill) error {
+	names := make(map[string]bool, len(loaded))
+	for _, skill := range loaded {
+		names[skill.Name] = true
+	}
+	r.mu.Lock()
+	for name := range r.texts {
+		if !names[name] {
+			delete(r.texts, name)
+			r.index.Remove(name)
+		}
+	}
+	r.mu.Unlock()
+	return r.embedSkills(ctx, loaded)
+}
+
+// embedSkills embeds the skills which are not indexed or whose text changed
+func (r *EmbeddingSkillRouter) embedSkills(ctx context.Context, loaded []*skills.Skill) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var names, texts []string
+	for _, skill := range loaded {
+		text := skillText(skill)
+		if r.texts[skill.Name] == text {
+			continue
+		}
+		names = append(names, skill.Name)
+		texts = append(texts, text)
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+	vectors, err := r.embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed skills: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return fmt.Errorf("failed to embed skills: got %d vectors for %d skills", len(vectors), len(texts))
+	}
+	for i, name := range names {
+		r.index.Upsert(name, vectors[i])
+		r.texts[name] = texts[i]
+	}
+	log.Printf("Indexed %d skill embeddings", len(names))
+	return nil
+}
+
+// SelectSkill implements SkillRouter, it retrieves the top-k skills by similarity and confirms the choice
+// with the model when one is configured
+func (r *EmbeddingSkillRouter) SelectSkill(ctx context.Context, message string, loaded []*skills.Skill) (string, error) {
+	if len(loaded) == 0 {
+		return "", nil
+	}
+	// skills loaded before the router was indexed are embedded on first use
+	if err := r.embedSkills(ctx, loaded); err != nil {
+		return "", err
+	}
+	query, err := r.embedder.EmbedQuery(ctx, message)
+	if err != nil {
+		return "", fmt.Errorf("failed to embed message: %w", err)
+	}
+
+	byName := make(map[string]*skills.Skill, len(loaded))
+	for _, skill := range loaded {
+		byName[skill.Name] = skill
+	}
+	var candidates []*skills.Skill
+	for _, match := range r.index.Search(query, r.topK, func(id string) bool { return byName[id] != nil }) {
+		if match.Score < r.minScore {
+			break
+		}
+		log.Printf("Skill candidate '%s' score %.3f", match.ID, match.Score)
+		candidates = append(candidates, byName[match.ID])
+	}
+	if len(candidates) == 0 {
+		log.Printf("No skill selected: no skill scored above %.2f", r.minScore)
+		return "", nil
+	}
+	if r.confirm == nil {
+		log.Printf("Selected skill '%s' by similarity", candidates[0].Name)
+		return candidates[0].Name, nil
+	}
+	name, err := (&llmSkillRouter{model: r.confirm}).SelectSkill(ctx, message, candidates)
+	if err != nil || name == "" {
+		return "", err
+	}
+	// the model may answer a skill which is not a candidate
+	if !slices.ContainsFunc(candidates, func(skill *skills.Skill) bool { return skill.Name == name }) {
+		log.Printf("No skill selected: '%s' is not a candidate", name)
+		return "", nil
+	}
+	return name, nil
+}
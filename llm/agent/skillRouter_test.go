@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/llmtest"
+	"github.com/kinwyb/langchat/llm/skills"
+)
+
+// keywordEmbedder embeds texts as counts of its keywords, it records the embedded texts
+type keywordEmbedder struct {
+	keywords []string
+
+	mu        sync.Mutex
+	documents []string
+	queries   []string
+}
+
+func (e *keywordEmbedder) embed(text string) []float32 {
+	text = strings.ToLower(text)
+	vector := make([]float32, len(e.keywords))
+	for i, keyword := range e.keywords {
+		vector[i] = float32(strings.Count(text, keyword))
+	}
+	return vector
+}
+
+func (e *keywordEmbedder) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	e.documents = append(e.documents, texts...)
+	e.mu.Unlock()
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *keywordEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	e.mu.Lock()
+	e.queries = append(e.queries, text)
+	e.mu.Unlock()
+	return e.embed(text), nil
+}
+
+var routerSkills = []*skills.Skill{
+	{Name: "greeter", Description: "Greets people, say hello"},
+	{Name: "counter", Description: "Counts the words of a text"},
+	{Name: "translator", Description: "Translates a text to french"},
+}
+
+func TestVectorIndexSearch(t *testing.T) {
+	index := NewVectorIndex()
+	index.Upsert("x", []float32{1, 0})
+	index.Upsert("xy", []float32{2, 2})
+	index.Upsert("y", []float32{0, 3})
+	index.Upsert("other", []float32{1, 1, 1})
+
+	matches := index.Search([]float32{1, 0.1}, 2, nil)
+	if len(matches) != 2 || matches[0].ID != "x" || matches[1].ID != "xy" {
+		t.Fatalf("Expected matches 'x' and 'xy', got %+v", matches)
+	}
+	if matches[0].Score < 0.99 || matches[0].Score > 1.0001 {
+		t.Errorf("Expected a cosine similarity close to 1, got %f", matches[0].Score)
+	}
+
+	matches = index.Search([]float32{1, 0.1}, 0, func(id string) bool { return id != "x" })
+	if len(matches) != 2 || matches[0].ID != "xy" || matches[1].ID != "y" {
+		t.Errorf("Expected the filtered matches 'xy' and 'y', got %+v", matches)
+	}
+
+	index.Remove("xy")
+	if index.Has("xy") || index.Len() != 3 {
+		t.Errorf("Expected 'xy' to be removed, got %d vectors", index.Len())
+	}
+}
+
+func TestEmbeddingSkillRouter(t *testing.T) {
+	embedder := &keywordEmbedder{keywords: []string{"hello", "count", "word", "french", "translat", "text"}}
+	router := NewEmbeddingSkillRouter(embedder)
+	if err := router.IndexSkills(context.Background(), routerSkills); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"hello!", "greeter"},
+		{"how many words in this text?", "counter"},
+		{"translate this text to french", "translator"},
+		{"what is the weather like?", ""},
+	}
+	for _, tt := range tests {
+		got, err := router.SelectSkill(context.Background(), tt.message, routerSkills)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Expected skill '%s' for '%s', got '%s'", tt.want, tt.message, got)
+		}
+	}
+	if len(embedder.documents) != len(routerSkills) {
+		t.Errorf("Expected the skills to be embedded once, got %v", embedder.documents)
+	}
+
+	// a removed skill is not selected, a changed one is embedded again
+	changed := []*skills.Skill{routerSkills[1], {Name: "greeter", Description: "Greets people in french"}}
+	if err := router.IndexSkills(context.Background(), changed); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := router.SelectSkill(context.Background(), "french translation", changed); got != "greeter" {
+		t.Errorf("Expected the changed skill 'greeter', got '%s'", got)
+	}
+	if len(embedder.documents) != len(routerSkills)+1 || router.index.Has("translator") {
+		t.Errorf("Expected only the changed skill to be embedded, got %v", embedder.documents)
+	}
+}
+
+func TestEmbeddingSkillRouterConfirm(t *testing.T) {
+	embedder := &keywordEmbedder{keywords: []string{"hello", "count", "word", "french", "translat", "text"}}
+	model := llmtest.New(llmtest.Text(`{"use_skill": true, "skill_name": "translator"}`).Expecting(func(call llmtest.Call) error {
+		if !call.Contains("- counter: ") || !call.Contains("- translator: ") || call.Contains("- greeter: ") {
+			return errors.New("expected only the top candidates in the selection prompt")
+		}
+		return nil
+	}))
+	router := NewEmbeddingSkillRouter(embedder, RouterWithTopK(2), RouterWithMinScore(0.1), RouterWithConfirm(model))
+
+	// the skills are embedded on first use
+	got, err := router.SelectSkill(context.Background(), "count the words of this text in french", routerSkills)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "translator" {
+		t.Errorf("Expected skill 'translator', got '%s'", got)
+	}
+	model.AssertExpectations(t)
+}
+
+func TestEmbeddingSkillRouterConfirmNotCandidate(t *testing.T) {
+	embedder := &keywordEmbedder{keywords: []string{"hello", "count", "word", "french", "translat", "text"}}
+	model := llmtest.New(llmtest.Text(`{"use_skill": true, "skill_name": "greeter"}`))
+	router := NewEmbeddingSkillRouter(embedder, RouterWithTopK(2), RouterWithMinScore(0.1), RouterWithConfirm(model))
+
+	// greeter is loaded but not among the top candidates
+	got, err := router.SelectSkill(context.Background(), "count the words of this text in french", routerSkills)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("Expected no skill, got '%s'", got)
+	}
+}
+
+func TestTextChatAgentSkillRouter(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill(t, dir, "greeter", "Greets people, say hello", "Always answer with a greeting.")
+	writeSkill(t, dir, "counter", "Counts the words of a text", "Count the words of the message.")
+
+	embedder := &keywordEmbedder{keywords: []string{"hello", "count", "word"}}
+	// no selection call, the only model call is the skill answer
+	model := llmtest.New(llmtest.Text("2 words").Expecting(llmtest.ExpectContains("Skill: counter")))
+	a := NewTextChatAgent(model, WithSkill(dir), WithSkillRouter(NewEmbeddingSkillRouter(embedder)))
+	defer a.Close()
+
+	resp, err := a.Chat(context.Background(), "count these words", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "2 words" {
+		t.Errorf("Expected response '2 words', got '%s'", resp)
+	}
+	if len(embedder.documents) != 2 {
+		t.Errorf("Expected the skills to be indexed when loaded, got %v", embedder.documents)
+	}
+	model.AssertCalls(t, 1)
+	model.AssertExpectations(t)
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ConversationStore persists conversation history by session.
+// The system prompt is not stored, only the messages exchanged in the session.
+type ConversationStore interface {
+	// Load returns the stored history of a session, empty if the session does not exist
+	Load(ctx context.Context, sessionID string) ([]llms.MessageContent, error)
+	// Append adds messages to the end of a session history
+	Append(ctx context.Context, sessionID string, messages ...llms.MessageContent) error
+	// List returns the IDs of all stored sessions
+	List(ctx context.Context) ([]string, error)
+	// Delete removes a session history
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// MemoryConversationStore keeps conversation history in memory
+type MemoryConversationStore struct {
+	mu       sync.RWMutex
+	sessions map[string][]llms.MessageContent
+}
+
+// NewMemoryConversationStore creates an in-memory conversation store
+func NewMemoryConversationStore() *MemoryConversationStore {
+	return &MemoryConversationStore{
+		sessions: make(map[string][]llms.MessageContent),
+	}
+}
+
+func (s *MemoryConversationStore) Load(_ context.Context, sessionID string) ([]llms.MessageContent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]llms.MessageContent(nil), s.sessions[sessionID]...), nil
+}
+
+func (s *MemoryConversationStore) Append(_ context.Context, sessionID string, messages ...llms.MessageContent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sessionID] = append(s.sessions[sessionID], messages...)
+	return nil
+}
+
+func (s *MemoryConversationStore) List(_ context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *MemoryConversationStore) Delete(_ context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+// FileConversationStore stores each session as a JSONL file (one message per line) in a directory
+type FileConversationStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+const conversationFileExt = ".jsonl"
+
+// NewFileConversationStore creates a file based conversation store in dir, creating the directory if needed
+func NewFileConversationStore(dir string) (*FileConversationStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create conversation directory '%s': %w", dir, err)
+	}
+	return &FileConversationStore{dir: dir}, nil
+}
+
+// sessionFile returns the file path of a session, escaping the ID so it is a safe file name
+func (s *FileConversationStore) sessionFile(sessionID string) (string, error) {
+	if sessionID == "" {
+		return "", errors.New("session ID is empty")
+	}
+	return filepath.Join(s.dir, sessionFileName(sessionID)+conversationFileExt), nil
+}
+
+// sessionFileName escapes a session ID for use as a single path element
+func sessionFileName(sessionID string) string {
+	name := url.PathEscape(sessionID)
+	if name == "." || name == ".." {
+		name = strings.ReplaceAll(name, ".", "%2E")
+	}
+	return name
+}
+
+func (s *FileConversationStore) Load(_ context.Context, sessionID string) ([]llms.MessageContent, error) {
+	path, err := s.sessionFile(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open conversation '%s': %w", sessionID, err)
+	}
+	defer f.Close()
+
+	var messages []llms.MessageContent
+	decoder := json.NewDecoder(f)
+	for {
+		var msg llms.MessageContent
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode conversation '%s': %w", sessionID, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (s *FileConversationStore) Append(_ context.Context, sessionID string, messages ...llms.MessageContent) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	path, err := s.sessionFile(sessionID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open conversation '%s': %w", sessionID, err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, msg := range messages {
+		if err := encoder.Encode(msg); err != nil {
+			return fmt.Errorf("failed to write conversation '%s': %w", sessionID, err)
+		}
+	}
+	return f.Sync()
+}
+
+func (s *FileConversationStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversation directory '%s': %w", s.dir, err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), conversationFileExt)
+		if entry.IsDir() || !ok {
+			continue
+		}
+		id, err := url.PathUnescape(name)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *FileConversationStore) Delete(_ context.Context, sessionID string) error {
+	path, err := s.sessionFile(sessionID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete conversation '%s': %w", sessionID, err)
+	}
+	return nil
+}
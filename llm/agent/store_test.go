@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func testConversationStore(t *testing.T, store ConversationStore) {
+	ctx := context.Background()
+	toolCall := llms.MessageContent{
+		Role: llms.ChatMessageTypeAI,
+		Parts: []llms.ContentPart{llms.ToolCall{
+			ID:           "call_1",
+			Type:         "function",
+			FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"filePath":"a.txt"}`},
+		}},
+	}
+	toolResp := llms.MessageContent{
+		Role: llms.ChatMessageTypeTool,
+		Parts: []llms.ContentPart{llms.ToolCallResponse{
+			ToolCallID: "call_1",
+			Name:       "read_file",
+			Content:    "line1\nline2",
+		}},
+	}
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hello"),
+		toolCall,
+		toolResp,
+	}
+
+	if err := store.Append(ctx, "s/1", messages[:1]...); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := store.Append(ctx, "s/1", messages[1:]...); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := store.Append(ctx, "s2", llms.TextParts(llms.ChatMessageTypeHuman, "other")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	loaded, err := store.Load(ctx, "s/1")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, messages) {
+		t.Errorf("Expected %+v, got %+v", messages, loaded)
+	}
+
+	ids, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"s/1", "s2"}) {
+		t.Errorf("Expected sessions [s/1 s2], got %v", ids)
+	}
+
+	if err := store.Delete(ctx, "s/1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	loaded, err = store.Load(ctx, "s/1")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded) != 0 {
+		t.Errorf("Expected deleted session to be empty, got %d messages", len(loaded))
+	}
+}
+
+func TestMemoryConversationStore(t *testing.T) {
+	testConversationStore(t, NewMemoryConversationStore())
+}
+
+func TestFileConversationStore(t *testing.T) {
+	store, err := NewFileConversationStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConversationStore(t, store)
+}
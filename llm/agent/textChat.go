@@ -3,55 +3,173 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/kinwyb/langchat/llm/skills"
+	"github.com/kinwyb/langchat/llm/tools"
 	mcpclient "github.com/smallnest/goskills/mcp"
 	"github.com/smallnest/langgraphgo/adapter/mcp"
-	"github.com/smallnest/langgraphgo/prebuilt"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/tools"
+	tls "github.com/tmc/langchaingo/tools"
 )
 
-// TextChatAgent manages conversation history for a session
+// TextChatAgent manages conversation history per session
 type TextChatAgent struct {
-	llm           llms.Model
-	messages      []llms.MessageContent
-	mu            sync.RWMutex
-	mcpClient     *mcpclient.Client
-	mcpTools      []tools.Tool
-	skills        []*skills.Skill
-	cfg           *config
-	selectedSkill string // Currently selected skill name
-	toolsEnabled  bool
-	toolsLoading  bool // true when tools are being loaded asynchronously
-	toolsLoaded   bool // true when tools have finished loading
+	llm      llms.Model
+	sessions *SessionManager
+	// mu guards the skills and the MCP state, the sessions have their own locks
+	mu           sync.RWMutex
+	mcpClient    *mcpclient.Client
+	mcpTools     []tls.Tool
+	registry     *tools.Registry // MCP tools and custom tools
+	skills       []*skills.Skill
+	skillWatcher *skills.Watcher
+	cfg          *config
+	toolsEnabled bool
+	toolsLoading bool // true when tools are being loaded asynchronously
+	toolsLoaded  bool // true when tools have finished loading
 }
 
 // NewTextChatAgent creates a text chat agent
 func NewTextChatAgent(llm llms.Model, opts ...Option) *TextChatAgent {
-	// Add system message
-	systemMsg := llms.MessageContent{
-		Role:  llms.ChatMessageTypeSystem,
-		Parts: []llms.ContentPart{llms.TextPart("You are a helpful AI assistant. Be concise and friendly.")},
-	}
-
 	agent := &TextChatAgent{
-		llm:      llm,
-		messages: []llms.MessageContent{systemMsg},
-		cfg:      &config{},
+		llm: llm,
+		cfg: &config{
+			sessionIdleTimeout: DefaultSessionIdleTimeout,
+			systemPrompt:       DefaultSystemPrompt,
+			maxToolIterations:  DefaultMaxToolIterations,
+		},
 	}
 	for _, opt := range opts {
 		opt(agent.cfg)
 	}
+	if err := ValidatePromptTemplate(agent.cfg.systemPrompt); err != nil {
+		log.Printf("System prompt error, using the default system prompt: %v", err)
+		agent.cfg.systemPrompt = DefaultSystemPrompt
+	}
+	agent.registry, _ = tools.NewRegistry()
+	for _, t := range agent.cfg.tools {
+		if err := agent.registry.Register(t); err != nil {
+			log.Printf("Skip tool: %v", err)
+		}
+	}
+	if agent.cfg.approvals == nil {
+		agent.cfg.approvals = NewMemoryApprovalStore()
+	}
+	if agent.cfg.maxContextTokens > 0 && agent.cfg.tokenCounter == nil {
+		agent.cfg.tokenCounter = NewTiktokenCounter("cl100k_base")
+	}
+	agent.sessions = NewSessionManager(agent.cfg.sessionIdleTimeout, agent.newSessionHistory)
 	agent.InitializeToolsAsync()
 	return agent
 }
 
+// newSessionHistory builds the history of a session: the system prompt followed by
+// the messages carried by ctx or restored from the conversation store
+func (a *TextChatAgent) newSessionHistory(ctx context.Context, sessionID string) ([]llms.MessageContent, error) {
+	// Add system message
+	systemPrompt, err := a.renderSystemPrompt(SessionIDFromContext(ctx), SessionPrompt{})
+	if err != nil {
+		return nil, err
+	}
+	systemMsg := llms.MessageContent{
+		Role:  llms.ChatMessageTypeSystem,
+		Parts: []llms.ContentPart{llms.TextPart(systemPrompt)},
+	}
+	messages := []llms.MessageContent{systemMsg}
+	if history, ok := HistoryFromContext(ctx); ok {
+		messages = append(messages, history...)
+	} else if a.cfg.store != nil {
+		stored, err := a.cfg.store.Load(ctx, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session '%s': %w", sessionID, err)
+		}
+		messages = append(messages, stored...)
+	}
+	return messages, nil
+}
+
+// renderSystemPrompt renders the session system prompt, the session override wins over the configured prompt
+func (a *TextChatAgent) renderSystemPrompt(sessionID string, prompt SessionPrompt) (string, error) {
+	data := newPromptData(sessionID, prompt)
+	if prompt.SystemPrompt != "" {
+		if prompt.Literal {
+			return prompt.SystemPrompt, nil
+		}
+		return RenderPromptOverride(prompt.SystemPrompt, data)
+	}
+	return RenderPrompt(a.cfg.systemPrompt, data)
+}
+
+// applySystemPrompt merges the prompt settings carried by ctx into the session and
+// refreshes the system message at the head of its history
+func (a *TextChatAgent) applySystemPrompt(ctx context.Context, session *Session) error {
+	override := SessionPromptFromContext(ctx)
+	if override.SystemPrompt != "" {
+		session.prompt.SystemPrompt = override.SystemPrompt
+		session.prompt.Literal = override.Literal
+	}
+	if override.UserName != "" {
+		session.prompt.UserName = override.UserName
+	}
+	if override.Locale != "" {
+		session.prompt.Locale = override.Locale
+	}
+	systemPrompt, err := a.renderSystemPrompt(SessionIDFromContext(ctx), session.prompt)
+	if err != nil {
+		return err
+	}
+	if len(session.messages) > 0 && session.messages[0].Role == llms.ChatMessageTypeSystem {
+		session.messages[0] = llms.TextParts(llms.ChatMessageTypeSystem, systemPrompt)
+	}
+	return nil
+}
+
+// persistSession writes the messages added to the session since index start to the conversation store
+func (a *TextChatAgent) persistSession(ctx context.Context, session *Session, start int) {
+	if a.cfg.store == nil || start >= len(session.messages) {
+		return
+	}
+	// Persist even if the request context was canceled, the messages are already in history
+	if err := a.cfg.store.Append(context.WithoutCancel(ctx), session.ID, session.messages[start:]...); err != nil {
+		log.Printf("Failed to persist session '%s': %v", session.ID, err)
+	}
+}
+
+// Tools returns the registry of MCP tools and custom tools shared by the agent
+func (a *TextChatAgent) Tools() *tools.Registry {
+	return a.registry
+}
+
+// skillExtraTools returns the registered tools listed in the skill allowed-tools
+func (a *TextChatAgent) skillExtraTools(skill *skills.Skill) []tools.ITool {
+	var ret []tools.ITool
+	for _, name := range skill.Package.Meta.AllowedTools {
+		if t, ok := a.registry.Get(name); ok {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// DeleteSession removes a session of the tenant carried by ctx from memory and from the conversation store
+func (a *TextChatAgent) DeleteSession(ctx context.Context, sessionID string) error {
+	sessionID = TenantSessionKey(TenantFromContext(ctx), sessionID)
+	a.sessions.Delete(sessionID)
+	if a.cfg.store != nil {
+		return a.cfg.store.Delete(ctx, sessionID)
+	}
+	return nil
+}
+
 // InitializeToolsAsync asynchronously loads Skills and MCP tools in the background
 // This prevents blocking server startup while tools are being loaded
 func (a *TextChatAgent) InitializeToolsAsync() {
@@ -68,8 +186,9 @@ func (a *TextChatAgent) InitializeToolsAsync() {
 		a.toolsLoaded = true
 		skillsCount := len(a.skills)
 		mcpToolsCount := len(a.mcpTools)
+		toolsCount := a.registry.Len()
 		a.mu.Unlock()
-		log.Printf("✓ Tools pre-warming complete: %d Skills, %d MCP tools loaded", skillsCount, mcpToolsCount)
+		log.Printf("✓ Tools pre-warming complete: %d Skills, %d MCP tools loaded, %d tools registered", skillsCount, mcpToolsCount, toolsCount)
 	}()
 
 	log.Println("Starting background tools initialization...")
@@ -82,13 +201,23 @@ func (a *TextChatAgent) InitializeToolsAsync() {
 	}()
 
 	// Load Skills
-	var serr error
 	skillsDir := a.cfg.skillDir
 	if skillsDir != "" {
-		a.skills, serr = skills.LoadSkills(skillsDir)
-		if serr != nil {
-			log.Print(serr.Error())
-		}
+		watcher := skills.NewWatcher(skillsDir, a.cfg.skillReload, func(loaded []*skills.Skill) {
+			a.mu.Lock()
+			a.skills = loaded
+			a.mu.Unlock()
+			log.Printf("Loaded %d skills", len(loaded))
+			if indexer, ok := a.cfg.skillRouter.(SkillIndexer); ok {
+				if err := indexer.IndexSkills(context.Background(), loaded); err != nil {
+					log.Printf("Skill indexing failed: %v", err)
+				}
+			}
+		}, a.skillToolOptions()...)
+		a.mu.Lock()
+		a.skillWatcher = watcher
+		a.mu.Unlock()
+		watcher.Start()
 	}
 
 	// Load MCP
@@ -101,6 +230,193 @@ func (a *TextChatAgent) InitializeToolsAsync() {
 	}
 }
 
+// loadedSkills returns the loaded skills, the slice must not be modified
+func (a *TextChatAgent) loadedSkills() []*skills.Skill {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.skills
+}
+
+// skillRouter returns the configured skill router, the model selects the skills by default
+func (a *TextChatAgent) skillRouter() SkillRouter {
+	if a.cfg.skillRouter != nil {
+		return a.cfg.skillRouter
+	}
+	return &llmSkillRouter{model: a.llm}
+}
+
+// SkillsStatus implements SkillReloader
+func (a *TextChatAgent) SkillsStatus() skills.Status {
+	a.mu.RLock()
+	watcher := a.skillWatcher
+	a.mu.RUnlock()
+	if watcher == nil {
+		return skills.Status{}
+	}
+	return watcher.Status()
+}
+
+// ReloadSkills implements SkillReloader
+func (a *TextChatAgent) ReloadSkills() skills.Status {
+	a.mu.RLock()
+	watcher := a.skillWatcher
+	a.mu.RUnlock()
+	if watcher == nil {
+		return skills.Status{}
+	}
+	return watcher.Reload()
+}
+
+// withSessionWorkspace returns a copy of ctx carrying the workspace of the session,
+// sessionKey is the tenant session key so tenants and sessions never share a directory
+func (a *TextChatAgent) withSessionWorkspace(ctx context.Context, sessionKey string) context.Context {
+	var ws tools.Workspace
+	if a.cfg.workspace != nil {
+		ws = *a.cfg.workspace
+	}
+	if ws.Root == "" {
+		ws.Root = filepath.Join(os.TempDir(), "langchat-workspace")
+	}
+	ws.Root = filepath.Join(ws.Root, sessionFileName(sessionKey))
+	return tools.WithWorkspace(ctx, &ws)
+}
+
+// newToolAgent creates the ReAct agent calling the registered tools
+func (a *TextChatAgent) newToolAgent(onChunk func(context.Context, []byte) error) *ReactAgent {
+	opts := []ReactOption{
+		ReactWithRegistry(a.registry),
+		ReactWithMaxIterations(a.cfg.maxToolIterations),
+		ReactWithToolTimeout(a.cfg.toolTimeoutFor),
+		ReactWithToolPolicy(a.cfg.toolPolicy),
+		ReactWithContextLimit(a.fitContext),
+		ReactSupportTool(true),
+	}
+	if onChunk != nil {
+		opts = append(opts, ReactWithStream(onChunk))
+	}
+	return NewReactAgent(a.llm, nil, opts...)
+}
+
+// skillToolOptions returns how the tools of the skills are executed
+func (a *TextChatAgent) skillToolOptions() []skills.ToolOption {
+	opts := []skills.ToolOption{skills.WithSandbox(a.cfg.sandbox)}
+	if a.cfg.hostExecution {
+		opts = append(opts, skills.WithHostExecution())
+	}
+	return opts
+}
+
+// skillAgentOptions returns the agent settings applied to skill execution
+func (a *TextChatAgent) skillAgentOptions() []ReactOption {
+	return []ReactOption{
+		ReactWithToolTimeout(a.cfg.toolTimeoutFor),
+		ReactWithToolPolicy(a.cfg.toolPolicy),
+		ReactWithContextLimit(a.fitContext),
+	}
+}
+
+// fitContext trims the messages of a model call of the tool calling loop to the context budget
+func (a *TextChatAgent) fitContext(messages []llms.MessageContent) []llms.MessageContent {
+	return fitContext(a.cfg.tokenCounter, a.cfg.maxContextTokens, messages)
+}
+
+// savePendingApproval persists a paused tool loop and returns the approval error for the caller
+func (a *TextChatAgent) savePendingApproval(ctx context.Context, approval *ApprovalRequiredError, skill string) error {
+	approval.pending.Skill = skill
+	approval.pending.Tenant = TenantFromContext(ctx)
+	if err := a.cfg.approvals.Save(context.WithoutCancel(ctx), approval.pending); err != nil {
+		return fmt.Errorf("failed to save pending approval: %w", err)
+	}
+	log.Printf("Tool calls wait for approval %s in session '%s'", approval.Request.ID, approval.Request.SessionID)
+	return approval
+}
+
+// Resume implements Approver, it continues a chat paused for tool approval
+func (a *TextChatAgent) Resume(ctx context.Context, approvalID string, decision ApprovalDecision, onChunk func(context.Context, []byte) error) (string, error) {
+	// A decision is applied once, the tool calls must not run twice
+	pending, err := a.cfg.approvals.Take(ctx, approvalID)
+	if err != nil {
+		return "", err
+	}
+	if pending.Tenant != TenantFromContext(ctx) {
+		// Put back the approval of another tenant
+		if err := a.cfg.approvals.Save(context.WithoutCancel(ctx), pending); err != nil {
+			log.Printf("Failed to restore approval %s: %v", approvalID, err)
+		}
+		return "", fmt.Errorf("%w: %s", ErrApprovalNotFound, approvalID)
+	}
+
+	ctx = WithSessionID(ctx, pending.SessionID)
+	session, release, err := a.sessions.Acquire(ctx, sessionKey(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	defer a.persistSession(ctx, session, len(session.messages))
+	ctx = a.withSessionWorkspace(ctx, session.ID)
+
+	var rac *ReactAgent
+	if pending.Skill != "" {
+		var skill *skills.Skill
+		for _, s := range a.loadedSkills() {
+			if s.Name == pending.Skill {
+				skill = s
+				break
+			}
+		}
+		if skill == nil {
+			return "", fmt.Errorf("skill '%s' of approval %s not found", pending.Skill, approvalID)
+		}
+		rac = newSkillAgent(a.llm, skill, a.skillExtraTools(skill), a.cfg.toolSupport, onChunk, a.skillAgentOptions()...)
+	} else {
+		rac = a.newToolAgent(onChunk)
+	}
+
+	produced, err := rac.Resume(ctx, pending, decision)
+	var approval *ApprovalRequiredError
+	if errors.As(err, &approval) {
+		return "", a.savePendingApproval(ctx, approval, pending.Skill)
+	}
+	if err != nil {
+		return "", fmt.Errorf("LLM call failed: %w", err)
+	}
+	responseText := lastText(produced)
+	if pending.Skill != "" {
+		// Skills only add their answer to the session history
+		session.messages = append(session.messages, llms.TextParts(llms.ChatMessageTypeAI, responseText))
+	} else {
+		session.messages = append(session.messages, produced...)
+	}
+	return responseText, nil
+}
+
+// runSkill runs the task with skill, its answer is added to the session history
+func (a *TextChatAgent) runSkill(ctx context.Context, session *Session, skill *skills.Skill, task string, onChunk func(context.Context, []byte) error) (string, error) {
+	EmitEvent(ctx, Event{Type: EventSkillSelected, Skill: skill.Name})
+	resp, err := skillDoTask(ctx, a.llm, skill, a.skillExtraTools(skill), a.cfg.toolSupport, task, onChunk, a.skillAgentOptions()...)
+	var approval *ApprovalRequiredError
+	if errors.As(err, &approval) {
+		return "", a.savePendingApproval(ctx, approval, skill.Name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("skill '%s' failed: %w", skill.Name, err)
+	}
+	if resp != "" {
+		session.messages = append(session.messages, llms.TextParts(llms.ChatMessageTypeAI, resp))
+	}
+	return resp, nil
+}
+
+// reply answers the message with text without calling the model
+func reply(ctx context.Context, text string, onChunk func(context.Context, []byte) error) (string, error) {
+	if onChunk != nil {
+		if err := onChunk(ctx, []byte(text)); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
+
 // Chat implements the Agent interface for synchronous chat
 func (a *TextChatAgent) Chat(ctx context.Context, message string, enableSkills bool, enableMCP bool) (string, error) {
 	return a.ChatStream(ctx, message, enableSkills, enableMCP, nil)
@@ -108,95 +424,88 @@ func (a *TextChatAgent) Chat(ctx context.Context, message string, enableSkills b
 
 // ChatStream implements the Agent interface for streaming chat
 func (a *TextChatAgent) ChatStream(ctx context.Context, message string, enableSkills bool, enableMCP bool, onChunk func(context.Context, []byte) error) (string, error) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
+	session, release, err := a.sessions.Acquire(ctx, sessionKey(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if err := a.applySystemPrompt(ctx, session); err != nil {
+		return "", err
+	}
+	defer a.persistSession(ctx, session, len(session.messages))
+	ctx = a.withSessionWorkspace(ctx, session.ID)
+
+	loaded := a.loadedSkills()
+	// Skills invoked explicitly, by the request or a "/name args" command, skip the skill selection
+	if name := SkillNameFromContext(ctx); name != "" {
+		if !enableSkills {
+			return "", fmt.Errorf("%w: '%s'", ErrSkillsDisabled, name)
+		}
+		skill := findSkill(loaded, name)
+		if skill == nil {
+			return "", fmt.Errorf("%w: '%s'", ErrSkillNotFound, name)
+		}
+		session.messages = append(session.messages, llms.TextParts(llms.ChatMessageTypeHuman, message))
+		return a.runSkill(ctx, session, skill, message, onChunk)
+	}
+	// Only the names of loaded skills and /skills are commands, other messages starting with "/" go to the model.
+	// A loaded skill named "skills" takes precedence over the listing.
+	if name, args, ok := parseSkillCommand(message); ok && enableSkills {
+		if skill := findSkill(loaded, name); skill != nil {
+			// a bare "/name" runs the skill on the previous user message
+			if args == "" {
+				args = lastUserText(session.messages)
+			}
+			session.messages = append(session.messages, llms.TextParts(llms.ChatMessageTypeHuman, message))
+			return a.runSkill(ctx, session, skill, args, onChunk)
+		}
+		// Commands answered without the model are not added to the history
+		if "/"+name == ListSkillsCommand {
+			return reply(ctx, skillsListing(loaded), onChunk)
+		}
+	}
 
 	// Add user message to history
-	a.messages = append(a.messages, llms.TextParts(llms.ChatMessageTypeHuman, message))
+	session.messages = append(session.messages, llms.TextParts(llms.ChatMessageTypeHuman, message))
 
 	// Accumulator for the full response content (including tool logs)
 	var fullResponseBuilder strings.Builder
 
-	if enableSkills && len(a.skills) > 0 {
-		selectedSkill, err := a.selectSkillForTask(ctx, message)
+	if enableSkills && len(loaded) > 0 {
+		selectedSkill, err := a.skillRouter().SelectSkill(ctx, message, loaded)
 		if err != nil {
 			log.Printf("Skill selection error: %v", err)
-		} else if selectedSkill != "" { // 选中了一个技能，使用技能
-			for _, skill := range a.skills {
-				if skill.Name == selectedSkill {
-					skillResp, se := skillDoTask(ctx, a.llm, skill, a.cfg.toolSupport, message, onChunk)
-					if se != nil {
-						log.Printf("Error during task creation: %v", se)
-					} else if skillResp != "" {
-						// Add assistant response to history
-						assistantMsg := llms.MessageContent{
-							Role:  llms.ChatMessageTypeAI,
-							Parts: []llms.ContentPart{llms.TextPart(skillResp)},
-						}
-						a.messages = append(a.messages, assistantMsg)
-						return skillResp, nil
-					}
-				}
+		} else if skill := findSkill(loaded, selectedSkill); skill != nil { // 选中了一个技能，使用技能
+			skillResp, se := a.runSkill(ctx, session, skill, message, onChunk)
+			var approval *ApprovalRequiredError
+			if errors.As(se, &approval) {
+				return "", se
+			}
+			if se != nil {
+				log.Printf("Error during task creation: %v", se)
+			} else if skillResp != "" {
+				return skillResp, nil
 			}
+		} else if selectedSkill != "" {
+			log.Printf("Selected skill '%s' is not loaded", selectedSkill)
 		}
 	}
-	if enableMCP && len(a.mcpTools) > 0 {
+	// Registered tools (MCP and custom tools) are used when MCP is enabled
+	if enableMCP && a.registry.Len() > 0 {
 		if a.cfg.toolSupport {
-			var tools []llms.Tool
-			for _, t := range a.mcpTools {
-				if param, ok := mcp.GetToolSchema(t); ok {
-					tools = append(tools, llms.Tool{
-						Type: "function",
-						Function: &llms.FunctionDefinition{
-							Name:        t.Name(),
-							Description: t.Description(),
-							Parameters:  param,
-						},
-					})
-				}
-			}
-			var opt []llms.CallOption
-			opt = append(opt, llms.WithTools(tools))
-			if onChunk != nil {
-				opt = append(opt, llms.WithStreamingFunc(onChunk))
+			// Let the model call tools until it answers without tool calls or the iteration limit is reached
+			rac := a.newToolAgent(onChunk)
+			produced, err := rac.Run(ctx, a.contextMessages(ctx, session))
+			var approval *ApprovalRequiredError
+			if errors.As(err, &approval) {
+				return "", a.savePendingApproval(ctx, approval, "")
 			}
-			response, err := a.llm.GenerateContent(ctx, a.messages)
 			if err != nil {
 				return "", fmt.Errorf("LLM call failed: %w", err)
 			}
-			toolCalls := response.Choices[0].ToolCalls
-			if len(toolCalls) > 0 {
-				toolExecutor := prebuilt.NewToolExecutor(a.mcpTools)
-				for _, tc := range toolCalls {
-					var args map[string]any
-					_ = json.Unmarshal([]byte(tc.FunctionCall.Arguments), &args)
-
-					inputVal := ""
-					if val, ok := args["input"].(string); ok {
-						inputVal = val
-					} else {
-						inputVal = tc.FunctionCall.Arguments
-					}
-					res, err := toolExecutor.Execute(ctx, prebuilt.ToolInvocation{
-						Tool:      tc.FunctionCall.Name,
-						ToolInput: inputVal,
-					})
-					if err != nil {
-						res = fmt.Sprintf("Error: %v", err)
-					}
-					toolMsg := llms.MessageContent{
-						Role: llms.ChatMessageTypeTool,
-						Parts: []llms.ContentPart{
-							llms.ToolCallResponse{
-								ToolCallID: tc.ID,
-								Name:       tc.FunctionCall.Name,
-								Content:    res,
-							},
-						},
-					}
-					a.messages = append(a.messages, toolMsg)
-				}
-			}
+			// Record assistant tool calls, tool responses and the final answer in order
+			session.messages = append(session.messages, produced...)
+			return lastText(produced), nil
 		} else {
 			toolResp, useTool, err := a.selectToolForTask(ctx, message)
 			if err != nil {
@@ -207,20 +516,21 @@ func (a *TextChatAgent) ChatStream(ctx context.Context, message string, enableSk
 					Role:  llms.ChatMessageTypeAI,
 					Parts: []llms.ContentPart{llms.TextPart(toolResp)},
 				}
-				a.messages = append(a.messages, assistantMsg)
+				session.messages = append(session.messages, assistantMsg)
 				return toolResp, nil
 			}
 		}
 	}
-	var opt []llms.CallOption
+	opt := slices.Clone(CallOptionsFromContext(ctx))
 	if onChunk != nil {
 		opt = append(opt, llms.WithStreamingFunc(onChunk))
 	}
 	// Call LLM with full history and streaming
-	response, err := a.llm.GenerateContent(ctx, a.messages, opt...)
+	response, err := a.llm.GenerateContent(ctx, a.contextMessages(ctx, session), opt...)
 	if err != nil {
 		return "", fmt.Errorf("LLM call failed: %w", err)
 	}
+	emitUsage(ctx, response)
 
 	// Extract response text
 	var responseText string
@@ -237,99 +547,20 @@ func (a *TextChatAgent) ChatStream(ctx context.Context, message string, enableSk
 		Role:  llms.ChatMessageTypeAI,
 		Parts: []llms.ContentPart{llms.TextPart(fullResponse)},
 	}
-	a.messages = append(a.messages, assistantMsg)
+	session.messages = append(session.messages, assistantMsg)
 
 	return fullResponse, nil
 }
 
-// selectSkillForTask uses LLM to determine which skill (if any) should be used for the task
-func (a *TextChatAgent) selectSkillForTask(ctx context.Context, message string) (string, error) {
-	if len(a.skills) == 0 {
-		return "", nil // No skills available
-	}
-
-	var info strings.Builder
-	info.WriteString("Available Skills:\n\n")
-
-	for _, skill := range a.skills {
-		info.WriteString(fmt.Sprintf("- %s: %s\n", skill.Name, skill.Description))
-	}
-	skillsOverview := info.String()
-
-	skillPrompt := fmt.Sprintf(`Based on the user's message, determine if any of the available skills should be used to help with this task.
-
-%s
-
-User message: %s
-
-Respond with a JSON object:
-- If no skill is needed: {"use_skill": false, "reason": "reason why no skill is needed"}
-- If a skill is needed: {"use_skill": true, "skill_name": "exact skill name", "reason": "why this skill is appropriate"}
-
-IMPORTANT:
-- Return ONLY valid JSON
-- Do NOT use markdown code fences
-- Do NOT use `+"```json"+` wrapper
-- Choose the skill that best matches the user's needs`, skillsOverview, message)
-
-	// Create LLM call for skill selection
-	skillMsg := []llms.MessageContent{
-		{Role: llms.ChatMessageTypeSystem, Parts: []llms.ContentPart{llms.TextPart("You are a helpful assistant that selects appropriate skills for tasks. Respond only with valid JSON.")}},
-		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart(skillPrompt)}},
-	}
-
-	response, err := a.llm.GenerateContent(ctx, skillMsg)
-	if err != nil {
-		return "", fmt.Errorf("LLM call failed for skill selection: %w", err)
-	}
-
-	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("no response from LLM")
-	}
-
-	decision := response.Choices[0].Content
-	log.Printf("Skill selection decision: %s", decision)
-
-	// Clean up the decision
-	cleanDecision := strings.TrimSpace(decision)
-	if after, ok := strings.CutPrefix(cleanDecision, "```json"); ok {
-		cleanDecision = after
-		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
-		cleanDecision = strings.TrimSpace(cleanDecision)
-	} else if after, ok := strings.CutPrefix(cleanDecision, "```"); ok {
-		cleanDecision = after
-		cleanDecision = strings.TrimSuffix(cleanDecision, "```")
-		cleanDecision = strings.TrimSpace(cleanDecision)
-	}
-
-	// Parse the decision
-	var skillDecision struct {
-		UseSkill  bool   `json:"use_skill"`
-		SkillName string `json:"skill_name"`
-		Reason    string `json:"reason"`
-	}
-
-	if err := json.Unmarshal([]byte(cleanDecision), &skillDecision); err != nil {
-		return "", fmt.Errorf("failed to parse skill decision: %w", err)
-	}
-
-	if skillDecision.UseSkill {
-		log.Printf("Selected skill '%s' because: %s", skillDecision.SkillName, skillDecision.Reason)
-		return skillDecision.SkillName, nil
-	}
-
-	log.Printf("No skill selected: %s", skillDecision.Reason)
-	return "", nil
-}
-
 func (a *TextChatAgent) selectToolForTask(ctx context.Context, message string) (string, bool, error) {
-	if len(a.mcpTools) == 0 {
-		return "", false, nil // No mcp tool available
+	registered := a.registry.Tools()
+	if len(registered) == 0 {
+		return "", false, nil // No tool available
 	}
 
 	// Build tools info
 	var toolsInfo strings.Builder
-	for _, tool := range a.mcpTools {
+	for _, tool := range registered {
 		toolsInfo.WriteString(fmt.Sprintf("- %s: %s\n", tool.Name(), tool.Description()))
 	}
 
@@ -357,6 +588,7 @@ IMPORTANT:
 	}
 
 	response, err := a.llm.GenerateContent(ctx, toolMsg)
+	emitUsage(ctx, response)
 	if err != nil {
 		return "", false, fmt.Errorf("LLM call failed for tool selection: %w", err)
 	}
@@ -394,7 +626,7 @@ IMPORTANT:
 
 	if toolDecision.UseTool {
 		// Find the selected tool
-		for _, tool := range a.mcpTools {
+		for _, tool := range registered {
 			if strings.EqualFold(tool.Name(), toolDecision.ToolName) {
 				log.Printf("Selected tool '%s' because: %s", toolDecision.ToolName, toolDecision.Reason)
 				// Convert args to JSON string
@@ -403,12 +635,21 @@ IMPORTANT:
 				if argsStr == "null" {
 					argsStr = "{}"
 				}
+				call := llms.ToolCall{Type: "function", FunctionCall: &llms.FunctionCall{Name: tool.Name(), Arguments: argsStr}}
+				if a.cfg.toolPolicy != nil && a.cfg.toolPolicy(ctx, call) {
+					// Approval needs native tool calling to pause the graph
+					return "", false, fmt.Errorf("tool %s requires user approval which is not supported without native tool calling", tool.Name())
+				}
+				EmitEvent(ctx, Event{Type: EventToolCallStart, ToolName: tool.Name()})
+				EmitEvent(ctx, Event{Type: EventToolCallArgs, ToolName: tool.Name(), Arguments: argsStr})
 				// Call the tool
-				result, err := tool.Call(ctx, argsStr)
+				result, err := tools.WithTimeout(tool, a.cfg.toolTimeoutFor(tool.Name())).Call(ctx, argsStr)
 				if err != nil {
+					EmitEvent(ctx, Event{Type: EventToolResult, ToolName: tool.Name(), Result: err.Error(), IsError: true})
 					log.Printf("MCP tool %s call failed: %v", tool.Name(), err)
 					return "", false, fmt.Errorf("tool %s call failed: %w", tool.Name(), err)
 				}
+				EmitEvent(ctx, Event{Type: EventToolResult, ToolName: tool.Name(), Result: result})
 				log.Printf("Successfully used MCP tool '%s'", tool.Name())
 				return fmt.Sprintf("I used the '%s' tool to help with your request. Here's the result:\n\n%s", tool.Name(), result), true, nil
 			}
@@ -473,6 +714,11 @@ func (a *TextChatAgent) initializeMCP(mcpConfigPath string) (err error) {
 	a.mcpTools = tools
 	a.toolsEnabled = true
 	a.mu.Unlock()
+	for _, t := range newMCPTools(tools) {
+		if err := a.registry.Register(t); err != nil {
+			log.Printf("Skip MCP tool: %v", err)
+		}
+	}
 	log.Printf("Successfully loaded %d MCP tools", len(tools))
 
 	return nil
@@ -529,9 +775,16 @@ func (a *TextChatAgent) Close() error {
 			log.Printf("Error closing MCP client (continuing cleanup): %v", err)
 		}
 		a.mcpClient = nil
+		for _, t := range a.mcpTools {
+			a.registry.Unregister(t.Name())
+		}
 		a.mcpTools = nil
 		log.Printf("MCP client closed and cleared")
 	}
+	if a.skillWatcher != nil {
+		a.skillWatcher.Close()
+	}
+	a.sessions.Close()
 
 	return nil
 }
@@ -2,42 +2,517 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/kinwyb/langchat/llm/llmtest"
+	"github.com/kinwyb/langchat/llm/tools"
+	"github.com/tmc/langchaingo/llms"
 )
 
-func TestNewTextChatAgent(t *testing.T) {
-	msg := `
-总结以下会议的内容：
-老陈：小李，下周二你跟我去趟上海，咱们得把那个大客户签下来。
-小李：没问题陈总，那我今天先把出差申请给报了。
-老陈：行，酒店你看着行，窶芳便出行的，苏滩那边有本酒店不错，大概大概 1200一晚。
-小李：1200 稍微有点贵，但我看那地段确实好，那我就按这个金额报了？
-老陈：报吧。另外晚上咱们得请客户吃顿饭，规格得高一点。
-小李：明白，我预订个3000 块左右的包间，咱们一共6 个人，这标准行吗？
-老陈：行，人均500在上海这种地方也算正常，为了签单这钱该花。
-小李：好，那我申请单里的住宿填 1200，餐饮填 3000，我待会直接提交系统。
-老陈：可以，你动作快点，审批完了咱们好赶紧订票。
-老陈：没别的事就先去忙吧
-`
-	llm, err := openai.New(
-		openai.WithModel("gemma3:12b"),
-		openai.WithToken("no-needed"),
-		openai.WithBaseURL("http://localhost:11434/v1"),
+// writeSkill creates a skill package in dir
+func writeSkill(t *testing.T, dir, name, description, body string) {
+	t.Helper()
+	skillDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(skillDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := fmt.Sprintf("---\nname: %s\ndescription: %s\n---\n%s\n", name, description, body)
+	if err := os.WriteFile(filepath.Join(skillDir, "SKILL.md"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type addArgs struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+// addTool returns a tool adding two numbers, it records its calls
+func addTool(calls *[]addArgs) tools.ITool {
+	return tools.NewFunc("add", "Add two numbers", func(_ context.Context, args addArgs) (string, error) {
+		*calls = append(*calls, args)
+		return fmt.Sprint(args.A + args.B), nil
+	})
+}
+
+func TestTextChatAgentChatStream(t *testing.T) {
+	model := llmtest.New(
+		llmtest.Response{Chunks: []string{"Hel", "lo"}, Usage: &llmtest.Usage{PromptTokens: 10, CompletionTokens: 2}},
+		llmtest.Text("again").Expecting(llmtest.ExpectContains("Hello")),
 	)
+	a := NewTextChatAgent(model)
+	defer a.Close()
+
+	var chunks []string
+	var usage *Usage
+	ctx := WithEventHandler(WithSessionID(context.Background(), "s1"), func(_ context.Context, event Event) {
+		if event.Type == EventUsage {
+			usage = event.Usage
+		}
+	})
+	resp, err := a.ChatStream(ctx, "hi", false, false, func(_ context.Context, chunk []byte) error {
+		chunks = append(chunks, string(chunk))
+		return nil
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	textChat := NewTextChatAgent(llm, WithSkill("/Users/wangyingbin/Developer/go/src/ai/gollmagent/tmp/skills"))
-	if textChat == nil {
-		t.Fatal("TextChatAgent is nil")
+	if resp != "Hello" || !slices.Equal(chunks, []string{"Hel", "lo"}) {
+		t.Errorf("Expected 'Hello' streamed in 2 chunks, got '%s' and %v", resp, chunks)
+	}
+	if usage == nil || usage.TotalTokens != 12 {
+		t.Errorf("Expected usage of 12 tokens, got %+v", usage)
+	}
+
+	// the second turn sends the first one
+	if _, err := a.Chat(ctx, "and again", false, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []llms.ChatMessageType{llms.ChatMessageTypeSystem, llms.ChatMessageTypeHuman, llms.ChatMessageTypeAI, llms.ChatMessageTypeHuman}
+	if roles := model.LastCall(t).Roles(); !slices.Equal(roles, want) {
+		t.Errorf("Expected roles %v, got %v", want, roles)
+	}
+	model.AssertExpectations(t)
+}
+
+func TestTextChatAgentModelError(t *testing.T) {
+	errDown := errors.New("model down")
+	model := llmtest.New(llmtest.Fail(errDown))
+	a := NewTextChatAgent(model)
+	defer a.Close()
+
+	if _, err := a.Chat(context.Background(), "hi", false, false); !errors.Is(err, errDown) {
+		t.Errorf("Expected the model error, got %v", err)
+	}
+}
+
+func TestTextChatAgentCanceled(t *testing.T) {
+	model := llmtest.New(llmtest.Response{Content: "late", Latency: time.Hour})
+	a := NewTextChatAgent(model)
+	defer a.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.Chat(ctx, "hi", false, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestTextChatAgentSkillSelection(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill(t, dir, "greeter", "Greets people warmly", "Always answer with a greeting.")
+	writeSkill(t, dir, "counter", "Counts words", "Count the words of the message.")
+
+	tests := []struct {
+		name      string
+		decision  string
+		responses []llmtest.Response
+		want      string
+		skill     string
+	}{
+		{
+			name:     "skill selected",
+			decision: `{"use_skill": true, "skill_name": "greeter", "reason": "greeting"}`,
+			responses: []llmtest.Response{
+				llmtest.Text("Hello there!").Expecting(llmtest.ExpectContains("Skill: greeter")),
+			},
+			want:  "Hello there!",
+			skill: "greeter",
+		},
+		{
+			name:      "no skill needed",
+			decision:  `{"use_skill": false, "reason": "small talk"}`,
+			responses: []llmtest.Response{llmtest.Text("plain answer")},
+			want:      "plain answer",
+		},
+		{
+			name:      "fenced decision",
+			decision:  "```json\n{\"use_skill\": true, \"skill_name\": \"counter\"}\n```",
+			responses: []llmtest.Response{llmtest.Text("3 words").Expecting(llmtest.ExpectContains("Skill: counter"))},
+			want:      "3 words",
+			skill:     "counter",
+		},
+		{
+			name:      "unknown skill",
+			decision:  `{"use_skill": true, "skill_name": "missing"}`,
+			responses: []llmtest.Response{llmtest.Text("plain answer")},
+			want:      "plain answer",
+		},
+		{
+			name:      "invalid decision",
+			decision:  `not json`,
+			responses: []llmtest.Response{llmtest.Text("plain answer")},
+			want:      "plain answer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := llmtest.New(llmtest.Text(tt.decision).Expecting(func(call llmtest.Call) error {
+				if !call.Contains("- greeter: Greets people warmly") || !call.Contains("User message: hello") {
+					return errors.New("expected the skills and the message in the selection prompt")
+				}
+				return nil
+			}))
+			model.Add(tt.responses...)
+			a := NewTextChatAgent(model, WithSkill(dir))
+			defer a.Close()
+
+			var selected string
+			ctx := WithEventHandler(context.Background(), func(_ context.Context, event Event) {
+				if event.Type == EventSkillSelected {
+					selected = event.Skill
+				}
+			})
+			resp, err := a.Chat(ctx, "hello", true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp != tt.want {
+				t.Errorf("Expected response '%s', got '%s'", tt.want, resp)
+			}
+			if selected != tt.skill {
+				t.Errorf("Expected selected skill '%s', got '%s'", tt.skill, selected)
+			}
+			model.AssertExpectations(t)
+		})
 	}
-	time.Sleep(3 * time.Second)
-	resp, err := textChat.Chat(context.Background(), msg, true, true)
+}
+
+func TestTextChatAgentSkillsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill(t, dir, "greeter", "Greets people warmly", "Always answer with a greeting.")
+	model := llmtest.New(llmtest.Text("plain answer").Expecting(llmtest.ExpectLastText("hello")))
+	a := NewTextChatAgent(model, WithSkill(dir))
+	defer a.Close()
+
+	if _, err := a.Chat(context.Background(), "hello", false, false); err != nil {
+		t.Fatal(err)
+	}
+	model.AssertCalls(t, 1)
+	model.AssertExpectations(t)
+}
+
+func TestTextChatAgentToolRouting(t *testing.T) {
+	t.Run("native tool calls", func(t *testing.T) {
+		var calls []addArgs
+		model := llmtest.New(
+			llmtest.ToolCall("add", `{"a": 1, "b": 2}`).Expecting(llmtest.ExpectTools("add")),
+			llmtest.Text("1 + 2 = 3").Expecting(func(call llmtest.Call) error {
+				if !slices.Contains(call.Roles(), llms.ChatMessageTypeTool) {
+					return errors.New("expected the tool result to be sent")
+				}
+				return nil
+			}),
+		)
+		a := NewTextChatAgent(model, WithTools(addTool(&calls)), ModelToolSupport(true))
+		defer a.Close()
+
+		resp, err := a.Chat(context.Background(), "what is 1 + 2?", false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != "1 + 2 = 3" {
+			t.Errorf("Expected response '1 + 2 = 3', got '%s'", resp)
+		}
+		if len(calls) != 1 || calls[0] != (addArgs{A: 1, B: 2}) {
+			t.Errorf("Expected add to be called with 1 and 2, got %v", calls)
+		}
+		model.AssertExpectations(t)
+	})
+
+	t.Run("tool selection without native tool calls", func(t *testing.T) {
+		var calls []addArgs
+		model := llmtest.New(
+			llmtest.Text(`{"use_tool": true, "tool_name": "add", "args": {"a": 2, "b": 3}, "reason": "math"}`).
+				Expecting(llmtest.ExpectContains("- add: Add two numbers")),
+		)
+		a := NewTextChatAgent(model, WithTools(addTool(&calls)))
+		defer a.Close()
+
+		resp, err := a.Chat(context.Background(), "what is 2 + 3?", false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(resp, "'add' tool") || !strings.HasSuffix(resp, "5") {
+			t.Errorf("Expected the result of the add tool, got '%s'", resp)
+		}
+		if len(calls) != 1 {
+			t.Errorf("Expected add to be called once, got %d", len(calls))
+		}
+		model.AssertExpectations(t)
+	})
+
+	t.Run("no tool selected", func(t *testing.T) {
+		var calls []addArgs
+		model := llmtest.New(
+			llmtest.Text(`{"use_tool": false, "reason": "greeting"}`),
+			llmtest.Text("hi!"),
+		)
+		a := NewTextChatAgent(model, WithTools(addTool(&calls)))
+		defer a.Close()
+
+		resp, err := a.Chat(context.Background(), "hello", false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != "hi!" || len(calls) != 0 {
+			t.Errorf("Expected a plain answer without tool calls, got '%s' and %v", resp, calls)
+		}
+		model.AssertExpectations(t)
+	})
+
+	t.Run("tools disabled", func(t *testing.T) {
+		var calls []addArgs
+		model := llmtest.New(llmtest.Text("hi!").Expecting(func(call llmtest.Call) error {
+			if names := call.ToolNames(); len(names) > 0 {
+				return fmt.Errorf("expected no tools, got %v", names)
+			}
+			return nil
+		}))
+		a := NewTextChatAgent(model, WithTools(addTool(&calls)), ModelToolSupport(true))
+		defer a.Close()
+
+		if _, err := a.Chat(context.Background(), "hello", false, false); err != nil {
+			t.Fatal(err)
+		}
+		model.AssertExpectations(t)
+	})
+}
+
+func TestTextChatAgentSkillResources(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill(t, dir, "greeter", "Greets people warmly", "Follow the greeting guide.")
+	if err := os.MkdirAll(filepath.Join(dir, "greeter", "references"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "greeter", "references", "guide.md"), []byte("Always greet with 'Howdy'."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	model := llmtest.New(
+		llmtest.Text(`{"use_skill": true, "skill_name": "greeter"}`),
+		llmtest.ToolCall("read_skill_resource", `{"path": "references/guide.md"}`).Expecting(func(call llmtest.Call) error {
+			if !call.Contains("- references/guide.md") || call.Contains("Howdy") {
+				return errors.New("expected the resources to be listed but not loaded")
+			}
+			return llmtest.ExpectTools("read_skill_resource")(call)
+		}),
+		llmtest.Text("Howdy!").Expecting(func(call llmtest.Call) error {
+			for _, part := range call.Messages[len(call.Messages)-1].Parts {
+				if resp, ok := part.(llms.ToolCallResponse); ok && strings.Contains(resp.Content, "Always greet with 'Howdy'.") {
+					return nil
+				}
+			}
+			return errors.New("expected the guide to be sent as the tool response")
+		}),
+	)
+	a := NewTextChatAgent(model, WithSkill(dir), ModelToolSupport(true))
+	defer a.Close()
+
+	resp, err := a.Chat(context.Background(), "hello", true, false)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(resp)
+	if resp != "Howdy!" {
+		t.Errorf("Expected response 'Howdy!', got '%s'", resp)
+	}
+	model.AssertExpectations(t)
+}
+
+func TestParseSkillCommand(t *testing.T) {
+	tests := []struct {
+		message string
+		name    string
+		args    string
+		ok      bool
+	}{
+		{"/greeter say hi to Bob", "greeter", "say hi to Bob", true},
+		{"  /counter\none two three ", "counter", "one two three", true},
+		{"/skills", "skills", "", true},
+		{"/usr/bin is a path", "", "", false},
+		{"hello /greeter", "", "", false},
+		{"/", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseSkillCommand(tt.message)
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("Expected (%q, %q, %v) for %q, got (%q, %q, %v)", tt.name, tt.args, tt.ok, tt.message, name, args, ok)
+		}
+	}
+}
+
+func TestTextChatAgentSkillsNamedSkills(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill(t, dir, "skills", "Manages skill packages", "Explain how skill packages work.")
+	model := llmtest.New(llmtest.Text("Skills are packages").Expecting(llmtest.ExpectContains("Skill: skills")))
+	a := NewTextChatAgent(model, WithSkill(dir))
+	defer a.Close()
+
+	// the loaded skill takes precedence over the listing
+	resp, err := a.Chat(WithSessionID(context.Background(), "s1"), "/skills what are they", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "Skills are packages" {
+		t.Errorf("Expected the answer of the skill, got '%s'", resp)
+	}
+	model.AssertExpectations(t)
+}
+
+func TestTextChatAgentSkillCommands(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill(t, dir, "greeter", "Greets people warmly", "Always answer with a greeting.")
+	writeSkill(t, dir, "counter", "Counts words", "Count the words of the message.")
+	// answer of the skill selection of messages which are not commands
+	noSkill := llmtest.Text(`{"use_skill": false, "reason": "no skill needed"}`)
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		message   string
+		responses []llmtest.Response
+		want      string
+		skill     string
+		history   int
+		err       error
+		// disabled runs the chat with skills disabled
+		disabled bool
+	}{
+		{
+			name:    "list skills",
+			message: "/skills",
+			want:    "Available skills, run one with /<skill> <task>:\n- /counter: Counts words\n- /greeter: Greets people warmly\n",
+		},
+		{
+			name:    "run skill",
+			message: "/greeter say hi to Bob",
+			// no selection call, the arguments are the task of the skill
+			responses: []llmtest.Response{llmtest.Text("Hi Bob!").Expecting(func(call llmtest.Call) error {
+				if !call.Contains("Skill: greeter") || call.LastText() != "say hi to Bob" {
+					return errors.New("expected the task to be run with the greeter skill")
+				}
+				return nil
+			})},
+			want:    "Hi Bob!",
+			skill:   "greeter",
+			history: 2,
+		},
+		{
+			name: "bare command",
+			ctx: WithHistory(context.Background(), []llms.MessageContent{
+				llms.TextParts(llms.ChatMessageTypeHuman, "say hi to Ann"),
+				llms.TextParts(llms.ChatMessageTypeAI, "Which language?"),
+			}),
+			message: "/greeter",
+			// the previous user message is the task, not the command
+			responses: []llmtest.Response{llmtest.Text("Hi Ann!").Expecting(func(call llmtest.Call) error {
+				if !call.Contains("Skill: greeter") || call.LastText() != "say hi to Ann" {
+					return errors.New("expected the previous message to be run with the greeter skill")
+				}
+				return nil
+			})},
+			want:    "Hi Ann!",
+			skill:   "greeter",
+			history: 4,
+		},
+		{
+			name:    "unknown skill",
+			message: "/missing do it",
+			responses: []llmtest.Response{noSkill, llmtest.Text("plain answer").Expecting(func(call llmtest.Call) error {
+				if call.LastText() != "/missing do it" {
+					return errors.New("expected the message to be passed to the model")
+				}
+				return nil
+			})},
+			want:    "plain answer",
+			history: 2,
+		},
+		{
+			name:      "not a command",
+			message:   "/usr/bin is a path",
+			responses: []llmtest.Response{noSkill, llmtest.Text("plain answer")},
+			want:      "plain answer",
+			history:   2,
+		},
+		{
+			name:      "skill of the request",
+			ctx:       WithSkillName(context.Background(), "counter"),
+			message:   "one two three",
+			responses: []llmtest.Response{llmtest.Text("3 words").Expecting(llmtest.ExpectContains("Skill: counter"))},
+			want:      "3 words",
+			skill:     "counter",
+			history:   2,
+		},
+		{
+			name:    "unknown skill of the request",
+			ctx:     WithSkillName(context.Background(), "missing"),
+			message: "one two three",
+			err:     ErrSkillNotFound,
+		},
+		{
+			name:    "command with skills disabled",
+			message: "/greeter say hi to Bob",
+			responses: []llmtest.Response{llmtest.Text("plain answer").Expecting(func(call llmtest.Call) error {
+				if call.Contains("Skill: greeter") || call.LastText() != "/greeter say hi to Bob" {
+					return errors.New("expected the message to be passed to the model")
+				}
+				return nil
+			})},
+			want:     "plain answer",
+			history:  2,
+			disabled: true,
+		},
+		{
+			name:     "skill of the request with skills disabled",
+			ctx:      WithSkillName(context.Background(), "counter"),
+			message:  "one two three",
+			err:      ErrSkillsDisabled,
+			disabled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := llmtest.New(tt.responses...)
+			a := NewTextChatAgent(model, WithSkill(dir))
+			defer a.Close()
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			var selected string
+			ctx = WithEventHandler(WithSessionID(ctx, "s1"), func(_ context.Context, event Event) {
+				if event.Type == EventSkillSelected {
+					selected = event.Skill
+				}
+			})
+			var streamed strings.Builder
+			resp, err := a.ChatStream(ctx, tt.message, !tt.disabled, false, func(_ context.Context, chunk []byte) error {
+				streamed.Write(chunk)
+				return nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if resp != tt.want || (tt.err == nil && streamed.String() != tt.want) {
+				t.Errorf("Expected response '%s', got '%s' streamed as '%s'", tt.want, resp, streamed.String())
+			}
+			if selected != tt.skill {
+				t.Errorf("Expected skill '%s', got '%s'", tt.skill, selected)
+			}
+			session, _ := a.sessions.Get(ctx, "s1")
+			if len(session.messages)-1 != tt.history {
+				t.Errorf("Expected %d history messages, got %d", tt.history, len(session.messages)-1)
+			}
+			model.AssertCalls(t, len(tt.responses))
+			model.AssertExpectations(t)
+		})
+	}
 }
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+)
+
+// VectorMatch is a search result of a VectorIndex
+type VectorMatch struct {
+	ID    string
+	Score float32 // cosine similarity with the query
+}
+
+// VectorIndex is an in-process vector index searched by cosine similarity, it is safe for concurrent use.
+// It is meant for small sets such as the skills, the search is exhaustive.
+type VectorIndex struct {
+	mu      sync.RWMutex
+	vectors map[string][]float32 // normalized vectors by id
+}
+
+// NewVectorIndex creates an empty vector index
+func NewVectorIndex() *VectorIndex {
+	return &VectorIndex{vectors: make(map[string][]float32)}
+}
+
+// Upsert adds or replaces the vector of id
+func (x *VectorIndex) Upsert(id string, vector []float32) {
+	normalized := normalize(vector)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.vectors[id] = normalized
+}
+
+// Remove removes the vector of id
+func (x *VectorIndex) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.vectors, id)
+}
+
+// Has reports whether id is in the index
+func (x *VectorIndex) Has(id string) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	_, ok := x.vectors[id]
+	return ok
+}
+
+// Len returns the number of vectors in the index
+func (x *VectorIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.vectors)
+}
+
+// Search returns the k vectors most similar to query, best first.
+// filter limits the search to the ids it accepts, nil searches all vectors.
+// Vectors whose dimension differs from the query are skipped.
+func (x *VectorIndex) Search(query []float32, k int, filter func(id string) bool) []VectorMatch {
+	q := normalize(query)
+	x.mu.RLock()
+	var matches []VectorMatch
+	for id, v := range x.vectors {
+		if len(v) != len(q) || (filter != nil && !filter(id)) {
+			continue
+		}
+		var dot float32
+		for i := range v {
+			dot += v[i] * q[i]
+		}
+		matches = append(matches, VectorMatch{ID: id, Score: dot})
+	}
+	x.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b VectorMatch) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// normalize returns a copy of v scaled to unit length, a zero vector stays zero
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		return out
+	}
+	norm := math.Sqrt(sum)
+	for i, f := range v {
+		out[i] = float32(float64(f) / norm)
+	}
+	return out
+}
@@ -0,0 +1,330 @@
+// Package llmtest provides a scripted llms.Model for deterministic tests of the agents
+package llmtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrScriptExhausted is returned when the model is called after its last scripted response
+var ErrScriptExhausted = errors.New("llmtest: no scripted response left")
+
+// Response is a scripted model response
+type Response struct {
+	// Content is the text of the response, the concatenated chunks when empty
+	Content string
+	// Chunks are streamed in order when the call has a streaming func, Content is streamed as one chunk when empty
+	Chunks []string
+	// ToolCalls are returned with the response
+	ToolCalls []llms.ToolCall
+	// Err is returned instead of the response
+	Err error
+	// Latency delays the response, the call returns early with the context error when canceled
+	Latency time.Duration
+	// Usage is reported in the generation info as PromptTokens and CompletionTokens when set
+	Usage *Usage
+	// Expect checks the call before the response is returned, its error fails the call and is reported by AssertExpectations
+	Expect func(call Call) error
+}
+
+// Expecting returns a copy of the response checking its call with expect
+func (r Response) Expecting(expect func(call Call) error) Response {
+	r.Expect = expect
+	return r
+}
+
+// Usage is the token usage reported by a response
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Text returns a response with content
+func Text(content string) Response {
+	return Response{Content: content}
+}
+
+// Stream returns a response streaming chunks
+func Stream(chunks ...string) Response {
+	return Response{Chunks: chunks}
+}
+
+// Fail returns a response failing the call with err
+func Fail(err error) Response {
+	return Response{Err: err}
+}
+
+// ToolCall returns a response calling the tool name with arguments, the call ID is derived from the name
+func ToolCall(name, arguments string) Response {
+	return Response{ToolCalls: []llms.ToolCall{NewToolCall("call_"+name, name, arguments)}}
+}
+
+// NewToolCall returns a function tool call
+func NewToolCall(id, name, arguments string) llms.ToolCall {
+	return llms.ToolCall{
+		ID:           id,
+		Type:         "function",
+		FunctionCall: &llms.FunctionCall{Name: name, Arguments: arguments},
+	}
+}
+
+// Call is a call received by the model
+type Call struct {
+	Messages []llms.MessageContent
+	Options  llms.CallOptions
+}
+
+// Text returns the text parts of message i joined by newlines, negative indexes count from the end
+func (c Call) Text(i int) string {
+	if i < 0 {
+		i += len(c.Messages)
+	}
+	if i < 0 || i >= len(c.Messages) {
+		return ""
+	}
+	var texts []string
+	for _, part := range c.Messages[i].Parts {
+		if text, ok := part.(llms.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// LastText returns the text of the last message
+func (c Call) LastText() string {
+	return c.Text(-1)
+}
+
+// Contains reports whether the text of any message contains s
+func (c Call) Contains(s string) bool {
+	for i := range c.Messages {
+		if strings.Contains(c.Text(i), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles returns the roles of the messages
+func (c Call) Roles() []llms.ChatMessageType {
+	roles := make([]llms.ChatMessageType, len(c.Messages))
+	for i, m := range c.Messages {
+		roles[i] = m.Role
+	}
+	return roles
+}
+
+// ToolNames returns the names of the tools offered to the model
+func (c Call) ToolNames() []string {
+	var names []string
+	for _, t := range c.Options.Tools {
+		if t.Function != nil {
+			names = append(names, t.Function.Name)
+		}
+	}
+	return names
+}
+
+// Model is a scripted llms.Model, it is safe for concurrent use.
+// Calls take the scripted responses in order, Respond answers the calls once the script is exhausted.
+type Model struct {
+	// Respond answers the calls after the scripted responses, ErrScriptExhausted is returned when nil
+	Respond func(call Call) Response
+
+	mu        sync.Mutex
+	responses []Response
+	calls     []Call
+	failures  []error
+}
+
+// New returns a model answering with responses in order
+func New(responses ...Response) *Model {
+	return &Model{responses: responses}
+}
+
+// Add appends responses to the script
+func (m *Model) Add(responses ...Response) *Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses = append(m.responses, responses...)
+	return m
+}
+
+// GenerateContent implements llms.Model
+func (m *Model) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	call := Call{Messages: append([]llms.MessageContent(nil), messages...), Options: opts}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	n := len(m.calls)
+	var resp Response
+	var ok bool
+	if len(m.responses) > 0 {
+		resp, ok = m.responses[0], true
+		m.responses = m.responses[1:]
+	}
+	respond := m.Respond
+	m.mu.Unlock()
+
+	if !ok {
+		if respond == nil {
+			return nil, ErrScriptExhausted
+		}
+		resp = respond(call)
+	}
+	if resp.Expect != nil {
+		if err := resp.Expect(call); err != nil {
+			err = fmt.Errorf("llmtest: call %d: %w", n, err)
+			m.mu.Lock()
+			m.failures = append(m.failures, err)
+			m.mu.Unlock()
+			return nil, err
+		}
+	}
+	if resp.Latency > 0 {
+		timer := time.NewTimer(resp.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+
+	content := resp.Content
+	if content == "" {
+		content = strings.Join(resp.Chunks, "")
+	}
+	if opts.StreamingFunc != nil {
+		chunks := resp.Chunks
+		if len(chunks) == 0 && content != "" {
+			chunks = []string{content}
+		}
+		for _, chunk := range chunks {
+			if err := opts.StreamingFunc(ctx, []byte(chunk)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	choice := &llms.ContentChoice{Content: content, ToolCalls: resp.ToolCalls}
+	if len(resp.ToolCalls) > 0 {
+		choice.StopReason = "tool_calls"
+	}
+	if resp.Usage != nil {
+		choice.GenerationInfo = map[string]any{
+			"PromptTokens":     resp.Usage.PromptTokens,
+			"CompletionTokens": resp.Usage.CompletionTokens,
+			"TotalTokens":      resp.Usage.PromptTokens + resp.Usage.CompletionTokens,
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{choice}}, nil
+}
+
+// Call implements llms.Model
+func (m *Model) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// Calls returns the calls received so far
+func (m *Model) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallCount returns the number of calls received so far
+func (m *Model) CallCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.calls)
+}
+
+// LastCall returns the last call received, it fails the test when there is none
+func (m *Model) LastCall(t testing.TB) Call {
+	t.Helper()
+	calls := m.Calls()
+	if len(calls) == 0 {
+		t.Fatal("Expected the model to be called")
+	}
+	return calls[len(calls)-1]
+}
+
+// Remaining returns the number of scripted responses not used yet
+func (m *Model) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.responses)
+}
+
+// AssertCalls fails the test when the model did not receive n calls
+func (m *Model) AssertCalls(t testing.TB, n int) {
+	t.Helper()
+	if got := m.CallCount(); got != n {
+		t.Errorf("Expected %d model calls, got %d", n, got)
+	}
+}
+
+// AssertExpectations fails the test when a call did not meet the expectation of its response
+// or when scripted responses were not used
+func (m *Model) AssertExpectations(t testing.TB) {
+	t.Helper()
+	m.mu.Lock()
+	failures := append([]error(nil), m.failures...)
+	remaining := len(m.responses)
+	m.mu.Unlock()
+	for _, err := range failures {
+		t.Error(err)
+	}
+	if remaining > 0 {
+		t.Errorf("Expected all scripted responses to be used, %d left", remaining)
+	}
+}
+
+// ExpectLastText returns an expectation checking that the last message contains s
+func ExpectLastText(s string) func(call Call) error {
+	return func(call Call) error {
+		if !strings.Contains(call.LastText(), s) {
+			return fmt.Errorf("expected last message to contain '%s', got '%s'", s, call.LastText())
+		}
+		return nil
+	}
+}
+
+// ExpectContains returns an expectation checking that a message contains s
+func ExpectContains(s string) func(call Call) error {
+	return func(call Call) error {
+		if !call.Contains(s) {
+			return fmt.Errorf("expected a message to contain '%s'", s)
+		}
+		return nil
+	}
+}
+
+// ExpectTools returns an expectation checking that the named tools are offered to the model
+func ExpectTools(names ...string) func(call Call) error {
+	return func(call Call) error {
+		offered := call.ToolNames()
+		for _, name := range names {
+			if !slices.Contains(offered, name) {
+				return fmt.Errorf("expected tool '%s' to be offered, got %v", name, offered)
+			}
+		}
+		return nil
+	}
+}
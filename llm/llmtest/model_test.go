@@ -0,0 +1,88 @@
+package llmtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestModelScript(t *testing.T) {
+	errDown := errors.New("down")
+	m := New(Text("one"), Fail(errDown))
+	ctx := context.Background()
+
+	if resp, err := m.Call(ctx, "first"); err != nil || resp != "one" {
+		t.Errorf("Expected 'one', got '%s' (%v)", resp, err)
+	}
+	if _, err := m.Call(ctx, "second"); !errors.Is(err, errDown) {
+		t.Errorf("Expected the scripted error, got %v", err)
+	}
+	if _, err := m.Call(ctx, "third"); !errors.Is(err, ErrScriptExhausted) {
+		t.Errorf("Expected ErrScriptExhausted, got %v", err)
+	}
+	m.AssertCalls(t, 3)
+	if got := m.Calls()[1].LastText(); got != "second" {
+		t.Errorf("Expected the second call to be recorded, got '%s'", got)
+	}
+
+	m.Respond = func(call Call) Response { return Text("re: " + call.LastText()) }
+	if resp, _ := m.Call(ctx, "fourth"); resp != "re: fourth" {
+		t.Errorf("Expected 're: fourth', got '%s'", resp)
+	}
+}
+
+func TestModelStream(t *testing.T) {
+	m := New(Stream("a", "b"), Text("whole"))
+	var chunks []string
+	stream := llms.WithStreamingFunc(func(_ context.Context, chunk []byte) error {
+		chunks = append(chunks, string(chunk))
+		return nil
+	})
+	if resp, _ := m.Call(context.Background(), "hi", stream); resp != "ab" {
+		t.Errorf("Expected 'ab', got '%s'", resp)
+	}
+	if resp, _ := m.Call(context.Background(), "hi", stream); resp != "whole" {
+		t.Errorf("Expected 'whole', got '%s'", resp)
+	}
+	if len(chunks) != 3 || chunks[0] != "a" || chunks[1] != "b" || chunks[2] != "whole" {
+		t.Errorf("Unexpected chunks: %v", chunks)
+	}
+}
+
+func TestModelToolCall(t *testing.T) {
+	m := New(ToolCall("add", `{"a":1}`).Expecting(ExpectTools("add")))
+	tool := llms.Tool{Type: "function", Function: &llms.FunctionDefinition{Name: "add"}}
+	resp, err := m.GenerateContent(context.Background(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi")}, llms.WithTools([]llms.Tool{tool}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := resp.Choices[0].ToolCalls
+	if len(calls) != 1 || calls[0].FunctionCall.Name != "add" || calls[0].FunctionCall.Arguments != `{"a":1}` {
+		t.Errorf("Unexpected tool calls: %+v", calls)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestModelExpectation(t *testing.T) {
+	m := New(Text("ok").Expecting(ExpectLastText("hello")))
+	if _, err := m.Call(context.Background(), "bye"); err == nil {
+		t.Error("Expected the call to fail the expectation")
+	}
+	inner := &testing.T{}
+	m.AssertExpectations(inner)
+	if !inner.Failed() {
+		t.Error("Expected AssertExpectations to report the failed expectation")
+	}
+}
+
+func TestModelLatency(t *testing.T) {
+	m := New(Response{Content: "late", Latency: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Call(ctx, "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -284,6 +285,10 @@ func ParseSkillPackage(dirPath string) (*Package, error) {
 	} else {
 		return nil, fmt.Errorf("neither SKILL.md nor skill.md found in skill directory: %s", dirPath)
 	}
+	// The name becomes a path element of workspaces and tool names, it must not escape a directory
+	if strings.ContainsAny(meta.Name, `/\`) || strings.Contains(meta.Name, "..") {
+		return nil, fmt.Errorf("invalid skill name '%s': it must not contain path separators or '..'", meta.Name)
+	}
 
 	// 2. Find resource files
 	scripts, err := findResourceFiles(dirPath, "scripts")
@@ -346,11 +351,12 @@ func ParseSkillPackages(rootDir string) ([]*Package, error) {
 	var packages []*Package
 	for dir := range skillDirs {
 		pkg, err := ParseSkillPackage(dir)
-		if err == nil {
-			packages = append(packages, pkg)
+		if err != nil {
+			// Skip packages that fail to parse, see ValidateDir for all problems of a package
+			log.Printf("Skip skill package %s: %v", dir, err)
+			continue
 		}
-
-		// Silently ignore packages that fail to parse
+		packages = append(packages, pkg)
 	}
 
 	return packages, nil
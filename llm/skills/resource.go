@@ -0,0 +1,198 @@
+package skills
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/kinwyb/langchat/llm/tools"
+)
+
+// ResourceToolName is the name of the tool reading the resources of a skill
+const ResourceToolName = "read_skill_resource"
+
+const (
+	// DefaultMaxResourceBytes is the size of the text returned by one read_skill_resource call,
+	// larger resources are read in pages
+	DefaultMaxResourceBytes = 32 * 1024
+	// maxResourceFileBytes is the size limit of a resource file
+	maxResourceFileBytes = 10 << 20
+)
+
+// All returns the paths of all resource files relative to the package, in the slash separated form
+func (r Resources) All() []string {
+	var all []string
+	for _, group := range [][]string{r.References, r.Templates, r.Assets, r.Scripts} {
+		for _, p := range group {
+			all = append(all, filepath.ToSlash(p))
+		}
+	}
+	return all
+}
+
+// ResourcesPrompt returns the listing of the resources of a skill for its system prompt, empty when it has none.
+// The resources are not loaded, the model reads them with read_skill_resource when it needs them.
+func ResourcesPrompt(pkg *Package) string {
+	if len(pkg.Resources.All()) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Skill resources, read them with the " + ResourceToolName + " tool when the task needs them:\n")
+	for _, group := range []struct {
+		name  string
+		paths []string
+	}{
+		{"References", pkg.Resources.References},
+		{"Templates", pkg.Resources.Templates},
+		{"Assets", pkg.Resources.Assets},
+		{"Scripts", pkg.Resources.Scripts},
+	} {
+		if len(group.paths) == 0 {
+			continue
+		}
+		sb.WriteString(group.name + ":\n")
+		for _, p := range group.paths {
+			sb.WriteString("- " + filepath.ToSlash(p) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// ResourceTool reads the resource files of a skill on demand.
+// Text files are returned in pages of MaxBytes, HTML is converted to text and binary files are described.
+type ResourceTool struct {
+	pkg *Package
+	// MaxBytes is the size of a page, DefaultMaxResourceBytes when zero
+	MaxBytes int
+}
+
+// NewResourceTool creates the read_skill_resource tool of a skill package
+func NewResourceTool(pkg *Package) *ResourceTool {
+	return &ResourceTool{pkg: pkg}
+}
+
+func (t *ResourceTool) Name() string {
+	return ResourceToolName
+}
+
+func (t *ResourceTool) Description() string {
+	return fmt.Sprintf("Reads a resource file (reference, template, asset or script) of the skill '%s'. "+
+		"Call it without a path to list the resources. Long files are returned in pages, pass the offset given at the end of a page to read the next one.", t.pkg.Meta.Name)
+}
+
+func (t *ResourceTool) Paramters() any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Path of the resource relative to the skill, e.g. references/guide.md",
+			},
+			"offset": map[string]any{
+				"type":        "integer",
+				"description": "Byte offset to start reading from, 0 by default",
+			},
+		},
+	}
+}
+
+func (t *ResourceTool) DescriptionWithParamters() string {
+	return t.Description() + " Parameters: path(string) resource path relative to the skill, offset(integer) byte offset of the page"
+}
+
+func (t *ResourceTool) Call(_ context.Context, input string) (string, error) {
+	var params struct {
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+	}
+	if strings.TrimSpace(input) != "" {
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal %s arguments: %w", ResourceToolName, err)
+		}
+	}
+	all := t.pkg.Resources.All()
+	if params.Path == "" {
+		if len(all) == 0 {
+			return "The skill has no resources.", nil
+		}
+		return ResourcesPrompt(t.pkg), nil
+	}
+
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(params.Path), "./"))
+	if !slices.Contains(all, name) {
+		return "", fmt.Errorf("resource '%s' not found, the resources are: %s", params.Path, strings.Join(all, ", "))
+	}
+	// The workspace rejects symbolic links leading out of the skill
+	ws := &tools.Workspace{ReadOnly: []string{t.pkg.Path}, MaxReadBytes: maxResourceFileBytes}
+	content, err := ws.ReadFile(filepath.FromSlash(name))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(content) || strings.ContainsRune(content, 0) {
+		return fmt.Sprintf("'%s' is a binary file (%s, %d bytes), it cannot be read as text. Use it by its path.",
+			name, http.DetectContentType([]byte(content)), len(content)), nil
+	}
+	text, err := extractText(name, content)
+	if err != nil {
+		return "", err
+	}
+	maxBytes := t.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResourceBytes
+	}
+	return page(text, params.Offset, maxBytes), nil
+}
+
+// extractText returns the text of a text resource, HTML is converted to text
+func extractText(name string, content string) (string, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse HTML of '%s': %w", name, err)
+		}
+		doc.Find("script, style").Remove()
+		return strings.TrimSpace(doc.Text()), nil
+	}
+	return content, nil
+}
+
+// page returns the page of text starting at offset, a note at its end gives the offset of the next page
+func page(text string, offset, size int) string {
+	offset = max(offset, 0)
+	if offset >= len(text) {
+		if offset == 0 {
+			return text
+		}
+		return fmt.Sprintf("Offset %d is past the end of the resource (%d bytes).", offset, len(text))
+	}
+	// start and end on rune boundaries
+	for offset > 0 && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	end := min(offset+size, len(text))
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	if end == offset {
+		_, n := utf8.DecodeRuneInString(text[offset:])
+		end = offset + n
+	}
+	if offset == 0 && end == len(text) {
+		return text
+	}
+	result := text[offset:end]
+	if end < len(text) {
+		result += fmt.Sprintf("\n\n[Showing bytes %d-%d of %d, call again with offset %d for more]", offset, end, len(text), end)
+	} else {
+		result += fmt.Sprintf("\n\n[Showing bytes %d-%d of %d, end of resource]", offset, end, len(text))
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package skills
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResourceTool(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, map[string]string{
+		"SKILL.md":             "---\nname: greeter\ndescription: Greets people by name when they say hello\n---\nSay hello.\n",
+		"references/guide.md":  "# Guide\nSay hello politely.",
+		"references/long.txt":  strings.Repeat("abcdefghij", 10),
+		"references/page.html": "<html><head><style>p{}</style></head><body><p>Hello <b>there</b></p><script>x()</script></body></html>",
+		"assets/logo.png":      "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"templates/letter.txt": "Dear {{name}}",
+	})
+	if err := os.WriteFile(filepath.Join(t.TempDir(), "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := ParseSkillPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skillTools, err := Tools(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tool *ResourceTool
+	for _, st := range skillTools {
+		if rt, ok := st.(*ResourceTool); ok {
+			tool = rt
+		}
+	}
+	if tool == nil {
+		t.Fatal("Expected the skill tools to include read_skill_resource")
+	}
+	tool.MaxBytes = 40
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "listing", input: `{}`, want: []string{"References:", "- references/guide.md", "Templates:", "- templates/letter.txt", "- assets/logo.png"}},
+		{name: "text", input: `{"path": "references/guide.md"}`, want: []string{"Say hello politely."}},
+		{name: "dot path", input: `{"path": "./templates/letter.txt"}`, want: []string{"Dear {{name}}"}},
+		{name: "first page", input: `{"path": "references/long.txt"}`, want: []string{"abcdefghij", "[Showing bytes 0-40 of 100, call again with offset 40 for more]"}},
+		{name: "last page", input: `{"path": "references/long.txt", "offset": 80}`, want: []string{"[Showing bytes 80-100 of 100, end of resource]"}},
+		{name: "html", input: `{"path": "references/page.html"}`, want: []string{"Hello there"}},
+		{name: "binary", input: `{"path": "assets/logo.png"}`, want: []string{"binary file (image/png, 16 bytes)"}},
+		{name: "unknown", input: `{"path": "SKILL.md"}`, wantErr: true},
+		{name: "escape", input: `{"path": "../secret.txt"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tool.Call(context.Background(), tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got '%s'", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Expected '%s' in '%s'", want, got)
+				}
+			}
+			if strings.Contains(got, "x()") || strings.Contains(got, "p{}") {
+				t.Errorf("Expected scripts and styles to be removed, got '%s'", got)
+			}
+		})
+	}
+}
+
+func TestResourcesPromptEmpty(t *testing.T) {
+	if prompt := ResourcesPrompt(&Package{}); prompt != "" {
+		t.Errorf("Expected no listing without resources, got '%s'", prompt)
+	}
+	skillTools, _ := Tools(&Package{Meta: Meta{Name: "plain", AllowedTools: []string{"read_file"}}})
+	for _, st := range skillTools {
+		if st.Name() == ResourceToolName {
+			t.Error("Expected no read_skill_resource tool without resources")
+		}
+	}
+}
@@ -18,7 +18,7 @@ type Skill struct {
 }
 
 // LoadSkills 加载技能
-func LoadSkills(skillsDir string) ([]*Skill, error) {
+func LoadSkills(skillsDir string, opts ...ToolOption) ([]*Skill, error) {
 	var skills []*Skill
 	if _, err := os.Stat(skillsDir); err == nil {
 		packages, err := ParseSkillPackages(skillsDir)
@@ -32,7 +32,7 @@ func LoadSkills(skillsDir string) ([]*Skill, error) {
 				Package:     skill,
 				Loaded:      false,
 			}
-			sk.Tools, err = Tools(skill)
+			sk.Tools, err = Tools(skill, opts...)
 			if err != nil {
 				log.Printf("Failed to load skill '%s' tools: %v", sk.Name, err)
 			}
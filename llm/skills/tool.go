@@ -3,20 +3,59 @@ package skills
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"log"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/kinwyb/langchat/llm/tools"
 	openai "github.com/sashabaranov/go-openai"
 )
 
-// Tool implements tools.Tool for skills.
+// ToolConfig configures how skill tools are executed
+type ToolConfig struct {
+	// Sandbox runs the code and script tools, tools.DefaultSandbox() when nil
+	Sandbox *tools.Sandbox
+	// Host runs the code and script tools directly on the host with the server environment instead of a sandbox
+	Host bool
+	// Workspace jails read_file and write_file when the call context carries no workspace (see tools.WithWorkspace).
+	// When both are nil write_file is refused and read_file only reads the skill directory.
+	// The skill directory is always mounted read-only.
+	Workspace *tools.Workspace
+}
+
+// ToolOption configures skill tools
+type ToolOption func(*ToolConfig)
+
+// WithSandbox 在沙箱中执行模型生成的代码
+func WithSandbox(sandbox *tools.Sandbox) ToolOption {
+	return func(c *ToolConfig) {
+		c.Sandbox = sandbox
+	}
+}
+
+// WithHostExecution 直接在本机执行模型生成的代码，不使用沙箱（不推荐）
+func WithHostExecution() ToolOption {
+	return func(c *ToolConfig) {
+		c.Host = true
+	}
+}
+
+// WithWorkspace 配置技能文件工具的默认工作目录
+func WithWorkspace(workspace *tools.Workspace) ToolOption {
+	return func(c *ToolConfig) {
+		c.Workspace = workspace
+	}
+}
+
+// Tool runs a script of the skill package, it is registered as run_<script path>
 type Tool struct {
-	scriptMap map[string]string
-	skillPath string
-	tool      openai.Tool
+	scriptPath string
+	skillPath  string
+	tool       openai.Tool
+	cfg        *ToolConfig
 }
 
 func (t *Tool) Paramters() any {
@@ -43,186 +82,127 @@ func (t *Tool) Description() string {
 
 func (t *Tool) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]any{
-		"skillPath": t.skillPath,
-		"scriptMap": t.scriptMap,
-		"tool":      t.tool,
+		"skillPath":  t.skillPath,
+		"scriptPath": t.scriptPath,
+		"tool":       t.tool,
 	})
 }
 
 func (t *Tool) Call(ctx context.Context, input string) (string, error) {
-	// input is the JSON string of arguments
-	// We need to parse it based on the tool name, similar to goskills runner.go
-	switch t.Name() {
-	case "run_shell_code":
-		var params struct {
-			Code string         `json:"code"`
-			Args map[string]any `json:"args"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal run_shell_code arguments: %w", err)
-		}
-		shellTool := tools.ShellTool{}
-		return shellTool.Run(params.Args, params.Code)
-
-	case "run_shell_script":
-		var params struct {
-			ScriptPath string   `json:"scriptPath"`
-			Args       []string `json:"args"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal run_shell_script arguments: %w", err)
-		}
-		return tools.RunShellScript(params.ScriptPath, params.Args)
-
-	case "run_python_code":
-		var params struct {
-			Code string         `json:"code"`
-			Args map[string]any `json:"args"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal run_python_code arguments: %w", err)
-		}
-		pythonTool := tools.PythonTool{}
-		return pythonTool.Run(params.Args, params.Code)
-
-	case "run_python_script":
-		var params struct {
-			ScriptPath string   `json:"scriptPath"`
-			Args       []string `json:"args"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal run_python_script arguments: %w", err)
-		}
-		return tools.RunPythonScript(params.ScriptPath, params.Args)
-
-	case "read_file":
-		var params struct {
-			FilePath string `json:"filePath"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal read_file arguments: %w", err)
-		}
-		path := params.FilePath
-		if !filepath.IsAbs(path) && t.skillPath != "" {
-			resolvedPath := filepath.Join(t.skillPath, path)
-			if _, err := os.Stat(resolvedPath); err == nil {
-				path = resolvedPath
-			}
-		}
-		return tools.ReadFile(path)
-
-	case "write_file":
-		var params struct {
-			FilePath string `json:"filePath"`
-			Content  string `json:"content"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal write_file arguments: %w", err)
-		}
-		err := tools.WriteFile(params.FilePath, params.Content)
-		if err == nil {
-			return fmt.Sprintf("Successfully wrote to file: %s", params.FilePath), nil
-		}
-		return "", err
-
-	case "wikipedia_search":
-		var params struct {
-			Query string `json:"query"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal wikipedia_search arguments: %w", err)
-		}
-		return tools.WikipediaSearch(params.Query)
-
-	case "tavily_search":
-		var params struct {
-			Query string `json:"query"`
-		}
-		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal tavily_search arguments: %w", err)
-		}
-		return tools.TavilySearch(params.Query)
-
-	case "web_fetch":
-		var params struct {
-			URL string `json:"url"`
-		}
+	var params struct {
+		Args []string `json:"args"`
+	}
+	if input != "" {
 		if err := json.Unmarshal([]byte(input), &params); err != nil {
-			return "", fmt.Errorf("failed to unmarshal web_fetch arguments: %w", err)
+			return "", fmt.Errorf("failed to unmarshal script arguments: %w", err)
 		}
-		return tools.WebFetch(params.URL)
-
-	default:
-		if scriptPath, ok := t.scriptMap[t.Name()]; ok {
-			var params struct {
-				Args []string `json:"args"`
-			}
-			if input != "" {
-				if err := json.Unmarshal([]byte(input), &params); err != nil {
-					return "", fmt.Errorf("failed to unmarshal script arguments: %w", err)
-				}
-			}
-			if strings.HasSuffix(scriptPath, ".py") {
-				return tools.RunPythonScript(scriptPath, params.Args)
-			}
-
-			return tools.RunShellScript(scriptPath, params.Args)
+	}
+	python := strings.HasSuffix(t.scriptPath, ".py")
+	if sandbox := t.cfg.sandbox(); sandbox != nil {
+		if python {
+			return sandbox.RunPythonScript(ctx, t.scriptPath, params.Args)
 		}
-		return "", fmt.Errorf("unknown tool: %s", t.Name())
+		return sandbox.RunShellScript(ctx, t.scriptPath, params.Args)
 	}
+	if python {
+		return tools.RunPythonScript(ctx, t.scriptPath, params.Args)
+	}
+	return tools.RunShellScript(ctx, t.scriptPath, params.Args)
 }
 
-// Tools converts a SkillPackage to a slice of tools.Tool.
-func Tools(skill *Package) ([]tools.ITool, error) {
-	availableTools, scriptMap := generateToolDefinitions(skill)
-	var result []tools.ITool
-
-	for _, t := range availableTools {
-		if t.Function.Name == "" {
-			continue
+// scriptPath resolves a script path, relative to the skill directory or absolute, to one of the scripts of the skill
+func scriptPath(skill *Package, path string) (string, error) {
+	rel := path
+	if filepath.IsAbs(path) && skill.Path != "" {
+		if r, err := filepath.Rel(skill.Path, path); err == nil {
+			rel = r
 		}
-
-		result = append(result, &Tool{
-			scriptMap: scriptMap,
-			skillPath: skill.Path,
-			tool:      t,
-		})
 	}
-	return result, nil
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	if !slices.Contains(skill.Resources.Scripts, rel) {
+		return "", fmt.Errorf("%w: %s is not a script of skill %s", tools.ErrScriptNotAllowed, path, skill.Meta.Name)
+	}
+	return filepath.Join(skill.Path, rel), nil
 }
 
-// generateToolDefinitions generates the list of OpenAI tools for a given skill.
-// It returns the tool definitions and a map of tool names to script paths for execution.
-func generateToolDefinitions(skill *Package) ([]openai.Tool, map[string]string) {
-	var tool []openai.Tool
-	scriptMap := make(map[string]string)
+// sandbox returns the sandbox of the script tools, nil when they run on the host
+func (c *ToolConfig) sandbox() *tools.Sandbox {
+	if c.Host {
+		return nil
+	}
+	if c.Sandbox != nil {
+		return c.Sandbox
+	}
+	return tools.DefaultSandbox()
+}
 
-	// 1. Base Tools
-	baseTools := tools.GetBaseTools()
+// workspace returns the workspace of the file tools with the skill directory mounted read-only,
+// without a workspace in ctx or the config the tools only read the skill directory
+func (c *ToolConfig) workspace(ctx context.Context, skill *Package) *tools.Workspace {
+	ws := tools.WorkspaceFromContext(ctx)
+	if ws == nil {
+		ws = c.Workspace
+	}
+	if ws == nil {
+		ws = &tools.Workspace{}
+	}
+	if skill.Path == "" {
+		return ws
+	}
+	return ws.WithReadOnly(skill.Path)
+}
 
-	if len(skill.Meta.AllowedTools) > 0 {
-		allowedMap := make(map[string]bool)
-		for _, t := range skill.Meta.AllowedTools {
-			allowedMap[t] = true
+// NewToolRegistry creates the registry of the tools of a skill package: the built-in tools
+// allowed by allowed-tools (all of them when it is empty), its script tools and read_skill_resource
+func NewToolRegistry(skill *Package, opts ...ToolOption) (*tools.Registry, error) {
+	cfg := &ToolConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	registry, _ := tools.NewRegistry()
+	builtin := tools.BuiltinConfig{
+		Sandbox: cfg.Sandbox,
+		Host:    cfg.Host,
+		Workspace: func(ctx context.Context) *tools.Workspace {
+			return cfg.workspace(ctx, skill)
+		},
+		Script: func(path string) (string, error) {
+			return scriptPath(skill, path)
+		},
+	}
+	if err := tools.RegisterBuiltinTools(registry, builtin, skill.Meta.AllowedTools...); err != nil {
+		return nil, err
+	}
+	for _, scriptRelPath := range skill.Resources.Scripts {
+		toolDef, _ := generateScriptTool(skill.Path, scriptRelPath)
+		err := registry.Register(&Tool{
+			scriptPath: filepath.Join(skill.Path, scriptRelPath),
+			skillPath:  skill.Path,
+			tool:       toolDef,
+			cfg:        cfg,
+		})
+		if errors.Is(err, tools.ErrToolExists) {
+			// A clashing script must not disable the whole skill
+			log.Printf("Skip script '%s' of skill '%s': %v", scriptRelPath, skill.Meta.Name, err)
+		} else if err != nil {
+			return nil, err
 		}
-
-		for _, t := range baseTools {
-			if allowedMap[t.Function.Name] {
-				tool = append(tool, t)
-			}
+	}
+	if len(skill.Resources.All()) > 0 {
+		if err := registry.Register(NewResourceTool(skill)); err != nil {
+			return nil, err
 		}
-	} else {
-		tool = append(tool, baseTools...)
 	}
+	return registry, nil
+}
 
-	// 2. Script Tools
-	for _, scriptRelPath := range skill.Resources.Scripts {
-		toolDef, toolName := generateScriptTool(skill.Path, scriptRelPath)
-		tool = append(tool, toolDef)
-		scriptMap[toolName] = filepath.Join(skill.Path, scriptRelPath)
+// Tools returns the tools of a skill package, see NewToolRegistry
+func Tools(skill *Package, opts ...ToolOption) ([]tools.ITool, error) {
+	registry, err := NewToolRegistry(skill, opts...)
+	if err != nil {
+		return nil, err
 	}
-
-	return tool, scriptMap
+	return registry.Tools(), nil
 }
 
 func generateScriptTool(skillPath, scriptRelPath string) (openai.Tool, string) {
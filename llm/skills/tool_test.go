@@ -0,0 +1,136 @@
+package skills
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kinwyb/langchat/llm/tools"
+)
+
+func TestNewToolRegistry(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, map[string]string{
+		"SKILL.md":         "---\nname: greeter\ndescription: Greets people by name\nallowed-tools: [read_file, write_file]\n---\nRun the hello script.\n",
+		"scripts/hello.sh": "echo \"hello $1\"\n",
+	})
+	pkg, err := ParseSkillPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := NewToolRegistry(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"read_file", "write_file", "run_scripts_hello_sh", ResourceToolName}
+	if names := registry.Names(); !slices.Equal(names, want) {
+		t.Fatalf("Expected tools %v, got %v", want, names)
+	}
+
+	ctx := tools.WithWorkspace(context.Background(), &tools.Workspace{Root: t.TempDir()})
+	if _, err := registry.Call(ctx, "write_file", `{"filePath": "note.txt", "content": "hi"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := registry.Call(ctx, "read_file", `{"filePath": "note.txt"}`); err != nil || got != "hi" {
+		t.Errorf("Expected 'hi', got '%s' (%v)", got, err)
+	}
+	// the skill directory is mounted read-only
+	if got, err := registry.Call(ctx, "read_file", `{"filePath": "scripts/hello.sh"}`); err != nil || !strings.Contains(got, "hello") {
+		t.Errorf("Expected the script content, got '%s' (%v)", got, err)
+	}
+	if got, err := registry.Call(ctx, "run_scripts_hello_sh", `{"args": ["bob"]}`); err != nil || got != "hello bob\n" {
+		t.Errorf("Expected 'hello bob', got '%s' (%v)", got, err)
+	}
+	if _, err := registry.Call(ctx, "run_shell_code", `{"code": "echo no"}`); err == nil {
+		t.Errorf("Expected run_shell_code not to be registered")
+	}
+
+	// without a workspace only the skill directory is readable
+	if _, err := registry.Call(context.Background(), "write_file", `{"filePath": "note.txt", "content": "hi"}`); !errors.Is(err, tools.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly without a workspace, got %v", err)
+	}
+	if got, err := registry.Call(context.Background(), "read_file", `{"filePath": "scripts/hello.sh"}`); err != nil || !strings.Contains(got, "hello") {
+		t.Errorf("Expected the script content without a workspace, got '%s' (%v)", got, err)
+	}
+}
+
+func TestToolRegistryScripts(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, map[string]string{
+		"SKILL.md":         "---\nname: greeter\ndescription: Greets people by name\nallowed-tools: [write_file, run_shell_script]\n---\nRun the hello script.\n",
+		"scripts/hello.sh": "echo \"hello $1\"; echo \"secret=$SKILL_SECRET\"\n",
+	})
+	pkg, err := ParseSkillPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SKILL_SECRET", "secret")
+	workspace := t.TempDir()
+	ctx := tools.WithWorkspace(context.Background(), &tools.Workspace{Root: workspace})
+
+	registry, err := NewToolRegistry(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"scripts/hello.sh", filepath.Join(dir, "scripts", "hello.sh")} {
+		input := fmt.Sprintf(`{"scriptPath": %q, "args": ["bob"]}`, path)
+		if got, err := registry.Call(ctx, "run_shell_script", input); err != nil || !strings.HasPrefix(got, "hello bob\n") {
+			t.Errorf("Expected %s to run, got '%s' (%v)", path, got, err)
+		}
+	}
+
+	// scripts written by the model or outside the skill scripts are refused
+	if _, err := registry.Call(ctx, "write_file", `{"filePath": "evil.sh", "content": "echo evil"}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"evil.sh", filepath.Join(workspace, "evil.sh"), "SKILL.md", "scripts/../SKILL.md", "../scripts/hello.sh"} {
+		input := fmt.Sprintf(`{"scriptPath": %q}`, path)
+		if _, err := registry.Call(ctx, "run_shell_script", input); !errors.Is(err, tools.ErrScriptNotAllowed) {
+			t.Errorf("Expected ErrScriptNotAllowed for %s, got %v", path, err)
+		}
+	}
+
+	// the scripts run in the default sandbox and do not see the server environment
+	for _, call := range [][2]string{
+		{"run_shell_script", `{"scriptPath": "scripts/hello.sh", "args": ["bob"]}`},
+		{"run_scripts_hello_sh", `{"args": ["bob"]}`},
+	} {
+		if got, err := registry.Call(ctx, call[0], call[1]); err != nil || got != "hello bob\nsecret=\n" {
+			t.Errorf("Expected %s to run in the sandbox, got '%s' (%v)", call[0], got, err)
+		}
+	}
+
+	// unless host execution is requested explicitly
+	host, err := NewToolRegistry(pkg, WithHostExecution())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := host.Call(ctx, "run_scripts_hello_sh", `{"args": ["bob"]}`); err != nil || got != "hello bob\nsecret=secret\n" {
+		t.Errorf("Expected the script to run on the host, got '%s' (%v)", got, err)
+	}
+}
+
+func TestNewToolRegistryScriptClash(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, map[string]string{
+		"SKILL.md":         "---\nname: greeter\ndescription: Greets people by name\nallowed-tools: [read_file]\n---\nRun the hello script.\n",
+		"scripts/hello.sh": "echo \"hello $1\"\n",
+		"scripts/hello_sh": "echo \"clash\"\n",
+	})
+	pkg, err := ParseSkillPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := NewToolRegistry(pkg)
+	if err != nil {
+		t.Fatalf("Expected the clashing script to be skipped, got %v", err)
+	}
+	want := []string{"read_file", "run_scripts_hello_sh", ResourceToolName}
+	if names := registry.Names(); !slices.Equal(names, want) {
+		t.Errorf("Expected tools %v, got %v", want, names)
+	}
+}
@@ -0,0 +1,342 @@
+package skills
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kinwyb/langchat/llm/tools"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is the severity of a diagnostic
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic codes
+const (
+	CodeParse       = "parse"
+	CodeFrontmatter = "frontmatter"
+	CodeName        = "name"
+	CodeDescription = "description"
+	CodeUnknownTool = "unknown-tool"
+	CodeDuplicate   = "duplicate-name"
+	CodeMissingFile = "missing-file"
+	CodeBody        = "body"
+	CodeScript      = "script"
+)
+
+// DefaultMaxBodySize is the size of a SKILL.md body above which a warning is reported, the body is sent to the model on each use
+const DefaultMaxBodySize = 32 * 1024
+
+// maxDescriptionLength and minDescriptionLength bound a meaningful description, the description is sent to the model for skill selection
+const (
+	maxDescriptionLength = 1024
+	minDescriptionLength = 20
+)
+
+// Diagnostic is a problem found in a skill package
+type Diagnostic struct {
+	// Path is the skill directory or the file the problem was found in
+	Path     string   `json:"path"`
+	Skill    string   `json:"skill,omitempty"`
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", d.Path, d.Severity, d.Message, d.Code)
+}
+
+// ValidateConfig configures the validation of skill packages
+type ValidateConfig struct {
+	// KnownTools are the tools allowed-tools may name in addition to the base tools, e.g. the tools of the agent registry
+	KnownTools []string
+	// MaxBodySize is the SKILL.md body size above which a warning is reported, DefaultMaxBodySize when zero
+	MaxBodySize int
+}
+
+// ValidateOption configures the validation of skill packages
+type ValidateOption func(*ValidateConfig)
+
+// WithKnownTools 配置 allowed-tools 可以引用的其他工具，如注册到 agent 的工具
+func WithKnownTools(names ...string) ValidateOption {
+	return func(c *ValidateConfig) {
+		c.KnownTools = append(c.KnownTools, names...)
+	}
+}
+
+// WithMaxBodySize 配置 SKILL.md 正文的大小上限
+func WithMaxBodySize(size int) ValidateOption {
+	return func(c *ValidateConfig) {
+		c.MaxBodySize = size
+	}
+}
+
+var (
+	skillNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	// markdownLinkPattern matches the targets of markdown links and images
+	markdownLinkPattern = regexp.MustCompile(`\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	// resourcePathPattern matches resource paths quoted as inline code
+	resourcePathPattern  = regexp.MustCompile("`((?:scripts|references|assets|templates)/[^`\\s]+)`")
+	knownFrontmatterKeys = []string{"name", "description", "allowed-tools", "model", "author", "version", "license", "metadata"}
+)
+
+// Validate checks a parsed skill package: its frontmatter, the tools it allows, the files its body
+// references, its scripts and the size of its body
+func Validate(pkg *Package, opts ...ValidateOption) []Diagnostic {
+	cfg := &ValidateConfig{MaxBodySize: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	v := &validator{pkg: pkg}
+	v.checkFrontmatter()
+	v.checkMeta()
+	v.checkTools(cfg.KnownTools)
+	v.checkBody(cfg.MaxBodySize)
+	v.checkReferences()
+	v.checkScripts()
+	return v.diagnostics
+}
+
+// ValidateDir parses and validates the skill packages under root, it also reports the packages
+// which fail to parse and the skill names used by more than one package
+func ValidateDir(root string, opts ...ValidateOption) ([]*Package, []Diagnostic) {
+	fingerprints, err := skillFingerprints(root)
+	if err != nil {
+		return nil, []Diagnostic{{Path: root, Severity: SeverityError, Code: CodeParse, Message: err.Error()}}
+	}
+	dirs := make([]string, 0, len(fingerprints))
+	for dir := range fingerprints {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+
+	var packages []*Package
+	var diagnostics []Diagnostic
+	names := make(map[string]string)
+	for _, dir := range dirs {
+		pkg, err := ParseSkillPackage(dir)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Path: dir, Severity: SeverityError, Code: CodeParse, Message: err.Error()})
+			continue
+		}
+		packages = append(packages, pkg)
+		diagnostics = append(diagnostics, Validate(pkg, opts...)...)
+		if pkg.Meta.Name == "" {
+			continue
+		}
+		if first, ok := names[pkg.Meta.Name]; ok {
+			diagnostics = append(diagnostics, Diagnostic{
+				Path:     dir,
+				Skill:    pkg.Meta.Name,
+				Severity: SeverityError,
+				Code:     CodeDuplicate,
+				Message:  fmt.Sprintf("skill name '%s' is already used by %s", pkg.Meta.Name, first),
+			})
+			continue
+		}
+		names[pkg.Meta.Name] = dir
+	}
+	return packages, diagnostics
+}
+
+// HasErrors reports whether diagnostics contain an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	return slices.ContainsFunc(diagnostics, func(d Diagnostic) bool { return d.Severity == SeverityError })
+}
+
+// validator collects the diagnostics of a package
+type validator struct {
+	pkg *Package
+	// frontmatter is set for SKILL.md packages, skill.md packages take their name from the directory
+	frontmatter bool
+	diagnostics []Diagnostic
+}
+
+func (v *validator) report(path string, severity Severity, code, format string, args ...any) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Path:     path,
+		Skill:    v.pkg.Meta.Name,
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkFrontmatter reports the unknown keys of the SKILL.md frontmatter, skill.md files have no frontmatter
+func (v *validator) checkFrontmatter() {
+	path := filepath.Join(v.pkg.Path, "SKILL.md")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	parts := bytes.SplitN(data, []byte("---"), 3)
+	if len(parts) < 3 {
+		return
+	}
+	v.frontmatter = true
+	var fields map[string]any
+	if err := yaml.Unmarshal(parts[1], &fields); err != nil {
+		v.report(path, SeverityError, CodeFrontmatter, "invalid frontmatter: %v", err)
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if !slices.Contains(knownFrontmatterKeys, key) {
+			v.report(path, SeverityWarning, CodeFrontmatter, "unknown frontmatter key '%s'", key)
+		}
+	}
+}
+
+// checkMeta checks the name and the description
+func (v *validator) checkMeta() {
+	meta := v.pkg.Meta
+	switch {
+	case meta.Name == "":
+		v.report(v.pkg.Path, SeverityError, CodeName, "name is missing")
+	case v.frontmatter && (!skillNamePattern.MatchString(meta.Name) || len(meta.Name) > 64):
+		v.report(v.pkg.Path, SeverityWarning, CodeName, "name '%s' should be lowercase letters, digits and hyphens, at most 64 characters", meta.Name)
+	}
+
+	description := strings.TrimSpace(meta.Description)
+	switch {
+	case description == "":
+		v.report(v.pkg.Path, SeverityError, CodeDescription, "description is missing, it is used to select the skill")
+	case strings.EqualFold(description, meta.Name) || len([]rune(description)) < minDescriptionLength:
+		v.report(v.pkg.Path, SeverityWarning, CodeDescription, "description '%s' is too short to select the skill, say what it does and when to use it", description)
+	case len([]rune(description)) > maxDescriptionLength:
+		v.report(v.pkg.Path, SeverityWarning, CodeDescription, "description has %d characters, more than %d", len([]rune(description)), maxDescriptionLength)
+	}
+}
+
+// checkTools reports the allowed tools which are neither base tools, script tools nor known tools
+func (v *validator) checkTools(knownTools []string) {
+	known := append(slices.Clone(knownTools), ResourceToolName)
+	for _, t := range tools.GetBaseTools() {
+		known = append(known, t.Function.Name)
+	}
+	for _, script := range v.pkg.Resources.Scripts {
+		_, name := generateScriptTool(v.pkg.Path, script)
+		known = append(known, name)
+	}
+	seen := make(map[string]bool)
+	for _, name := range v.pkg.Meta.AllowedTools {
+		if seen[name] {
+			v.report(v.pkg.Path, SeverityWarning, CodeUnknownTool, "tool '%s' is allowed twice", name)
+			continue
+		}
+		seen[name] = true
+		if !slices.Contains(known, name) {
+			v.report(v.pkg.Path, SeverityError, CodeUnknownTool, "allowed tool '%s' does not exist", name)
+		}
+	}
+}
+
+// checkBody reports empty and oversize bodies
+func (v *validator) checkBody(maxSize int) {
+	switch size := len(v.pkg.Body); {
+	case strings.TrimSpace(v.pkg.Body) == "":
+		v.report(v.pkg.Path, SeverityWarning, CodeBody, "body is empty, it holds the instructions of the skill")
+	case size > maxSize:
+		v.report(v.pkg.Path, SeverityWarning, CodeBody, "body has %d bytes, more than %d, move details to references", size, maxSize)
+	}
+}
+
+// checkReferences reports the relative links and resource paths of the body which do not exist in the package
+func (v *validator) checkReferences() {
+	var targets []string
+	for _, m := range markdownLinkPattern.FindAllStringSubmatch(v.pkg.Body, -1) {
+		targets = append(targets, m[1])
+	}
+	for _, m := range resourcePathPattern.FindAllStringSubmatch(v.pkg.Body, -1) {
+		targets = append(targets, m[1])
+	}
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		if strings.Contains(target, "://") || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "mailto:") {
+			continue
+		}
+		target, _, _ = strings.Cut(target, "#")
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		path := filepath.Join(v.pkg.Path, filepath.FromSlash(target))
+		if rel, err := filepath.Rel(v.pkg.Path, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			v.report(v.pkg.Path, SeverityWarning, CodeMissingFile, "referenced file '%s' is outside the skill package", target)
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			v.report(v.pkg.Path, SeverityError, CodeMissingFile, "referenced file '%s' does not exist", target)
+		}
+	}
+}
+
+// checkScripts reports the scripts which cannot be run: scripts are run with python when they end
+// in .py and with bash otherwise
+func (v *validator) checkScripts() {
+	for _, script := range v.pkg.Resources.Scripts {
+		path := filepath.Join(v.pkg.Path, script)
+		f, err := os.Open(path)
+		if err != nil {
+			v.report(path, SeverityError, CodeScript, "script cannot be read: %v", err)
+			continue
+		}
+		line, _ := bufio.NewReader(f).ReadString('\n')
+		f.Close()
+		if strings.TrimSpace(line) == "" {
+			v.report(path, SeverityWarning, CodeScript, "script is empty")
+			continue
+		}
+		if strings.HasSuffix(script, ".py") {
+			continue
+		}
+		interpreter := shebangInterpreter(line)
+		switch {
+		case interpreter != "" && interpreter != "sh" && interpreter != "bash":
+			v.report(path, SeverityError, CodeScript, "script is run with bash but its interpreter is '%s'", interpreter)
+		case interpreter == "" && !slices.Contains([]string{"", ".sh", ".bash"}, filepath.Ext(script)):
+			v.report(path, SeverityWarning, CodeScript, "script is run with bash, it should be a .sh or .py file")
+		}
+	}
+}
+
+// shebangInterpreter returns the interpreter named by a shebang line, e.g. python3 for "#!/usr/bin/env python3"
+func shebangInterpreter(line string) string {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "#!")
+	if !ok {
+		return ""
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				return filepath.Base(f)
+			}
+		}
+		return ""
+	}
+	return interpreter
+}
@@ -0,0 +1,140 @@
+package skills
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePackage creates a skill package from a map of relative file paths to contents
+func writePackage(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const valid = "---\nname: greeter\ndescription: Greets people by name when they say hello\nallowed-tools: [read_file]\n---\nSay hello, see [the guide](references/guide.md).\n"
+	tests := []struct {
+		name  string
+		files map[string]string
+		opts  []ValidateOption
+		want  []string // codes of the expected diagnostics
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"SKILL.md": valid, "references/guide.md": "guide"},
+		},
+		{
+			name:  "missing reference",
+			files: map[string]string{"SKILL.md": valid},
+			want:  []string{CodeMissingFile},
+		},
+		{
+			name: "frontmatter and description",
+			files: map[string]string{
+				"SKILL.md": "---\nname: Greeter Skill\ndescription: greets\ncolor: blue\n---\nSay hello.\n",
+			},
+			want: []string{CodeFrontmatter, CodeName, CodeDescription},
+		},
+		{
+			name: "unknown tool",
+			files: map[string]string{
+				"SKILL.md":         "---\nname: greeter\ndescription: Greets people by name when they say hello\nallowed-tools: [read_file, send_mail, run_scripts_hello_sh]\n---\nSay hello.\n",
+				"scripts/hello.sh": "echo hello\n",
+			},
+			want: []string{CodeUnknownTool},
+		},
+		{
+			name: "known registry tool",
+			files: map[string]string{
+				"SKILL.md": "---\nname: greeter\ndescription: Greets people by name when they say hello\nallowed-tools: [send_mail]\n---\nSay hello.\n",
+			},
+			opts: []ValidateOption{WithKnownTools("send_mail")},
+		},
+		{
+			name: "oversize body",
+			files: map[string]string{
+				"SKILL.md": "---\nname: greeter\ndescription: Greets people by name when they say hello\n---\n" + strings.Repeat("hello ", 100) + "\n",
+			},
+			opts: []ValidateOption{WithMaxBodySize(100)},
+			want: []string{CodeBody},
+		},
+		{
+			name: "scripts",
+			files: map[string]string{
+				"SKILL.md":         "---\nname: greeter\ndescription: Greets people by name when they say hello\n---\nRun `scripts/hello.js`.\n",
+				"scripts/hello.js": "#!/usr/bin/env node\nconsole.log('hello')\n",
+				"scripts/hello.py": "#!/usr/bin/env python3\nprint('hello')\n",
+				"scripts/hello.sh": "#!/bin/bash\necho hello\n",
+				"scripts/empty.sh": "",
+			},
+			want: []string{CodeScript, CodeScript},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePackage(t, dir, tt.files)
+			pkg, err := ParseSkillPackage(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			diagnostics := Validate(pkg, tt.opts...)
+			var codes []string
+			for _, d := range diagnostics {
+				codes = append(codes, d.Code)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected diagnostics %v, got %v", tt.want, diagnostics)
+			}
+		})
+	}
+}
+
+func TestValidateDir(t *testing.T) {
+	dir := t.TempDir()
+	writePackage(t, dir, map[string]string{
+		"one/SKILL.md":    "---\nname: greeter\ndescription: Greets people by name when they say hello\n---\nSay hello.\n",
+		"two/SKILL.md":    "---\nname: greeter\ndescription: Greets people by name when they say hello\n---\nSay hi.\n",
+		"broken/SKILL.md": "no frontmatter",
+	})
+
+	packages, diagnostics := ValidateDir(dir)
+	if len(packages) != 2 {
+		t.Errorf("Expected 2 parsed packages, got %d", len(packages))
+	}
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %v", diagnostics)
+	}
+	if d := diagnostics[0]; d.Code != CodeParse || d.Path != filepath.Join(dir, "broken") {
+		t.Errorf("Expected a parse error for 'broken', got %v", d)
+	}
+	if d := diagnostics[1]; d.Code != CodeDuplicate || d.Path != filepath.Join(dir, "two") {
+		t.Errorf("Expected a duplicate name for 'two', got %v", d)
+	}
+	if !HasErrors(diagnostics) {
+		t.Error("Expected errors")
+	}
+}
+
+func TestParseSkillPackageInvalidName(t *testing.T) {
+	for _, name := range []string{"../escape", "a/b", `a\b`, ".."} {
+		dir := t.TempDir()
+		writePackage(t, dir, map[string]string{
+			"SKILL.md": fmt.Sprintf("---\nname: '%s'\ndescription: Greets people by name\n---\nSay hello.\n", name),
+		})
+		if _, err := ParseSkillPackage(dir); err == nil {
+			t.Errorf("Expected skill name '%s' to be rejected", name)
+		}
+	}
+}
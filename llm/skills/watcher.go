@@ -0,0 +1,270 @@
+package skills
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadError is a skill package which failed to load
+type LoadError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Status is the state of the skills directory after the last scan
+type Status struct {
+	Dir    string      `json:"dir"`
+	Skills []string    `json:"skills"`
+	Errors []LoadError `json:"errors,omitempty"`
+	// LoadedAt is the time of the last scan, ChangedAt the time the skills last changed
+	LoadedAt  time.Time `json:"loadedAt"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// watchedSkill is a skill package of the watched directory
+type watchedSkill struct {
+	fingerprint string
+	skill       *Skill
+	err         error
+}
+
+// Watcher polls a skills directory and reloads the skill packages which were added, changed or removed.
+// A package which fails to parse keeps its last loaded version until it is fixed, the error is reported in Status.
+type Watcher struct {
+	dir      string
+	interval time.Duration
+	opts     []ToolOption
+	onChange func([]*Skill)
+
+	// reloadMu serializes the scans so onChange receives the skills in scan order,
+	// it is held while onChange runs unlike mu
+	reloadMu sync.Mutex
+	mu       sync.Mutex
+	packages map[string]*watchedSkill
+	status   Status
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewWatcher creates a watcher of dir, onChange receives the skills after each scan which changed them.
+// A non-positive interval disables polling, the directory is then scanned by Reload only.
+func NewWatcher(dir string, interval time.Duration, onChange func([]*Skill), opts ...ToolOption) *Watcher {
+	return &Watcher{
+		dir:      dir,
+		interval: interval,
+		opts:     opts,
+		onChange: onChange,
+		packages: make(map[string]*watchedSkill),
+		status:   Status{Dir: dir},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start scans the directory and polls it in the background until Close
+func (w *Watcher) Start() {
+	w.Reload()
+	if w.interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Reload()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the polling
+func (w *Watcher) Close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// Status returns the state of the directory after the last scan
+func (w *Watcher) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.snapshot()
+}
+
+// snapshot returns a copy of the status, the caller holds w.mu
+func (w *Watcher) snapshot() Status {
+	status := w.status
+	status.Skills = slices.Clone(status.Skills)
+	status.Errors = slices.Clone(status.Errors)
+	return status
+}
+
+// Reload scans the directory, re-parses the changed packages and returns the new state.
+// onChange is called when the skills changed, Status does not wait for it.
+func (w *Watcher) Reload() Status {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	loaded, status, changed := w.scan()
+	if changed && w.onChange != nil {
+		w.onChange(loaded)
+	}
+	return status
+}
+
+// scan updates the packages and the status under w.mu, it returns the loaded skills,
+// a snapshot of the status and whether the skills changed
+func (w *Watcher) scan() ([]*Skill, Status, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	w.status.LoadedAt = now
+	fingerprints, err := skillFingerprints(w.dir)
+	if err != nil {
+		w.status.Errors = []LoadError{{Path: w.dir, Error: err.Error()}}
+		log.Printf("Skills reload failed: %v", err)
+		return nil, w.snapshot(), false
+	}
+
+	changed := false
+	for path := range w.packages {
+		if _, ok := fingerprints[path]; !ok {
+			delete(w.packages, path)
+			changed = true
+			log.Printf("Skill package removed: %s", path)
+		}
+	}
+	for path, fingerprint := range fingerprints {
+		current, ok := w.packages[path]
+		if ok && current.fingerprint == fingerprint {
+			continue
+		}
+		skill, err := loadSkill(path, w.opts...)
+		if err != nil {
+			log.Printf("Failed to load skill package %s: %v", path, err)
+			if !ok {
+				current = &watchedSkill{}
+				w.packages[path] = current
+			}
+			// keep the last loaded version
+			current.fingerprint, current.err = fingerprint, err
+			continue
+		}
+		w.packages[path] = &watchedSkill{fingerprint: fingerprint, skill: skill}
+		changed = true
+		if ok {
+			log.Printf("Skill '%s' reloaded from %s", skill.Name, path)
+		}
+	}
+
+	// a name used by several packages is kept by the first directory, as ValidateDir reports it
+	paths := make([]string, 0, len(w.packages))
+	for path := range w.packages {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	var loaded []*Skill
+	names := make(map[string]string)
+	w.status.Skills = nil
+	w.status.Errors = nil
+	for _, path := range paths {
+		p := w.packages[path]
+		if p.err != nil {
+			w.status.Errors = append(w.status.Errors, LoadError{Path: path, Error: p.err.Error()})
+		}
+		if p.skill == nil {
+			continue
+		}
+		if first, ok := names[p.skill.Name]; ok {
+			w.status.Errors = append(w.status.Errors, LoadError{Path: path, Error: fmt.Sprintf("skill name '%s' is already used by %s", p.skill.Name, first)})
+			continue
+		}
+		names[p.skill.Name] = path
+		loaded = append(loaded, p.skill)
+	}
+	slices.SortFunc(loaded, func(a, b *Skill) int { return strings.Compare(a.Name, b.Name) })
+	for _, s := range loaded {
+		w.status.Skills = append(w.status.Skills, s.Name)
+	}
+	slices.SortStableFunc(w.status.Errors, func(a, b LoadError) int { return strings.Compare(a.Path, b.Path) })
+
+	if changed || w.status.ChangedAt.IsZero() {
+		w.status.ChangedAt = now
+		changed = true
+	}
+	return loaded, w.snapshot(), changed
+}
+
+// loadSkill parses the skill package in dir and creates its tools
+func loadSkill(dir string, opts ...ToolOption) (*Skill, error) {
+	pkg, err := ParseSkillPackage(dir)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Meta.Name == "" {
+		return nil, fmt.Errorf("skill in %s has no name", dir)
+	}
+	sk := &Skill{
+		Name:        pkg.Meta.Name,
+		Description: pkg.Meta.Description,
+		Package:     pkg,
+	}
+	if sk.Tools, err = Tools(pkg, opts...); err != nil {
+		return nil, fmt.Errorf("failed to load skill '%s' tools: %w", sk.Name, err)
+	}
+	return sk, nil
+}
+
+// skillFingerprints returns the skill package directories under root with a fingerprint of their files
+func skillFingerprints(root string) (map[string]string, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("skills directory not found at %s", root)
+	}
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && (d.Name() == "SKILL.md" || d.Name() == "skill.md") {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory %s: %w", root, err)
+	}
+
+	fingerprints := make(map[string]string, len(dirs))
+	for _, dir := range dirs {
+		h := sha256.New()
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking directory %s: %w", dir, err)
+		}
+		fingerprints[dir] = hex.EncodeToString(h.Sum(nil))
+	}
+	return fingerprints, nil
+}
@@ -0,0 +1,131 @@
+package skills
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeSkillFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name, "SKILL.md")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	writeSkillFile(t, dir, "greeter", "---\nname: greeter\ndescription: Greets\n---\nSay hello.")
+
+	var mu sync.Mutex
+	var changes [][]*Skill
+	w := NewWatcher(dir, 0, func(loaded []*Skill) {
+		mu.Lock()
+		changes = append(changes, loaded)
+		mu.Unlock()
+	})
+	defer w.Close()
+
+	status := w.Reload()
+	if !slices.Equal(status.Skills, []string{"greeter"}) || len(status.Errors) != 0 {
+		t.Fatalf("Expected skill 'greeter' without errors, got %+v", status)
+	}
+
+	// unchanged directory
+	w.Reload()
+	if len(changes) != 1 {
+		t.Errorf("Expected 1 change, got %d", len(changes))
+	}
+
+	// added and edited skills
+	writeSkillFile(t, dir, "counter", "---\nname: counter\ndescription: Counts\n---\nCount.")
+	writeSkillFile(t, dir, "greeter", "---\nname: greeter\ndescription: Greets warmly\n---\nSay hello.")
+	status = w.Reload()
+	if !slices.Equal(status.Skills, []string{"counter", "greeter"}) {
+		t.Fatalf("Expected skills 'counter' and 'greeter', got %v", status.Skills)
+	}
+	last := changes[len(changes)-1]
+	if last[1].Description != "Greets warmly" {
+		t.Errorf("Expected the edited description, got '%s'", last[1].Description)
+	}
+
+	// a broken edit keeps the last loaded version and reports the error
+	writeSkillFile(t, dir, "greeter", "no frontmatter here, the edit is broken")
+	status = w.Reload()
+	if !slices.Equal(status.Skills, []string{"counter", "greeter"}) {
+		t.Errorf("Expected the broken skill to keep its last version, got %v", status.Skills)
+	}
+	if len(status.Errors) != 1 || status.Errors[0].Path != filepath.Join(dir, "greeter") {
+		t.Errorf("Expected a load error for 'greeter', got %+v", status.Errors)
+	}
+
+	// removed skill
+	if err := os.RemoveAll(filepath.Join(dir, "counter")); err != nil {
+		t.Fatal(err)
+	}
+	status = w.Reload()
+	if !slices.Equal(status.Skills, []string{"greeter"}) {
+		t.Errorf("Expected skill 'counter' to be removed, got %v", status.Skills)
+	}
+	if got := w.Status(); !slices.Equal(got.Skills, status.Skills) || len(got.Errors) != 1 {
+		t.Errorf("Expected Status to return the last scan, got %+v", got)
+	}
+}
+
+func TestWatcherPolling(t *testing.T) {
+	dir := t.TempDir()
+	loaded := make(chan []*Skill, 10)
+	w := NewWatcher(dir, 10*time.Millisecond, func(skills []*Skill) { loaded <- skills })
+	w.Start()
+	defer w.Close()
+
+	if skills := <-loaded; len(skills) != 0 {
+		t.Fatalf("Expected no skills, got %d", len(skills))
+	}
+	writeSkillFile(t, dir, "greeter", "---\nname: greeter\ndescription: Greets\n---\nSay hello.")
+	select {
+	case skills := <-loaded:
+		if len(skills) != 1 || skills[0].Name != "greeter" {
+			t.Errorf("Expected skill 'greeter', got %v", skills)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the new skill to be loaded")
+	}
+}
+
+func TestWatcherMissingDir(t *testing.T) {
+	w := NewWatcher(filepath.Join(t.TempDir(), "missing"), 0, nil)
+	if status := w.Reload(); len(status.Errors) != 1 {
+		t.Errorf("Expected an error for the missing directory, got %+v", status)
+	}
+}
+
+func TestWatcherDuplicateName(t *testing.T) {
+	dir := t.TempDir()
+	writeSkillFile(t, dir, "a", "---\nname: greeter\ndescription: Greets\n---\nSay hello.")
+	writeSkillFile(t, dir, "b", "---\nname: greeter\ndescription: Greets again\n---\nSay hi.")
+
+	var w *Watcher
+	var loaded []*Skill
+	w = NewWatcher(dir, 0, func(skills []*Skill) {
+		loaded = skills
+		// onChange runs without the lock of the watcher
+		w.Status()
+	})
+	defer w.Close()
+
+	status := w.Reload()
+	if len(loaded) != 1 || loaded[0].Description != "Greets" {
+		t.Errorf("Expected the skill of the first directory, got %v", loaded)
+	}
+	if len(status.Errors) != 1 || status.Errors[0].Path != filepath.Join(dir, "b") {
+		t.Errorf("Expected a duplicate error for 'b', got %+v", status.Errors)
+	}
+}
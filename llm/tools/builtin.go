@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrScriptNotAllowed is returned when run_shell_script or run_python_script is called with a script it may not run
+var ErrScriptNotAllowed = errors.New("script is not allowed")
+
+// BuiltinConfig configures how the built-in tools are executed
+type BuiltinConfig struct {
+	// Sandbox runs the code and script tools, DefaultSandbox() when nil
+	Sandbox *Sandbox
+	// Host runs the code and script tools directly on the host with the server environment instead of a sandbox
+	Host bool
+	// Workspace returns the workspace of read_file and write_file for a call
+	Workspace func(ctx context.Context) *Workspace
+	// Script resolves the scriptPath of run_shell_script and run_python_script to the file to run,
+	// nil refuses every script
+	Script func(scriptPath string) (string, error)
+}
+
+// builtinHandlers executes the built-in tools by name
+var builtinHandlers = map[string]func(cfg BuiltinConfig, ctx context.Context, input string) (string, error){
+	"run_shell_code": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			Code string         `json:"code"`
+			Args map[string]any `json:"args"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal run_shell_code arguments: %w", err)
+		}
+		shellTool := ShellTool{Sandbox: cfg.sandbox()}
+		return shellTool.Run(ctx, params.Args, params.Code)
+	},
+	"run_shell_script": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			ScriptPath string   `json:"scriptPath"`
+			Args       []string `json:"args"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal run_shell_script arguments: %w", err)
+		}
+		scriptPath, err := cfg.script(params.ScriptPath)
+		if err != nil {
+			return "", err
+		}
+		if sandbox := cfg.sandbox(); sandbox != nil {
+			return sandbox.RunShellScript(ctx, scriptPath, params.Args)
+		}
+		return RunShellScript(ctx, scriptPath, params.Args)
+	},
+	"run_python_code": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			Code string         `json:"code"`
+			Args map[string]any `json:"args"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal run_python_code arguments: %w", err)
+		}
+		pythonTool := PythonTool{Sandbox: cfg.sandbox()}
+		return pythonTool.Run(ctx, params.Args, params.Code)
+	},
+	"run_python_script": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			ScriptPath string   `json:"scriptPath"`
+			Args       []string `json:"args"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal run_python_script arguments: %w", err)
+		}
+		scriptPath, err := cfg.script(params.ScriptPath)
+		if err != nil {
+			return "", err
+		}
+		if sandbox := cfg.sandbox(); sandbox != nil {
+			return sandbox.RunPythonScript(ctx, scriptPath, params.Args)
+		}
+		return RunPythonScript(ctx, scriptPath, params.Args)
+	},
+	"read_file": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			FilePath string `json:"filePath"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal read_file arguments: %w", err)
+		}
+		return cfg.workspace(ctx).ReadFile(params.FilePath)
+	},
+	"write_file": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			FilePath string `json:"filePath"`
+			Content  string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal write_file arguments: %w", err)
+		}
+		if err := cfg.workspace(ctx).WriteFile(params.FilePath, params.Content); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Successfully wrote to file: %s", params.FilePath), nil
+	},
+	"wikipedia_search": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal wikipedia_search arguments: %w", err)
+		}
+		return WikipediaSearch(ctx, params.Query)
+	},
+	"tavily_search": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal tavily_search arguments: %w", err)
+		}
+		return TavilySearch(ctx, params.Query)
+	},
+	"web_fetch": func(cfg BuiltinConfig, ctx context.Context, input string) (string, error) {
+		var params struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("failed to unmarshal web_fetch arguments: %w", err)
+		}
+		return WebFetch(ctx, params.URL)
+	},
+}
+
+// workspace returns the workspace of the file tools, without one every write is refused
+func (c BuiltinConfig) workspace(ctx context.Context) *Workspace {
+	if c.Workspace != nil {
+		if ws := c.Workspace(ctx); ws != nil {
+			return ws
+		}
+	}
+	if ws := WorkspaceFromContext(ctx); ws != nil {
+		return ws
+	}
+	return &Workspace{}
+}
+
+// sandbox returns the sandbox of the code and script tools, nil when they run on the host
+func (c BuiltinConfig) sandbox() *Sandbox {
+	if c.Host {
+		return nil
+	}
+	if c.Sandbox != nil {
+		return c.Sandbox
+	}
+	return DefaultSandbox()
+}
+
+// script resolves the script of run_shell_script and run_python_script
+func (c BuiltinConfig) script(scriptPath string) (string, error) {
+	if c.Script == nil {
+		return "", fmt.Errorf("%w: %s", ErrScriptNotAllowed, scriptPath)
+	}
+	return c.Script(scriptPath)
+}
+
+// builtinTool is a built-in tool defined by GetBaseTools
+type builtinTool struct {
+	def openai.Tool
+	cfg BuiltinConfig
+}
+
+// BuiltinTools returns the built-in tools of GetBaseTools, names limits them to the given names when not empty
+func BuiltinTools(cfg BuiltinConfig, names ...string) []ITool {
+	var ret []ITool
+	for _, def := range GetBaseTools() {
+		if len(names) > 0 && !slices.Contains(names, def.Function.Name) {
+			continue
+		}
+		ret = append(ret, &builtinTool{def: def, cfg: cfg})
+	}
+	return ret
+}
+
+// RegisterBuiltinTools registers the built-in tools in r, see BuiltinTools
+func RegisterBuiltinTools(r *Registry, cfg BuiltinConfig, names ...string) error {
+	return r.Register(BuiltinTools(cfg, names...)...)
+}
+
+func (t *builtinTool) Name() string {
+	return t.def.Function.Name
+}
+
+func (t *builtinTool) Description() string {
+	return t.def.Function.Description
+}
+
+func (t *builtinTool) Paramters() any {
+	return t.def.Function.Parameters
+}
+
+func (t *builtinTool) DescriptionWithParamters() string {
+	sb := strings.Builder{}
+	sb.WriteString(t.Description() + " ")
+	for k, v := range OpenaiToolConvertToolParamter(t.def) {
+		sb.WriteString(k + "(" + v.Type + ") " + v.Description + " ")
+	}
+	return sb.String()
+}
+
+func (t *builtinTool) Call(ctx context.Context, input string) (string, error) {
+	handler, ok := builtinHandlers[t.Name()]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrToolNotFound, t.Name())
+	}
+	return handler(t.cfg, ctx, input)
+}
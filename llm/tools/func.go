@@ -0,0 +1,274 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FuncTool is a Go-native tool whose JSON Schema is derived from its argument struct
+type FuncTool[Args any] struct {
+	name        string
+	description string
+	parameters  map[string]any
+	wrapped     bool // Args is not a struct and is passed as the "input" property
+	fn          func(ctx context.Context, args Args) (string, error)
+}
+
+// NewFunc creates a tool from a typed Go function. The JSON Schema of the parameters is
+// derived from the fields of Args using the struct tags:
+//
+//	json:"name"            property name, "-" skips the field
+//	description:"..."      property description
+//	required:"true"        the property is required
+//	enum:"a,b,c"           allowed values
+//
+// For example:
+//
+//	type WeatherArgs struct {
+//		City string `json:"city" description:"City name" required:"true"`
+//		Unit string `json:"unit" description:"Temperature unit" enum:"celsius,fahrenheit"`
+//	}
+//	weather := tools.NewFunc("get_weather", "Get the current weather", func(ctx context.Context, args WeatherArgs) (string, error) {
+//		...
+//	})
+func NewFunc[Args any](name string, description string, fn func(ctx context.Context, args Args) (string, error)) *FuncTool[Args] {
+	var zero Args
+	parameters := jsonSchema(reflect.TypeOf(zero), map[reflect.Type]bool{})
+	wrapped := parameters["type"] != "object"
+	if wrapped {
+		// Tool parameters must be an object, wrap other argument types
+		parameters = map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"input": parameters,
+			},
+			"required": []string{"input"},
+		}
+	}
+	return &FuncTool[Args]{
+		name:        name,
+		description: description,
+		parameters:  parameters,
+		wrapped:     wrapped,
+		fn:          fn,
+	}
+}
+
+func (t *FuncTool[Args]) Name() string {
+	return t.name
+}
+
+func (t *FuncTool[Args]) Description() string {
+	return t.description
+}
+
+func (t *FuncTool[Args]) Paramters() any {
+	return t.parameters
+}
+
+func (t *FuncTool[Args]) DescriptionWithParamters() string {
+	sb := strings.Builder{}
+	sb.WriteString(t.Description() + " ")
+	properties, _ := t.parameters["properties"].(map[string]any)
+	required, _ := t.parameters["required"].([]string)
+	names := make([]string, 0, len(properties))
+	for k := range properties {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		prop, _ := properties[k].(map[string]any)
+		typ, _ := prop["type"].(string)
+		desc, _ := prop["description"].(string)
+		sb.WriteString(k + "(" + typ + ")")
+		for _, r := range required {
+			if r == k {
+				sb.WriteString(" required")
+				break
+			}
+		}
+		if desc != "" {
+			sb.WriteString(" " + desc)
+		}
+		sb.WriteString(" ")
+	}
+	return sb.String()
+}
+
+// Call decodes the JSON arguments into Args, checks the required properties and calls the function
+func (t *FuncTool[Args]) Call(ctx context.Context, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if t.wrapped {
+		return t.callWrapped(ctx, input)
+	}
+	if input == "" {
+		input = "{}"
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(input), &raw); err != nil || raw == nil {
+		// Agents pass a bare string when the only parameter is "input"
+		properties, _ := t.parameters["properties"].(map[string]any)
+		if _, ok := properties["input"]; !ok || len(properties) != 1 {
+			if err == nil {
+				err = errors.New("arguments are not an object")
+			}
+			return "", fmt.Errorf("failed to unmarshal %s arguments: %w", t.name, err)
+		}
+		value, _ := json.Marshal(input)
+		input = `{"input":` + string(value) + `}`
+		raw = map[string]json.RawMessage{"input": value}
+	}
+	required, _ := t.parameters["required"].([]string)
+	for _, name := range required {
+		if _, ok := raw[name]; !ok {
+			return "", fmt.Errorf("missing required argument '%s' for %s", name, t.name)
+		}
+	}
+
+	var args Args
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("failed to unmarshal %s arguments: %w", t.name, err)
+	}
+	return t.fn(ctx, args)
+}
+
+// callWrapped calls a tool whose Args is not a struct. The input is the arguments object carrying
+// the value in "input" or, as agents pass it, the bare value, a bare string is taken as is.
+func (t *FuncTool[Args]) callWrapped(ctx context.Context, input string) (string, error) {
+	var data []byte
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(input), &raw); err == nil && len(raw) == 1 && raw["input"] != nil {
+		data = raw["input"]
+	} else if derefType(reflect.TypeFor[Args]()).Kind() == reflect.String {
+		data, _ = json.Marshal(input)
+	} else if input != "" {
+		data = []byte(input)
+	} else {
+		return "", fmt.Errorf("missing required argument 'input' for %s", t.name)
+	}
+
+	var args Args
+	if err := json.Unmarshal(data, &args); err != nil {
+		return "", fmt.Errorf("failed to unmarshal %s arguments: %w", t.name, err)
+	}
+	return t.fn(ctx, args)
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// jsonSchema derives the JSON Schema of a Go type.
+// visiting holds the struct types being derived, a self-referencing type accepts any value where it repeats.
+func jsonSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+	t = derefType(t)
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		properties := map[string]any{}
+		required := []string{}
+		structProperties(t, properties, &required, visiting)
+		schema := map[string]any{
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// interface{} and other types accept any value
+		return map[string]any{}
+	}
+}
+
+// structProperties adds the properties of the struct fields, embedded structs are flattened
+func structProperties(t reflect.Type, properties map[string]any, required *[]string, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && derefType(field.Type).Kind() == reflect.Struct {
+			embedded := derefType(field.Type)
+			if visiting[embedded] {
+				continue
+			}
+			visiting[embedded] = true
+			structProperties(embedded, properties, required, visiting)
+			delete(visiting, embedded)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := jsonSchema(field.Type, visiting)
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			prop["enum"] = enumValues(derefType(field.Type), enum)
+		}
+		properties[name] = prop
+		if req, _ := strconv.ParseBool(field.Tag.Get("required")); req {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// enumValues parses the comma separated enum tag according to the field type
+func enumValues(t reflect.Type, enum string) []any {
+	var values []any
+	for _, v := range strings.Split(enum, ",") {
+		v = strings.TrimSpace(v)
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				values = append(values, n)
+				continue
+			}
+		case reflect.Float32, reflect.Float64:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				values = append(values, f)
+				continue
+			}
+		}
+		values = append(values, v)
+	}
+	return values
+}
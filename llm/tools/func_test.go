@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type weatherArgs struct {
+	City   string   `json:"city" description:"City name" required:"true"`
+	Unit   string   `json:"unit,omitempty" description:"Temperature unit" enum:"celsius,fahrenheit"`
+	Days   int      `json:"days" enum:"1,3,7"`
+	Tags   []string `json:"tags"`
+	Ignore string   `json:"-"`
+	hidden string
+}
+
+func TestNewFuncSchema(t *testing.T) {
+	tool := NewFunc("get_weather", "Get the weather", func(ctx context.Context, args weatherArgs) (string, error) {
+		return args.City + " " + args.Unit, nil
+	})
+
+	var _ ITool = tool
+	want := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"city": map[string]any{"type": "string", "description": "City name"},
+			"unit": map[string]any{"type": "string", "description": "Temperature unit", "enum": []any{"celsius", "fahrenheit"}},
+			"days": map[string]any{"type": "integer", "enum": []any{int64(1), int64(3), int64(7)}},
+			"tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+		"required": []string{"city"},
+	}
+	if !reflect.DeepEqual(tool.Paramters(), want) {
+		t.Errorf("Unexpected schema:\n%#v", tool.Paramters())
+	}
+	if desc := tool.DescriptionWithParamters(); !strings.Contains(desc, "city(string) required City name") {
+		t.Errorf("Unexpected description: %s", desc)
+	}
+}
+
+type treeNode struct {
+	Name     string     `json:"name"`
+	Children []treeNode `json:"children"`
+	Parent   *treeNode  `json:"parent"`
+	Meta     *treeLeaf  `json:"meta"`
+	Other    *treeLeaf  `json:"other"`
+}
+
+type treeLeaf struct {
+	Label string `json:"label"`
+}
+
+func TestNewFuncRecursiveSchema(t *testing.T) {
+	tool := NewFunc("walk", "Walk a tree", func(ctx context.Context, args treeNode) (string, error) {
+		return args.Name + "/" + args.Children[0].Name, nil
+	})
+	properties := tool.Paramters().(map[string]any)["properties"].(map[string]any)
+	if want := (map[string]any{"type": "array", "items": map[string]any{}}); !reflect.DeepEqual(properties["children"], want) {
+		t.Errorf("Expected the repeated type to accept any value, got %#v", properties["children"])
+	}
+	if !reflect.DeepEqual(properties["parent"], map[string]any{}) {
+		t.Errorf("Expected the repeated pointer type to accept any value, got %#v", properties["parent"])
+	}
+	// types repeated without a cycle are derived each time
+	leaf := map[string]any{"type": "object", "properties": map[string]any{"label": map[string]any{"type": "string"}}}
+	if !reflect.DeepEqual(properties["meta"], leaf) || !reflect.DeepEqual(properties["other"], leaf) {
+		t.Errorf("Expected both leaves to be derived, got %#v and %#v", properties["meta"], properties["other"])
+	}
+
+	res, err := tool.Call(context.Background(), `{"name": "root", "children": [{"name": "child"}]}`)
+	if err != nil || res != "root/child" {
+		t.Errorf("Expected 'root/child', got '%s' (%v)", res, err)
+	}
+}
+
+func TestNewFuncCall(t *testing.T) {
+	tool := NewFunc("get_weather", "Get the weather", func(ctx context.Context, args weatherArgs) (string, error) {
+		return args.City + " " + args.Unit, nil
+	})
+
+	res, err := tool.Call(context.Background(), `{"city":"Shanghai","unit":"celsius"}`)
+	if err != nil || res != "Shanghai celsius" {
+		t.Errorf("Expected 'Shanghai celsius', got '%s' (%v)", res, err)
+	}
+	if _, err := tool.Call(context.Background(), `{"unit":"celsius"}`); err == nil {
+		t.Errorf("Expected missing required argument error")
+	}
+
+	// Non struct arguments are passed as the "input" property
+	echo := NewFunc("echo", "Echo the input", func(ctx context.Context, input string) (string, error) {
+		return input, nil
+	})
+	if res, err := echo.Call(context.Background(), `{"input":"hi"}`); err != nil || res != "hi" {
+		t.Errorf("Expected 'hi', got '%s' (%v)", res, err)
+	}
+	if res, err := echo.Call(context.Background(), "plain text"); err != nil || res != "plain text" {
+		t.Errorf("Expected 'plain text', got '%s' (%v)", res, err)
+	}
+	// a bare string looking like JSON is still the input
+	for _, input := range []string{`{"city": "Paris"}`, `[1, 2]`, `{"input": "hi", "other": 1}`} {
+		if res, err := echo.Call(context.Background(), input); err != nil || res != input {
+			t.Errorf("Expected '%s', got '%s' (%v)", input, res, err)
+		}
+	}
+
+	sum := NewFunc("sum", "Sum numbers", func(ctx context.Context, numbers []int) (string, error) {
+		total := 0
+		for _, n := range numbers {
+			total += n
+		}
+		return fmt.Sprint(total), nil
+	})
+	for _, input := range []string{`{"input": [1, 2, 3]}`, `[1, 2, 3]`} {
+		if res, err := sum.Call(context.Background(), input); err != nil || res != "6" {
+			t.Errorf("Expected '6' for %s, got '%s' (%v)", input, res, err)
+		}
+	}
+	if _, err := sum.Call(context.Background(), ""); err == nil {
+		t.Errorf("Expected missing required argument error")
+	}
+
+	// a struct with a single "input" property accepts the bare string
+	type inputArgs struct {
+		Input string `json:"input" required:"true"`
+	}
+	single := NewFunc("single", "Single input", func(ctx context.Context, args inputArgs) (string, error) {
+		return args.Input, nil
+	})
+	if res, err := single.Call(context.Background(), "plain text"); err != nil || res != "plain text" {
+		t.Errorf("Expected 'plain text', got '%s' (%v)", res, err)
+	}
+	if _, err := tool.Call(context.Background(), "plain text"); err == nil {
+		t.Errorf("Expected an error for a bare string to a struct tool")
+	}
+}
@@ -13,7 +13,7 @@ import (
 
 // WikipediaSearch performs a search on Wikipedia for the given query and returns a summary.
 // It uses the Wikipedia API.
-func WikipediaSearch(query string) (string, error) {
+func WikipediaSearch(ctx context.Context, query string) (string, error) {
 	baseURL := "https://en.wikipedia.org/w/api.php"
 	params := url.Values{}
 	params.Add("action", "query")
@@ -30,7 +30,7 @@ func WikipediaSearch(query string) (string, error) {
 		Timeout: 10 * time.Second,
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", searchURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups are not supported,
+// only the command itself is killed when its context is done
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -2,16 +2,20 @@ package tools
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"text/template"
+	"time"
 )
 
+// PythonTool runs Python code snippets, in Sandbox when it is set
 type PythonTool struct {
+	Sandbox *Sandbox
 }
 
-func (t *PythonTool) Run(args map[string]any, code string) (string, error) {
+func (t *PythonTool) Run(ctx context.Context, args map[string]any, code string) (string, error) {
 	tmpl, err := template.New("python").Parse(code)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse python template: %w", err)
@@ -23,6 +27,14 @@ func (t *PythonTool) Run(args map[string]any, code string) (string, error) {
 		return "", fmt.Errorf("failed to execute python template: %w", err)
 	}
 
+	if t.Sandbox != nil {
+		pythonExe, err := pythonExecutable()
+		if err != nil {
+			return "", err
+		}
+		return t.Sandbox.RunScript(ctx, pythonExe, "script.py", script.Bytes())
+	}
+
 	tmpfile, err := os.CreateTemp("", "python-*.py")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %w", err)
@@ -36,21 +48,21 @@ func (t *PythonTool) Run(args map[string]any, code string) (string, error) {
 		return "", fmt.Errorf("failed to close temp file: %w", err)
 	}
 
-	return RunPythonScript(tmpfile.Name(), nil)
+	return RunPythonScript(ctx, tmpfile.Name(), nil)
 }
 
 // RunPythonScript executes a Python script and returns its combined stdout and stderr.
 // It tries to use 'python3' first, then falls back to 'python'.
-func RunPythonScript(scriptPath string, args []string) (string, error) {
-	pythonExe, err := exec.LookPath("python3")
+// The script and its child processes are killed when ctx is done.
+func RunPythonScript(ctx context.Context, scriptPath string, args []string) (string, error) {
+	pythonExe, err := pythonExecutable()
 	if err != nil {
-		pythonExe, err = exec.LookPath("python")
-		if err != nil {
-			return "", fmt.Errorf("failed to find python3 or python in PATH: %w", err)
-		}
+		return "", err
 	}
 
-	cmd := exec.Command(pythonExe, append([]string{scriptPath}, args...)...)
+	cmd := exec.CommandContext(ctx, pythonExe, append([]string{scriptPath}, args...)...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = time.Second
 	cmd.Env = os.Environ()
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -63,3 +75,15 @@ func RunPythonScript(scriptPath string, args []string) (string, error) {
 
 	return stdout.String() + stderr.String(), nil
 }
+
+// pythonExecutable finds 'python3', falling back to 'python'
+func pythonExecutable() (string, error) {
+	pythonExe, err := exec.LookPath("python3")
+	if err != nil {
+		pythonExe, err = exec.LookPath("python")
+		if err != nil {
+			return "", fmt.Errorf("failed to find python3 or python in PATH: %w", err)
+		}
+	}
+	return pythonExe, nil
+}
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+var (
+	// ErrToolExists is returned when a tool with the same name is already registered
+	ErrToolExists = errors.New("tool already registered")
+	// ErrToolNotFound is returned when calling a tool that is not registered
+	ErrToolNotFound = errors.New("tool not found")
+)
+
+// Registry holds tools by name. Built-in tools, skill tools, MCP tools and
+// Go-native tools can all be registered as long as they implement ITool.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]ITool
+	order []string
+}
+
+// NewRegistry creates a registry with the given tools, see Register
+func NewRegistry(tools ...ITool) (*Registry, error) {
+	r := &Registry{
+		tools: make(map[string]ITool),
+	}
+	if err := r.Register(tools...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds tools to the registry.
+// It fails with ErrToolExists on a name collision, the tools before the collision stay registered.
+func (r *Registry) Register(tools ...ITool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range tools {
+		name := t.Name()
+		if name == "" {
+			return errors.New("tool name is empty")
+		}
+		if _, ok := r.tools[name]; ok {
+			return fmt.Errorf("%w: %s", ErrToolExists, name)
+		}
+		r.tools[name] = t
+		r.order = append(r.order, name)
+	}
+	return nil
+}
+
+// Unregister removes a tool by name
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[name]; !ok {
+		return
+	}
+	delete(r.tools, name)
+	for i, n := range r.order {
+		if n == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Get returns the tool registered with name
+func (r *Registry) Get(name string) (ITool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Len returns the number of registered tools
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.order)
+}
+
+// Names returns the tool names in registration order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.order...)
+}
+
+// Tools returns the tools in registration order
+func (r *Registry) Tools() []ITool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := make([]ITool, 0, len(r.order))
+	for _, name := range r.order {
+		ret = append(ret, r.tools[name])
+	}
+	return ret
+}
+
+// Definitions returns the function definitions (JSON Schema parameters) of the tools for the model
+func (r *Registry) Definitions() []llms.Tool {
+	var defs []llms.Tool
+	for _, t := range r.Tools() {
+		defs = append(defs, llms.Tool{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  t.Paramters(),
+			},
+		})
+	}
+	return defs
+}
+
+// Call invokes the tool registered with name
+func (r *Registry) Call(ctx context.Context, name string, input string) (string, error) {
+	t, ok := r.Get(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+	return t.Call(ctx, input)
+}
@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testTool is a minimal ITool returning a fixed result
+type testTool struct {
+	name   string
+	result string
+}
+
+func (t *testTool) Name() string                     { return t.name }
+func (t *testTool) Description() string              { return t.name + " description" }
+func (t *testTool) Paramters() any                   { return map[string]any{"type": "object"} }
+func (t *testTool) DescriptionWithParamters() string { return t.Description() }
+func (t *testTool) Call(context.Context, string) (string, error) {
+	return t.result, nil
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(&testTool{name: "a", result: "A"}, &testTool{name: "b", result: "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Register(&testTool{name: "a"}); !errors.Is(err, ErrToolExists) {
+		t.Errorf("Expected ErrToolExists, got %v", err)
+	}
+	if !reflect.DeepEqual(r.Names(), []string{"a", "b"}) {
+		t.Errorf("Unexpected names: %v", r.Names())
+	}
+
+	defs := r.Definitions()
+	if len(defs) != 2 || defs[1].Function.Name != "b" || defs[1].Function.Description != "b description" {
+		t.Errorf("Unexpected definitions: %+v", defs)
+	}
+
+	res, err := r.Call(context.Background(), "b", "{}")
+	if err != nil || res != "B" {
+		t.Errorf("Expected 'B', got '%s' (%v)", res, err)
+	}
+	if _, err := r.Call(context.Background(), "c", "{}"); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("Expected ErrToolNotFound, got %v", err)
+	}
+
+	r.Unregister("a")
+	if _, ok := r.Get("a"); ok || r.Len() != 1 {
+		t.Errorf("Expected tool 'a' to be removed, names: %v", r.Names())
+	}
+}
+
+func TestRegisterBuiltinTools(t *testing.T) {
+	r, _ := NewRegistry()
+	ws := &Workspace{Root: t.TempDir()}
+	cfg := BuiltinConfig{Workspace: func(context.Context) *Workspace { return ws }}
+	if err := RegisterBuiltinTools(r, cfg, "read_file", "write_file"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Names(), []string{"read_file", "write_file"}) {
+		t.Errorf("Unexpected names: %v", r.Names())
+	}
+	if err := RegisterBuiltinTools(r, cfg, "read_file"); !errors.Is(err, ErrToolExists) {
+		t.Errorf("Expected ErrToolExists, got %v", err)
+	}
+
+	if _, err := r.Call(context.Background(), "write_file", `{"filePath": "a.txt", "content": "A"}`); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := r.Call(context.Background(), "read_file", `{"filePath": "a.txt"}`); err != nil || res != "A" {
+		t.Errorf("Expected 'A', got '%s' (%v)", res, err)
+	}
+	if _, err := r.Call(context.Background(), "read_file", `{"filePath": "../outside.txt"}`); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("Expected ErrPathEscape, got %v", err)
+	}
+
+	all, _ := NewRegistry(BuiltinTools(BuiltinConfig{})...)
+	if all.Len() != len(GetBaseTools()) {
+		t.Errorf("Expected all %d built-in tools, got %v", len(GetBaseTools()), all.Names())
+	}
+	// without a script resolver no script may run
+	if _, err := all.Call(context.Background(), "run_shell_script", `{"scriptPath": "/bin/true"}`); !errors.Is(err, ErrScriptNotAllowed) {
+		t.Errorf("Expected ErrScriptNotAllowed, got %v", err)
+	}
+}
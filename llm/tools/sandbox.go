@@ -0,0 +1,248 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sandbox executes model generated code with restricted resources.
+// Each call runs in its own temporary working directory which is removed afterwards.
+type Sandbox struct {
+	// BaseDir is where the per-call working directories are created, os.TempDir() when empty
+	BaseDir string
+	// Env lists the environment variables passed through from the server process.
+	// HOME and TMPDIR always point to the working directory.
+	Env []string
+	// Timeout is the wall clock limit of a call
+	Timeout time.Duration
+	// CPUTime is the CPU time limit (RLIMIT_CPU)
+	CPUTime time.Duration
+	// MemoryBytes is the virtual memory limit (RLIMIT_AS)
+	MemoryBytes uint64
+	// FileSizeBytes is the maximum size of a file written by the code (RLIMIT_FSIZE)
+	FileSizeBytes uint64
+	// MaxOutputBytes caps the returned output, the rest is dropped
+	MaxOutputBytes int
+	// IsolateNetwork runs the code in a new network namespace without any interface (Linux only)
+	IsolateNetwork bool
+	// ReadOnlyRoot mounts the root filesystem read-only, only the working directory is writable.
+	// It requires bubblewrap (bwrap) in PATH.
+	ReadOnlyRoot bool
+}
+
+// DefaultSandbox returns a sandbox with conservative limits
+func DefaultSandbox() *Sandbox {
+	return &Sandbox{
+		Env:            []string{"PATH", "LANG", "LC_ALL", "TZ"},
+		Timeout:        60 * time.Second,
+		CPUTime:        30 * time.Second,
+		MemoryBytes:    1 << 30,
+		FileSizeBytes:  100 << 20,
+		MaxOutputBytes: 64 << 10,
+	}
+}
+
+// RunScript writes script into a new working directory as fileName and runs it with interpreter,
+// returning the combined stdout and stderr
+func (s *Sandbox) RunScript(ctx context.Context, interpreter string, fileName string, script []byte) (string, error) {
+	workDir, err := os.MkdirTemp(s.BaseDir, "sandbox-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	scriptPath := filepath.Join(workDir, fileName)
+	if err := os.WriteFile(scriptPath, script, 0600); err != nil {
+		return "", fmt.Errorf("failed to write script: %w", err)
+	}
+	return s.Run(ctx, workDir, interpreter, scriptPath)
+}
+
+// RunShellScript runs the existing script scriptPath with bash in a new working directory
+func (s *Sandbox) RunShellScript(ctx context.Context, scriptPath string, args []string) (string, error) {
+	return s.runFile(ctx, "bash", scriptPath, args)
+}
+
+// RunPythonScript runs the existing script scriptPath with python in a new working directory
+func (s *Sandbox) RunPythonScript(ctx context.Context, scriptPath string, args []string) (string, error) {
+	pythonExe, err := pythonExecutable()
+	if err != nil {
+		return "", err
+	}
+	return s.runFile(ctx, pythonExe, scriptPath, args)
+}
+
+// runFile runs scriptPath with interpreter, the directory of the script is mounted read-only
+func (s *Sandbox) runFile(ctx context.Context, interpreter string, scriptPath string, args []string) (string, error) {
+	scriptPath, err := filepath.Abs(scriptPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve script path: %w", err)
+	}
+	workDir, err := os.MkdirTemp(s.BaseDir, "sandbox-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	return s.run(ctx, workDir, []string{filepath.Dir(scriptPath)}, interpreter, append([]string{scriptPath}, args...)...)
+}
+
+// Run executes name with args in workDir inside the sandbox and returns the combined stdout and stderr
+func (s *Sandbox) Run(ctx context.Context, workDir string, name string, args ...string) (string, error) {
+	return s.run(ctx, workDir, nil, name, args...)
+}
+
+// run executes name with args in workDir, readOnly lists additional directories visible to a read-only root
+func (s *Sandbox) run(ctx context.Context, workDir string, readOnly []string, name string, args ...string) (string, error) {
+	parent := ctx
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	argv := append([]string{name}, args...)
+	argv = s.withLimits(argv)
+	if s.ReadOnlyRoot {
+		bwrap, err := exec.LookPath("bwrap")
+		if err != nil {
+			return "", errors.New("read-only root requires bubblewrap (bwrap) in PATH")
+		}
+		argv = append(s.bwrapArgs(bwrap, workDir, readOnly...), argv...)
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	setProcessGroup(cmd)
+	cmd.Dir = workDir
+	cmd.Env = s.environ(workDir)
+	cmd.WaitDelay = time.Second
+	if s.IsolateNetwork && !s.ReadOnlyRoot {
+		if err := isolateNetwork(cmd); err != nil {
+			return "", err
+		}
+	}
+
+	stdout := &limitedBuffer{limit: s.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: s.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if parent.Err() != nil {
+		// Canceled or timed out by the caller, not by the sandbox limit
+		return "", fmt.Errorf("failed to run '%s' in sandbox: %w", name, parent.Err())
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s: %w", s.Timeout, err)
+	}
+	output := truncateOutput(stdout.String()+stderr.String(), s.MaxOutputBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to run '%s' in sandbox: %w\nStdout: %s\nStderr: %s", name, err, stdout.String(), stderr.String())
+	}
+	return output, nil
+}
+
+// withLimits wraps argv with a shell setting the resource limits (ulimit) before exec
+func (s *Sandbox) withLimits(argv []string) []string {
+	var limits []string
+	if s.CPUTime > 0 {
+		limits = append(limits, "ulimit -t "+strconv.Itoa(max(1, int(s.CPUTime.Seconds()))))
+	}
+	if s.MemoryBytes > 0 {
+		limits = append(limits, "ulimit -v "+strconv.FormatUint(s.MemoryBytes/1024, 10))
+	}
+	if s.FileSizeBytes > 0 {
+		// ulimit -f counts 1024 byte blocks in bash and 512 byte blocks in POSIX sh, use bash
+		limits = append(limits, "ulimit -f "+strconv.FormatUint(max(1, s.FileSizeBytes/1024), 10))
+	}
+	if len(limits) == 0 {
+		return argv
+	}
+	script := strings.Join(limits, " && ") + ` && exec "$@"`
+	return append([]string{"bash", "-c", script, "sandbox"}, argv...)
+}
+
+// bwrapArgs builds the bubblewrap command line mounting the root read-only and the working directory writable.
+// The readOnly directories are mounted again as they may be hidden by the /tmp mount.
+func (s *Sandbox) bwrapArgs(bwrap string, workDir string, readOnly ...string) []string {
+	args := []string{
+		bwrap,
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	}
+	for _, dir := range readOnly {
+		args = append(args, "--ro-bind", dir, dir)
+	}
+	args = append(args,
+		"--bind", workDir, workDir,
+		"--chdir", workDir,
+		"--unshare-pid",
+		"--die-with-parent",
+	)
+	if s.IsolateNetwork {
+		args = append(args, "--unshare-net")
+	}
+	return append(args, "--")
+}
+
+// environ returns the allowlisted environment of the sandboxed process
+func (s *Sandbox) environ(workDir string) []string {
+	env := []string{"HOME=" + workDir, "TMPDIR=" + workDir}
+	for _, name := range s.Env {
+		if name == "HOME" || name == "TMPDIR" {
+			continue
+		}
+		if val, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+val)
+		}
+	}
+	return env
+}
+
+// limitedBuffer keeps at most limit bytes, a non-positive limit keeps everything
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 {
+		remaining := b.limit - b.buf.Len()
+		if remaining <= 0 {
+			b.truncated = true
+			return len(p), nil
+		}
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+			b.truncated = true
+			return len(p), nil
+		}
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
+
+// truncateOutput caps the combined output to limit bytes
+func truncateOutput(output string, limit int) string {
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+	return output[:limit] + "\n[output truncated]"
+}
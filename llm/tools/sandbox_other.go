@@ -0,0 +1,13 @@
+//go:build !linux
+
+package tools
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// isolateNetwork is only supported on Linux
+func isolateNetwork(cmd *exec.Cmd) error {
+	return errors.New("network isolation is only supported on Linux")
+}
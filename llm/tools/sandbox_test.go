@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSandboxRunScript(t *testing.T) {
+	t.Setenv("SANDBOX_SECRET", "secret")
+	base := t.TempDir()
+	sb := DefaultSandbox()
+	sb.BaseDir = base
+
+	out, err := sb.RunScript(context.Background(), "bash", "script.sh", []byte(`echo "pwd=$PWD"; echo "secret=$SANDBOX_SECRET"; echo "home=$HOME"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "pwd="+base) {
+		t.Errorf("Expected working directory under %s, got: %s", base, out)
+	}
+	if !strings.Contains(out, "secret=\n") {
+		t.Errorf("Expected environment not to be passed through, got: %s", out)
+	}
+	if strings.Contains(out, "home="+os.Getenv("HOME")+"\n") {
+		t.Errorf("Expected HOME to be the working directory, got: %s", out)
+	}
+	// The working directory is removed after the call
+	if entries, _ := os.ReadDir(base); len(entries) != 0 {
+		t.Errorf("Expected sandbox directory to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestSandboxRunShellScript(t *testing.T) {
+	t.Setenv("SANDBOX_SECRET", "secret")
+	script := filepath.Join(t.TempDir(), "hello.sh")
+	if err := os.WriteFile(script, []byte(`echo "hello $1"; echo "secret=$SANDBOX_SECRET"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	base := t.TempDir()
+	sb := DefaultSandbox()
+	sb.BaseDir = base
+
+	out, err := sb.RunShellScript(context.Background(), script, []string{"bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "hello bob\nsecret=\n" {
+		t.Errorf("Expected the script output without the secret, got: %q", out)
+	}
+	if entries, _ := os.ReadDir(base); len(entries) != 0 {
+		t.Errorf("Expected sandbox directory to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestSandboxOutputLimit(t *testing.T) {
+	sb := DefaultSandbox()
+	sb.MaxOutputBytes = 10
+	out, err := sb.RunScript(context.Background(), "bash", "script.sh", []byte(`printf '0123456789abcdef'`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "0123456789\n[output truncated]") {
+		t.Errorf("Expected truncated output, got: %q", out)
+	}
+}
+
+func TestSandboxLimits(t *testing.T) {
+	sb := DefaultSandbox()
+	sb.Timeout = 500 * time.Millisecond
+	start := time.Now()
+	if _, err := sb.RunScript(context.Background(), "bash", "script.sh", []byte(`sleep 5`)); err == nil {
+		t.Errorf("Expected timeout error")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("Expected the script to be stopped by the timeout, took %s", time.Since(start))
+	}
+
+	// a deadline of the caller is not reported as the sandbox timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := DefaultSandbox().RunScript(ctx, "bash", "script.sh", []byte(`sleep 5`))
+	if !errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "timed out after") {
+		t.Errorf("Expected the deadline of the caller, got %v", err)
+	}
+
+	sb = DefaultSandbox()
+	sb.FileSizeBytes = 1024
+	dir := t.TempDir()
+	target := filepath.Join(dir, "big")
+	if _, err := sb.Run(context.Background(), dir, "bash", "-c", "head -c 4096 /dev/zero > "+target); err == nil {
+		t.Errorf("Expected file size limit error")
+	}
+}
+
+func TestSandboxIsolateNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("network isolation is only supported on Linux")
+	}
+	sb := DefaultSandbox()
+	sb.IsolateNetwork = true
+	out, err := sb.RunScript(context.Background(), "bash", "script.sh", []byte(`cat /proc/net/dev | tail -n +3 | cut -d: -f1 | tr -d ' '`))
+	if err != nil {
+		t.Skipf("user namespaces not available: %v", err)
+	}
+	if strings.TrimSpace(out) != "lo" {
+		t.Errorf("Expected only the loopback interface, got: %q", out)
+	}
+}
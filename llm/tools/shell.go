@@ -2,16 +2,20 @@ package tools
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"text/template"
+	"time"
 )
 
+// ShellTool runs shell code snippets, in Sandbox when it is set
 type ShellTool struct {
+	Sandbox *Sandbox
 }
 
-func (t *ShellTool) Run(args map[string]any, code string) (string, error) {
+func (t *ShellTool) Run(ctx context.Context, args map[string]any, code string) (string, error) {
 	tmpl, err := template.New("shell").Parse(code)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse shell template: %w", err)
@@ -23,6 +27,10 @@ func (t *ShellTool) Run(args map[string]any, code string) (string, error) {
 		return "", fmt.Errorf("failed to execute shell template: %w", err)
 	}
 
+	if t.Sandbox != nil {
+		return t.Sandbox.RunScript(ctx, "bash", "script.sh", script.Bytes())
+	}
+
 	tmpfile, err := os.CreateTemp("", "shell-*.sh")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %w", err)
@@ -36,12 +44,15 @@ func (t *ShellTool) Run(args map[string]any, code string) (string, error) {
 		return "", fmt.Errorf("failed to close temp file: %w", err)
 	}
 
-	return RunShellScript(tmpfile.Name(), nil)
+	return RunShellScript(ctx, tmpfile.Name(), nil)
 }
 
 // RunShellScript executes a shell script and returns its combined stdout and stderr.
-func RunShellScript(scriptPath string, args []string) (string, error) {
-	cmd := exec.Command("bash", append([]string{scriptPath}, args...)...)
+// The script and its child processes are killed when ctx is done.
+func RunShellScript(ctx context.Context, scriptPath string, args []string) (string, error) {
+	cmd := exec.CommandContext(ctx, "bash", append([]string{scriptPath}, args...)...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = time.Second
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
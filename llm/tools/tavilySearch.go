@@ -12,18 +12,17 @@ import (
 )
 
 // TavilySearch performs a web search using the Tavily API.
-func TavilySearch(query string) (string, error) {
-	return TavilySearchWithLimit(query, 20)
+func TavilySearch(ctx context.Context, query string) (string, error) {
+	return TavilySearchWithLimit(ctx, query, 20)
 }
 
 // TavilySearchWithLimit performs a web search using the Tavily API with a custom result limit.
-// TavilySearchWithLimit performs a web search using the Tavily API with a custom result limit.
-func TavilySearchWithLimit(query string, maxResults int) (string, error) {
-	return TavilySearchWithLimitAndURL(query, maxResults, "https://api.tavily.com/search")
+func TavilySearchWithLimit(ctx context.Context, query string, maxResults int) (string, error) {
+	return TavilySearchWithLimitAndURL(ctx, query, maxResults, "https://api.tavily.com/search")
 }
 
 // TavilySearchWithLimitAndURL performs a web search using the Tavily API with a custom result limit and URL (for testing)
-func TavilySearchWithLimitAndURL(query string, maxResults int, apiURL string) (string, error) {
+func TavilySearchWithLimitAndURL(ctx context.Context, query string, maxResults int, apiURL string) (string, error) {
 	apiKey := os.Getenv("TAVILY_API_KEY")
 	if apiKey == "" {
 		return "", fmt.Errorf("TAVILY_API_KEY environment variable is not set")
@@ -46,7 +45,7 @@ func TavilySearchWithLimitAndURL(query string, maxResults int, apiURL string) (s
 		return "", fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", apiURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
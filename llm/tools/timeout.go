@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// timeoutTool limits the execution time of a tool
+type timeoutTool struct {
+	ITool
+	timeout time.Duration
+}
+
+// WithTimeout returns a tool whose calls are canceled after timeout, a non-positive timeout returns tool unchanged
+func WithTimeout(tool ITool, timeout time.Duration) ITool {
+	if timeout <= 0 {
+		return tool
+	}
+	return &timeoutTool{ITool: tool, timeout: timeout}
+}
+
+func (t *timeoutTool) Call(ctx context.Context, input string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	res, err := t.ITool.Call(ctx, input)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return res, fmt.Errorf("tool %s timed out after %s: %w", t.Name(), t.timeout, err)
+	}
+	return res, err
+}
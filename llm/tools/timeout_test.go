@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	slow := NewFunc("slow", "Wait for cancellation", func(ctx context.Context, args struct{}) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	tool := WithTimeout(slow, 50*time.Millisecond)
+	if tool.Name() != "slow" {
+		t.Errorf("Expected name slow, got %s", tool.Name())
+	}
+	_, err := tool.Call(context.Background(), "{}")
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+
+	if WithTimeout(slow, 0) != ITool(slow) {
+		t.Errorf("Expected a non-positive timeout to return the tool unchanged")
+	}
+}
+
+func TestRunShellScriptCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("bash scripts are not supported on windows")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.sh")
+	marker := filepath.Join(dir, "marker")
+	// The background child must be killed together with the script
+	content := "(sleep 1 && touch " + marker + ") &\nsleep 30\n"
+	if err := os.WriteFile(script, []byte(content), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := RunShellScript(ctx, script, nil); err == nil {
+		t.Fatal("Expected an error for a canceled script")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the script to be killed promptly, took %s", elapsed)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Expected child processes to be killed with the script")
+	}
+}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"encoding/json"
 	"slices"
 
 	"github.com/sashabaranov/go-openai"
@@ -21,6 +22,42 @@ type ITool interface {
 	DescriptionWithParamters() string
 }
 
+// wrappedTool adapts a langchaingo tool to ITool
+type wrappedTool struct {
+	tls.Tool
+	parameters any
+}
+
+// WrapTool adapts a langchaingo tool (e.g. an MCP tool) with its JSON Schema parameters to ITool.
+// A nil parameters schema defaults to a single "input" string.
+func WrapTool(tool tls.Tool, parameters any) ITool {
+	if parameters == nil {
+		parameters = map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"input": map[string]any{
+					"type":        "string",
+					"description": "The input of the tool.",
+				},
+			},
+			"required": []string{"input"},
+		}
+	}
+	return &wrappedTool{Tool: tool, parameters: parameters}
+}
+
+func (t *wrappedTool) Paramters() any {
+	return t.parameters
+}
+
+func (t *wrappedTool) DescriptionWithParamters() string {
+	params, err := json.Marshal(t.parameters)
+	if err != nil {
+		return t.Description()
+	}
+	return t.Description() + " Parameters: " + string(params)
+}
+
 // GetBaseTools returns the list of base tools available to all skills.
 func GetBaseTools() []openai.Tool {
 	return []openai.Tool{
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,12 +11,12 @@ import (
 
 // WebFetch retrieves the main text content from a given URL.
 // It uses goquery to parse the HTML and extract text, removing script and style tags.
-func WebFetch(urlString string) (string, error) {
+func WebFetch(ctx context.Context, urlString string) (string, error) {
 	client := http.Client{
 		Timeout: 20 * time.Second,
 	}
 
-	req, err := http.NewRequest("GET", urlString, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request for %s: %w", urlString, err)
 	}
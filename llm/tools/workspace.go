@@ -0,0 +1,224 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultMaxReadBytes is the default size limit of a file read by read_file
+	DefaultMaxReadBytes = 1 << 20
+	// DefaultMaxWriteBytes is the default size limit of a file written by write_file
+	DefaultMaxWriteBytes = 10 << 20
+)
+
+var (
+	// ErrPathEscape is returned when a path resolves outside the workspace
+	ErrPathEscape = errors.New("path escapes the workspace")
+	// ErrReadOnly is returned when writing to a read-only mount
+	ErrReadOnly = errors.New("path is read-only")
+	// ErrFileTooLarge is returned when a file exceeds the size limit
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// Workspace jails the file tools to a root directory.
+// Paths are canonicalized and symbolic links are resolved, a path is only allowed
+// when its real location is inside Root or one of the read-only mounts.
+type Workspace struct {
+	// Root is the writable workspace directory, it is created on the first write
+	Root string
+	// ReadOnly lists directories that can be read but not written, e.g. skill resources
+	ReadOnly []string
+	// MaxReadBytes limits the size of a read file, 0 uses DefaultMaxReadBytes and a negative value disables the limit
+	MaxReadBytes int64
+	// MaxWriteBytes limits the size of a written file, 0 uses DefaultMaxWriteBytes and a negative value disables the limit
+	MaxWriteBytes int64
+}
+
+type workspaceKey struct{}
+
+// WithWorkspace returns a copy of ctx carrying the workspace of the file tools
+func WithWorkspace(ctx context.Context, ws *Workspace) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, ws)
+}
+
+// WorkspaceFromContext returns the workspace carried by ctx or nil
+func WorkspaceFromContext(ctx context.Context) *Workspace {
+	ws, _ := ctx.Value(workspaceKey{}).(*Workspace)
+	return ws
+}
+
+// WithReadOnly returns a copy of the workspace with additional read-only directories
+func (w *Workspace) WithReadOnly(dirs ...string) *Workspace {
+	ret := *w
+	ret.ReadOnly = append(append([]string(nil), w.ReadOnly...), dirs...)
+	return &ret
+}
+
+// ReadFile reads a file inside the workspace.
+// Relative paths are resolved against Root first and then against the read-only mounts.
+func (w *Workspace) ReadFile(path string) (string, error) {
+	resolved, err := w.resolveRead(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("failed to read file '%s': is a directory", path)
+	}
+	if limit := sizeLimit(w.MaxReadBytes, DefaultMaxReadBytes); limit > 0 && info.Size() > limit {
+		return "", fmt.Errorf("failed to read file '%s': %w: %d bytes exceeds the limit of %d bytes", path, ErrFileTooLarge, info.Size(), limit)
+	}
+	return ReadFile(resolved)
+}
+
+// WriteFile writes a file inside the workspace root, missing parent directories are created
+func (w *Workspace) WriteFile(path string, content string) error {
+	if limit := sizeLimit(w.MaxWriteBytes, DefaultMaxWriteBytes); limit > 0 && int64(len(content)) > limit {
+		return fmt.Errorf("failed to write to file '%s': %w: %d bytes exceeds the limit of %d bytes", path, ErrFileTooLarge, len(content), limit)
+	}
+	if w.Root == "" {
+		return fmt.Errorf("failed to write to file '%s': %w: no writable workspace", path, ErrReadOnly)
+	}
+	if err := os.MkdirAll(w.Root, 0755); err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	resolved, err := resolveIn(w.Root, path)
+	if err != nil {
+		if errors.Is(err, ErrPathEscape) && w.readOnlyContains(path) {
+			return fmt.Errorf("failed to write to file '%s': %w", path, ErrReadOnly)
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
+		return fmt.Errorf("failed to write to file '%s': %w", path, err)
+	}
+	return WriteFile(resolved, content)
+}
+
+// resolveRead resolves a path for reading in the root or the read-only mounts
+func (w *Workspace) resolveRead(path string) (string, error) {
+	var dirs []string
+	if w.Root != "" {
+		dirs = append(dirs, w.Root)
+	}
+	dirs = append(dirs, w.ReadOnly...)
+
+	var firstErr error
+	for _, dir := range dirs {
+		resolved, err := resolveIn(dir, path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if _, err := os.Lstat(resolved); err == nil {
+			return resolved, nil
+		} else if firstErr == nil {
+			firstErr = fmt.Errorf("failed to read file '%s': %w", path, err)
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("%w: %s", ErrPathEscape, path)
+	}
+	return "", firstErr
+}
+
+// readOnlyContains reports whether path resolves inside one of the read-only mounts
+func (w *Workspace) readOnlyContains(path string) bool {
+	for _, dir := range w.ReadOnly {
+		if _, err := resolveIn(dir, path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveIn canonicalizes path against dir and returns its real location.
+// Relative paths are joined to dir, absolute paths must already be inside dir.
+// Symbolic links are followed and the result must still be inside dir.
+func resolveIn(dir string, path string) (string, error) {
+	if path == "" {
+		return "", errors.New("path is empty")
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+
+	target := path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	target = filepath.Clean(target)
+	if !within(root, target) {
+		// Absolute paths given through a symlinked root are compared by their real location
+		real, err := evalExisting(target)
+		if err != nil || !within(root, real) {
+			return "", fmt.Errorf("%w: %s is outside %s", ErrPathEscape, path, dir)
+		}
+	}
+
+	real, err := evalExisting(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve '%s': %w", path, err)
+	}
+	if !within(root, real) {
+		return "", fmt.Errorf("%w: %s resolves to %s outside %s", ErrPathEscape, path, real, dir)
+	}
+	return real, nil
+}
+
+// evalExisting resolves the symbolic links of the longest existing prefix of path
+// and appends the remaining (not yet existing) elements
+func evalExisting(path string) (string, error) {
+	var rest []string
+	current := path
+	for {
+		real, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if _, err := os.Lstat(current); err == nil {
+			// A dangling symbolic link could be created outside the workspace when written
+			return "", fmt.Errorf("%w: dangling symbolic link %s", ErrPathEscape, current)
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path, nil
+		}
+		rest = append([]string{filepath.Base(current)}, rest...)
+		current = parent
+	}
+}
+
+// within reports whether path is dir or inside dir
+func within(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func sizeLimit(limit int64, def int64) int64 {
+	if limit == 0 {
+		return def
+	}
+	return limit
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspaceReadWrite(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "session")
+	skillDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(skillDir, "SKILL.md"), []byte("skill body"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ws := (&Workspace{Root: root}).WithReadOnly(skillDir)
+
+	if err := ws.WriteFile("out/result.txt", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ws.ReadFile("out/result.txt"); err != nil || got != "hello" {
+		t.Errorf("Expected 'hello', got %q (err: %v)", got, err)
+	}
+	if got, err := ws.ReadFile(filepath.Join(root, "out", "result.txt")); err != nil || got != "hello" {
+		t.Errorf("Expected absolute path inside root to be readable, got %q (err: %v)", got, err)
+	}
+	// Relative paths fall back to the read-only mounts
+	if got, err := ws.ReadFile("SKILL.md"); err != nil || got != "skill body" {
+		t.Errorf("Expected skill resource to be readable, got %q (err: %v)", got, err)
+	}
+	if err := ws.WriteFile(filepath.Join(skillDir, "SKILL.md"), "changed"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestWorkspaceEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing.txt"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	ws := &Workspace{Root: root}
+
+	tests := []struct {
+		name  string
+		path  string
+		write bool
+	}{
+		{"absolute path", secret, false},
+		{"parent traversal", "../" + filepath.Base(outside) + "/secret.txt", false},
+		{"symlink read", "link/secret.txt", false},
+		{"symlink write", "link/new.txt", true},
+		{"dangling symlink write", "dangling", true},
+		{"absolute write", filepath.Join(outside, "new.txt"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.write {
+				err = ws.WriteFile(tt.path, "x")
+			} else {
+				_, err = ws.ReadFile(tt.path)
+			}
+			if !errors.Is(err, ErrPathEscape) {
+				t.Errorf("Expected ErrPathEscape, got %v", err)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); err == nil {
+		t.Errorf("Expected no file to be written outside the workspace")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "missing.txt")); err == nil {
+		t.Errorf("Expected the dangling symlink target not to be created")
+	}
+}
+
+func TestWorkspaceSizeLimits(t *testing.T) {
+	ws := &Workspace{Root: t.TempDir(), MaxReadBytes: 4, MaxWriteBytes: 8}
+	if err := ws.WriteFile("big.txt", strings.Repeat("x", 9)); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge on write, got %v", err)
+	}
+	if err := ws.WriteFile("small.txt", "12345"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.ReadFile("small.txt"); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge on read, got %v", err)
+	}
+}
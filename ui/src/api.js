@@ -1,11 +1,16 @@
 import axios from 'axios'
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || '/api'
+const API_KEY = import.meta.env.VITE_API_KEY || ''
+
+// authHeaders carries the API key when the server requires authentication
+const authHeaders = API_KEY ? { Authorization: `Bearer ${API_KEY}` } : {}
 
 const api = axios.create({
   baseURL: API_BASE_URL,
   headers: {
-    'Content-Type': 'application/json'
+    'Content-Type': 'application/json',
+    ...authHeaders
   }
 })
 
@@ -16,8 +21,9 @@ export const checkHealth = async () => {
 }
 
 // Non-streaming chat
-export const chat = async (message, enableSkills = true, enableMCP = false) => {
+export const chat = async (message, enableSkills = true, enableMCP = false, sessionId = '') => {
   const response = await api.post('/chat', {
+    sessionId,
     message,
     enableSkills,
     enableMCP
@@ -26,13 +32,15 @@ export const chat = async (message, enableSkills = true, enableMCP = false) => {
 }
 
 // Streaming chat using Server-Sent Events
-export const chatStream = async (message, enableSkills = true, enableMCP = false, callbacks) => {
-  const response = await fetch(`${API_BASE_URL}/chat/stream`, {
+export const chatStream = async (message, enableSkills = true, enableMCP = false, callbacks, sessionId = '') => {
+  let response = await fetch(`${API_BASE_URL}/chat/stream`, {
     method: 'POST',
     headers: {
-      'Content-Type': 'application/json'
+      'Content-Type': 'application/json',
+      ...authHeaders
     },
     body: JSON.stringify({
+      sessionId,
       message,
       enableSkills,
       enableMCP
@@ -43,10 +51,42 @@ export const chatStream = async (message, enableSkills = true, enableMCP = false
     throw new Error(`HTTP error! status: ${response.status}`)
   }
 
+  const runId = response.headers.get('X-Run-ID')
+  const state = { lastEventId: 0, fullResponse: '', ended: false }
+
+  // Reconnect to the run when the connection drops before the end event,
+  // the server replays the events after the last received ID
+  for (let attempt = 0; ; attempt++) {
+    try {
+      await readStream(response, callbacks, state)
+    } catch (err) {
+      if (!runId || attempt >= MAX_RECONNECTS) throw err
+    }
+    if (state.ended || !runId || attempt >= MAX_RECONNECTS) break
+
+    await new Promise(resolve => setTimeout(resolve, 1000))
+    try {
+      response = await fetch(`${API_BASE_URL}/runs/${runId}/events`, {
+        headers: { ...authHeaders, 'Last-Event-ID': String(state.lastEventId) }
+      })
+    } catch {
+      continue
+    }
+    if (!response.ok) {
+      throw new Error(`HTTP error! status: ${response.status}`)
+    }
+  }
+
+  return state.fullResponse
+}
+
+const MAX_RECONNECTS = 5
+
+// readStream dispatches the SSE events of a response to the callbacks until the end event
+const readStream = async (response, callbacks, state) => {
   const reader = response.body.getReader()
   const decoder = new TextDecoder()
   let buffer = ''
-  let fullResponse = ''
 
   try {
     while (true) {
@@ -56,43 +96,67 @@ export const chatStream = async (message, enableSkills = true, enableMCP = false
 
       buffer += decoder.decode(value, { stream: true })
 
-      // Process SSE events
-      const lines = buffer.split('\n')
-      buffer = lines.pop() || ''
+      // Process SSE events, separated by a blank line
+      const blocks = buffer.split('\n\n')
+      buffer = blocks.pop() || ''
 
-      for (const line of lines) {
-        if (line.startsWith('data: ')) {
-          const data = line.slice(6)
-          if (callbacks.onChunk) {
-            callbacks.onChunk(data)
+      for (const block of blocks) {
+        let eventName = 'message'
+        const dataLines = []
+        for (const line of block.split('\n')) {
+          if (line.startsWith('id:')) {
+            state.lastEventId = Number(line.slice(3).trim()) || state.lastEventId
+          } else if (line.startsWith('event:')) {
+            eventName = line.slice(6).trim()
+          } else if (line.startsWith('data:')) {
+            dataLines.push(line.slice(5).replace(/^ /, ''))
           }
-          fullResponse += data
-        } else if (line.startsWith('event: ')) {
-          const event = line.slice(7)
-          if (event === 'done') {
+        }
+        if (dataLines.length === 0) continue
+
+        let data
+        try {
+          data = JSON.parse(dataLines.join('\n'))
+        } catch {
+          data = { type: eventName, content: dataLines.join('\n') }
+        }
+
+        switch (data.type || eventName) {
+          case 'token':
+            state.fullResponse += data.content
+            if (callbacks.onChunk) {
+              callbacks.onChunk(data.content)
+            }
+            break
+          case 'done':
+            state.fullResponse = data.content
             if (callbacks.onDone) {
-              callbacks.onDone(fullResponse)
+              callbacks.onDone(state.fullResponse)
             }
-          } else if (event === 'error') {
-            const nextLine = lines.find(l => l.startsWith('data: '))
-            if (nextLine && callbacks.onError) {
-              callbacks.onError(nextLine.slice(6))
+            break
+          case 'error':
+            if (callbacks.onError) {
+              callbacks.onError(data.error || data.content)
             }
-          } else if (event === 'end') {
+            break
+          case 'end':
+            state.ended = true
             if (callbacks.onEnd) {
               callbacks.onEnd()
             }
-            // Break out of the loop and return
-            return fullResponse
-          }
+            return
+          default:
+            // tool_call_start, tool_call_args, tool_result, node_start, node_end,
+            // skill_selected, usage and approval_required
+            if (callbacks.onEvent) {
+              callbacks.onEvent(data)
+            }
         }
       }
     }
   } finally {
     reader.releaseLock()
   }
-
-  return fullResponse
 }
 
 export default api
\ No newline at end of file